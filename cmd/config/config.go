@@ -0,0 +1,297 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/credstore"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+)
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print a configuration value of the active profile",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+
+		value, ok, err := config.GetValue(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			log.Fatalf("%s is not set", args[0])
+		}
+		fmt.Println(value)
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a configuration value of the active profile",
+	Long: `Set a configuration value of the active profile. Keys are dotted paths
+such as openai.timeout or custom.ollama.base_url; run 'config list --schema'
+for all of them.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		key, value := args[0], args[1]
+
+		config := loadConfig()
+		if err := config.SetValue(key, value); err != nil {
+			log.Fatal(err)
+		}
+		saveConfig(config)
+
+		fmt.Printf("Set %s\n", key)
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a configuration value of the active profile",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := args[0]
+
+		config := loadConfig()
+		if err := config.UnsetValue(key); err != nil {
+			log.Fatal(err)
+		}
+		saveConfig(config)
+
+		fmt.Printf("Unset %s\n", key)
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the configuration values of the active profile",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		schema, _ := cmd.Flags().GetBool("schema")
+		if schema {
+			printSchema()
+			return
+		}
+
+		config := loadConfig()
+		values, err := config.Values()
+		if err != nil {
+			log.Fatalf("failed to list config: %v", err)
+		}
+
+		fmt.Printf("Profile: %s\n", config.Profile())
+		if len(values) == 0 {
+			fmt.Println("  (no values set)")
+		}
+		for _, value := range values {
+			fmt.Printf("  %s = %s\n", value[0], value[1])
+		}
+	},
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit config.json in $EDITOR",
+	Long: `Open config.json in $VISUAL or $EDITOR (default vi). The edited file is
+checked before it replaces the current one; if it has errors it is kept
+aside and the current config is left unchanged.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, err := providers.ConfigPath()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := os.Stat(configPath); os.IsNotExist(err) {
+			// Write the default config so there is something to edit.
+			saveConfig(loadConfig())
+		}
+
+		original, err := os.ReadFile(configPath)
+		if err != nil {
+			log.Fatalf("failed to read config: %v", err)
+		}
+
+		tmp, err := os.CreateTemp(filepath.Dir(configPath), "config-*.json")
+		if err != nil {
+			log.Fatalf("failed to create temporary file: %v", err)
+		}
+		tmp.Close()
+		if err := os.WriteFile(tmp.Name(), original, 0600); err != nil {
+			log.Fatalf("failed to write temporary file: %v", err)
+		}
+
+		if err := runEditor(tmp.Name()); err != nil {
+			log.Fatalf("editor failed: %v (your edit is kept at %s)", err, tmp.Name())
+		}
+
+		edited, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			log.Fatalf("failed to read edited config: %v", err)
+		}
+		if bytes.Equal(edited, original) {
+			os.Remove(tmp.Name())
+			fmt.Println("No changes")
+			return
+		}
+
+		warnings, errs, err := providers.CheckConfig(edited)
+		if err != nil {
+			log.Fatalf("invalid config: %v (your edit is kept at %s)", err, tmp.Name())
+		}
+		for _, warning := range warnings {
+			log.Warn(warning)
+		}
+		if len(errs) > 0 {
+			for _, err := range errs {
+				log.Error(err)
+			}
+			log.Fatalf("config has errors; not saved (your edit is kept at %s)", tmp.Name())
+		}
+
+		if err := os.Rename(tmp.Name(), configPath); err != nil {
+			log.Fatalf("failed to save config: %v", err)
+		}
+		fmt.Println("Config saved")
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check config.json for errors and unknown keys",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, err := providers.ConfigPath()
+		if err != nil {
+			log.Fatal(err)
+		}
+		data, err := os.ReadFile(configPath)
+		if os.IsNotExist(err) {
+			fmt.Printf("%s does not exist; defaults are in use\n", configPath)
+			return
+		}
+		if err != nil {
+			log.Fatalf("failed to read config: %v", err)
+		}
+
+		warnings, errs, err := providers.CheckConfig(data)
+		if err != nil {
+			log.Fatalf("invalid config: %v", err)
+		}
+		for _, warning := range warnings {
+			fmt.Printf("warning: %s\n", warning)
+		}
+		for _, err := range errs {
+			fmt.Printf("error: %v\n", err)
+		}
+		if len(errs) > 0 {
+			log.Fatalf("%s has %d error(s)", configPath, len(errs))
+		}
+		fmt.Printf("%s is valid (%d warning(s))\n", configPath, len(warnings))
+	},
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print where the config, credential store and database live",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+
+		configPath, err := providers.ConfigPath()
+		if err != nil {
+			log.Fatal(err)
+		}
+		storePath, err := credstore.DefaultPath()
+		if err != nil {
+			log.Fatal(err)
+		}
+		dbPath, err := filepath.Abs(config.DatabasePath())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Profile: %s\n", config.Profile())
+		fmt.Printf("Config: %s\n", configPath)
+		fmt.Printf("Credentials: %s\n", storePath)
+		fmt.Printf("Database: %s\n", dbPath)
+	},
+}
+
+func loadConfig() *providers.Config {
+	config, err := providers.LoadConfig()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	return config
+}
+
+// saveConfig validates the active profile and saves the config.
+func saveConfig(config *providers.Config) {
+	if errs := config.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			log.Error(err)
+		}
+		log.Fatal("config not saved")
+	}
+	if err := providers.SaveConfig(config); err != nil {
+		log.Fatalf("failed to save config: %v", err)
+	}
+}
+
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// The editor may include arguments, as in "code --wait".
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func printSchema() {
+	fmt.Println("Keys of a profile (\"*\" stands for any name):")
+	for _, entry := range providers.Schema {
+		kind := entry.Type
+		if len(entry.Values) > 0 {
+			kind = strings.Join(entry.Values, "|")
+		}
+		fmt.Printf("  %-36s %-10s %s\n", entry.Key, kind, entry.Description)
+	}
+}
+
+func NewRootCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage promptctl configuration",
+		Long: `Inspect and change ~/.promptctl/config.json. Values are read from and
+written to the active profile; select another with --profile.`,
+	}
+
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configEditCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configPathCmd)
+	configCmd.AddCommand(newProfileCmd())
+
+	configListCmd.Flags().Bool("schema", false, "List every supported key instead of the values set")
+
+	return configCmd
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/providers"
+)
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List configuration profiles",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		names, active, err := providers.ListProfiles()
+		if err != nil {
+			log.Fatalf("failed to list profiles: %v", err)
+		}
+
+		fmt.Println("Profiles:")
+		for _, name := range names {
+			marker := " "
+			if name == active {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, name)
+		}
+	},
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Make a profile the active one",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		if err := providers.UseProfile(name); err != nil {
+			log.Fatalf("failed to use profile: %v", err)
+		}
+		fmt.Printf("Using profile: %s\n", name)
+	},
+}
+
+var profileCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a configuration profile",
+	Long: `Create a profile with its own providers, keys, database and defaults.
+
+Providers are configured for a profile by selecting it, for example:
+
+  promptctl config profile create sandbox --provider mock --model echo
+  promptctl --profile sandbox provider add openai -`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		database, _ := cmd.Flags().GetString("database")
+
+		var defaults providers.Defaults
+		defaults.Provider, _ = cmd.Flags().GetString("provider")
+		defaults.Model, _ = cmd.Flags().GetString("model")
+
+		if err := providers.CreateProfile(name, database, defaults); err != nil {
+			log.Fatalf("failed to create profile: %v", err)
+		}
+		fmt.Printf("Created profile: %s\n", name)
+	},
+}
+
+func newProfileCmd() *cobra.Command {
+	profileCmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage configuration profiles",
+		Long: `Profiles keep separate providers, keys, database and defaults, for example
+for a sandbox and a production setup. The active profile is chosen with the
+--profile flag, else the PROMPTCTL_PROFILE environment variable, else
+'config profile use'.`,
+	}
+
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileUseCmd)
+	profileCmd.AddCommand(profileCreateCmd)
+
+	profileCreateCmd.Flags().String("database", "", "Database path (default: promptctl-<name>.db)")
+	profileCreateCmd.Flags().String("provider", "", "Default provider for 'run prompt'")
+	profileCreateCmd.Flags().String("model", "", "Default model for 'run prompt'")
+
+	return profileCmd
+}
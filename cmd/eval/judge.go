@@ -0,0 +1,147 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/farbodsalimi/promptctl/internal/cmdutil"
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/eval"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+	"github.com/farbodsalimi/promptctl/internal/runner"
+)
+
+// grader is the grader prompt of judge assertions, resolved with the
+// provider and model it runs with.
+type grader struct {
+	pv       *db.PromptVersion
+	settings runner.Settings
+	llm      providers.LLM
+}
+
+// judge grades responses with the graders of judge assertions.
+type judge struct {
+	graders map[string]*grader
+}
+
+// gradeKey locates the grade of a case's judge assertion.
+type gradeKey struct {
+	row, assertion int
+}
+
+// newJudge resolves the grader of every judge assertion of cases. A grader
+// runs with the provider and model its assertion names, falling back to
+// provider and model, then to the grader prompt's fallback chain and the
+// profile defaults.
+func newJudge(router *providers.Router, cases []eval.Case, provider, model string) (*judge, error) {
+	j := &judge{graders: map[string]*grader{}}
+	for _, c := range cases {
+		for _, a := range c.Assert {
+			if a.Type != eval.AssertJudge || j.graders[graderID(a)] != nil {
+				continue
+			}
+			vaultName, promptName, version, err := cmdutil.PromptRef(a.Grader)
+			if err != nil {
+				return nil, fmt.Errorf("case %s: grader %s: %w", c.Name, a.Grader, err)
+			}
+			g := &grader{settings: runner.Settings{Provider: a.Provider, Options: providers.Options{Model: a.Model}}}
+			if g.settings.Provider == "" {
+				g.settings.Provider = provider
+			}
+			if g.settings.Options.Model == "" {
+				g.settings.Options.Model = model
+			}
+			if err := runner.ResolveSettings(&g.settings, vaultName, promptName); err != nil {
+				return nil, fmt.Errorf("case %s: grader %s: %w", c.Name, a.Grader, err)
+			}
+			g.pv, err = db.GetPromptVersion(vaultName, promptName, version)
+			if err != nil {
+				return nil, fmt.Errorf("case %s: grader %s: %w", c.Name, a.Grader, err)
+			}
+			g.llm, err = g.settings.Client(router)
+			if err != nil {
+				return nil, fmt.Errorf("case %s: grader %s: %w", c.Name, a.Grader, err)
+			}
+			j.graders[graderID(a)] = g
+		}
+	}
+	return j, nil
+}
+
+// graderID identifies the grader of a judge assertion.
+func graderID(a eval.Assertion) string {
+	return a.Grader + " " + a.Provider + " " + a.Model
+}
+
+// grade sends the response of every completed case to the graders of its
+// judge assertions and returns their runs, stored linked to the run they
+// graded.
+func (j *judge) grade(ctx context.Context, results []caseResult, concurrency int, timeout time.Duration) (map[gradeKey]*db.Run, error) {
+	var keys []gradeKey
+	var requests []runner.Request
+	for i, result := range results {
+		if result.Run == nil || result.Run.Status != db.RunStatusCompleted {
+			continue
+		}
+		for k, a := range result.Case.Assert {
+			if a.Type != eval.AssertJudge {
+				continue
+			}
+			g := j.graders[graderID(a)]
+			vars := a.GraderVars(inputText(result.Messages), result.Run.Response, result.Case.Vars)
+			messages, err := runner.Render(g.pv, vars)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render grader %s: %w", a.Grader, err)
+			}
+			req := g.settings.Request(g.llm, g.pv, messages, vars)
+			req.GradedRunID = result.Run.ID
+			keys = append(keys, gradeKey{i, k})
+			requests = append(requests, req)
+		}
+	}
+
+	grades := map[gradeKey]*db.Run{}
+	for i, r := range runner.ExecuteAll(ctx, requests, concurrency, timeout, nil) {
+		if r != nil {
+			grades[keys[i]] = r
+		}
+	}
+	return grades, nil
+}
+
+// judgeResult returns the outcome of a judge assertion graded by the
+// grader run r, nil if the response was not graded.
+func judgeResult(a eval.Assertion, r *db.Run) eval.Result {
+	if r == nil {
+		return eval.Result{Assertion: a.String(), Message: "not graded"}
+	}
+	if r.Status != db.RunStatusCompleted {
+		return eval.Result{
+			Assertion:   a.String(),
+			Message:     fmt.Sprintf("grader run %d %s: %s", r.ID, r.Status, r.ErrorMessage),
+			GraderRunID: r.ID,
+		}
+	}
+	grade, err := eval.ParseGrade(r.Response)
+	if err != nil {
+		return eval.Result{Assertion: a.String(), Message: err.Error(), GraderRunID: r.ID}
+	}
+	result := a.Judge(grade)
+	result.GraderRunID = r.ID
+	return result
+}
+
+// inputText writes the messages a response answered as text for a grader.
+// A single user message is written as is.
+func inputText(messages []providers.Message) string {
+	if len(messages) == 1 && messages[0].Role == providers.RoleUser {
+		return messages[0].Content
+	}
+	parts := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		parts = append(parts, fmt.Sprintf("%s: %s", msg.Role, msg.Content))
+	}
+	return strings.Join(parts, "\n\n")
+}
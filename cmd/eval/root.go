@@ -0,0 +1,21 @@
+package eval
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func NewRootCmd() *cobra.Command {
+	evalCmd := &cobra.Command{
+		Use:   "eval",
+		Short: "Evaluate prompts against test suites",
+		Long:  `Store test cases with a prompt and run them to check its responses.`,
+	}
+
+	evalCmd.AddCommand(NewAddCmd())
+	evalCmd.AddCommand(NewImportCmd())
+	evalCmd.AddCommand(NewListCmd())
+	evalCmd.AddCommand(NewRemoveCmd())
+	evalCmd.AddCommand(NewRunCmd())
+
+	return evalCmd
+}
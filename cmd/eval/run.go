@@ -0,0 +1,330 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/cmdutil"
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/eval"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+	"github.com/farbodsalimi/promptctl/internal/report"
+	"github.com/farbodsalimi/promptctl/internal/runner"
+)
+
+// evalParams are the settings of an evaluation, stored with its run group.
+// Row i of the group is the run of Cases[i-1].
+type evalParams struct {
+	Vault   string   `json:"vault"`
+	Prompt  string   `json:"prompt"`
+	Version int      `json:"version"`
+	Cases   []string `json:"cases"`
+	runner.Settings
+}
+
+// caseResult is the outcome of a test case: the messages sent, its run,
+// nil if it never started, and the outcome of each assertion.
+type caseResult struct {
+	Case     eval.Case
+	Messages []providers.Message
+	Run      *db.Run
+	Results  []eval.Result
+	Passed   bool
+}
+
+func NewRunCmd() *cobra.Command {
+	var (
+		only           []string
+		concurrency    int
+		graderProvider string
+		graderModel    string
+		reports        []string
+		failUnder      float64
+		minScore       float64
+	)
+
+	evalRunCmd := &cobra.Command{
+		Use:   "run <vault>/<name>[@<version>]",
+		Short: "Run a prompt's evaluation suite",
+		Long: `Run every test case of a prompt's evaluation suite through the provider,
+check each response with the case's assertions and print whether it passed.
+The latest version of the prompt is evaluated unless one is given, as in
+support/greeting@3.
+
+Judge assertions send each response to their grader prompt, with the
+provider and model the assertion names, else --grader-provider and
+--grader-model, else the grader prompt's fallback chain and the profile
+defaults. The grader runs are stored linked to the run they graded, and the
+scores of each judge assertion are summed up across the suite.
+
+Each case is stored as a run of a new evaluation, with the outcome of its
+assertions. --report writes the outcome to a .json, .xml (JUnit) or .tap
+file for CI. --fail-under sets the percentage of cases that must pass, and
+--min-score the mean score each judge assertion must reach across the
+suite. The exit status is 0 when both thresholds are met, 1 when either is
+not, 2 when the evaluation could not run and 3 when it was interrupted
+before every case ran.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultName, promptName, version, err := cmdutil.PromptRef(args[0])
+			if err != nil {
+				return report.Fail(err)
+			}
+			if concurrency < 1 {
+				return report.Errorf("concurrency must be at least 1")
+			}
+			if err := report.ValidateFailUnder(failUnder); err != nil {
+				return report.Fail(err)
+			}
+			checkScores := cmd.Flags().Changed("min-score")
+			for _, path := range reports {
+				if err := report.ValidatePath(path); err != nil {
+					return report.Fail(err)
+				}
+			}
+
+			params := evalParams{Vault: vaultName, Prompt: promptName}
+			params.Settings, err = cmdutil.ReadSettings(cmd, vaultName, promptName)
+			if err != nil {
+				return report.Fail(err)
+			}
+			pv, err := db.GetPromptVersion(vaultName, promptName, version)
+			if err != nil {
+				return report.Errorf("failed to get prompt content: %w", err)
+			}
+			params.Version = pv.Version
+
+			cases, err := cmdutil.LoadCases(vaultName, promptName)
+			if err != nil {
+				return report.Fail(err)
+			}
+			if cases, err = cmdutil.SelectCases(cases, only); err != nil {
+				return report.Fail(err)
+			}
+			if len(cases) == 0 {
+				return report.Errorf("%s/%s has no test cases (add some with 'promptctl eval add')", vaultName, promptName)
+			}
+			if checkScores && !slices.ContainsFunc(cases, func(c eval.Case) bool {
+				return slices.ContainsFunc(c.Assert, func(a eval.Assertion) bool { return a.Type == eval.AssertJudge })
+			}) {
+				return report.Errorf("--min-score needs judge assertions to score, but no case has any")
+			}
+
+			timeout, err := params.TimeLimit()
+			if err != nil {
+				return report.Errorf("invalid timeout: %w", err)
+			}
+			ctx := cmd.Context()
+			router, err := providers.GetProvider(ctx)
+			if err != nil {
+				return report.Errorf("failed to get provider: %w", err)
+			}
+			llm, err := params.Client(router)
+			if err != nil {
+				return report.Fail(err)
+			}
+			graders, err := newJudge(router, cases, graderProvider, graderModel)
+			if err != nil {
+				return report.Fail(err)
+			}
+
+			requests := make([]runner.Request, len(cases))
+			for i, c := range cases {
+				messages, err := runner.Render(pv, c.Vars)
+				if err != nil {
+					return report.Errorf("failed to render case %s: %w", c.Name, err)
+				}
+				requests[i] = params.Request(llm, pv, messages, c.Vars)
+				requests[i].GroupRow = i + 1
+				params.Cases = append(params.Cases, c.Name)
+			}
+
+			paramsJSON, _ := json.Marshal(params)
+			group := &db.RunGroup{Kind: db.RunGroupEval, PromptVersionID: pv.ID, Params: string(paramsJSON)}
+			if err := db.CreateRunGroup(group); err != nil {
+				return report.Errorf("failed to create evaluation: %w", err)
+			}
+			for i := range requests {
+				requests[i].GroupID = group.ID
+			}
+			fmt.Printf("Evaluation %d: %s/%s v%d, %d case(s) with %s\n", group.ID, vaultName, promptName,
+				pv.Version, len(cases), target(params.Settings))
+
+			results := make([]caseResult, len(cases))
+			for i, c := range cases {
+				results[i].Case = c
+				results[i].Messages = requests[i].Messages
+			}
+			for i, r := range runner.ExecuteAll(ctx, requests, concurrency, timeout, nil) {
+				results[i].Run = r
+			}
+			grades, err := graders.grade(ctx, results, concurrency, timeout)
+			if err != nil {
+				return report.Fail(err)
+			}
+
+			rep := report.New(db.RunGroupEval, group.ID, fmt.Sprintf("%s/%s@v%d", vaultName, promptName, pv.Version),
+				params.Provider, params.Options.Model)
+			graded := make([][]eval.Result, 0, len(results))
+			for i := range results {
+				if results[i].Run != nil {
+					evaluate(&results[i], func(k int) eval.Result {
+						return judgeResult(results[i].Case.Assert[k], grades[gradeKey{i, k}])
+					})
+				}
+				printResult(results[i])
+				rep.Add(reportCase(results[i]))
+				graded = append(graded, results[i].Results)
+			}
+			rep.Scores = eval.Scores(graded)
+			if len(rep.Scores) > 0 {
+				fmt.Println("Scores:")
+				for _, s := range rep.Scores {
+					fmt.Printf("  %s: mean %.2f, lowest %g, highest %g over %d case(s), %d passed\n",
+						s.Assertion, s.Mean, s.Lowest, s.Highest, s.Cases, s.Passed)
+				}
+			}
+
+			if checkScores {
+				rep.Summary.MinScore = &minScore
+			}
+			code := rep.Finish(failUnder)
+			for _, path := range reports {
+				if err := rep.Write(path); err != nil {
+					return report.Errorf("failed to write report: %w", err)
+				}
+			}
+			summary := rep.Summary
+			line := fmt.Sprintf("%d case(s): %d passed, %d failed", summary.Total, summary.Passed, summary.Failed)
+			if summary.Skipped > 0 {
+				line += fmt.Sprintf(", %d not run", summary.Skipped)
+			}
+			fmt.Println(line)
+			for _, path := range reports {
+				fmt.Printf("Report written to %s\n", path)
+			}
+
+			switch code {
+			case report.ExitIncomplete:
+				log.Errorf("evaluation %d was interrupted before %d case(s) ran", group.ID, summary.Skipped)
+			case report.ExitFailed:
+				switch {
+				case summary.PassRate >= failUnder:
+				case failUnder < 100:
+					log.Errorf("pass rate %.2f%% is under %g%%", summary.PassRate, failUnder)
+				default:
+					log.Errorf("%d of %d cases failed", summary.Failed, summary.Total)
+				}
+				for _, s := range rep.ScoresUnder() {
+					log.Errorf("mean score %.2f of %s is under %g", s.Mean, s.Assertion, minScore)
+				}
+			}
+			return report.Exit(code)
+		},
+	}
+
+	evalRunCmd.Flags().StringArrayVar(&only, "case", nil, "Only run this case; repeat for several")
+	evalRunCmd.Flags().IntVar(&concurrency, "concurrency", 4, "Number of cases to run at once")
+	evalRunCmd.Flags().StringVar(&graderProvider, "grader-provider", "", "Provider of graders whose judge assertion names none")
+	evalRunCmd.Flags().StringVar(&graderModel, "grader-model", "", "Model of graders whose judge assertion names none")
+	evalRunCmd.Flags().StringArrayVar(&reports, "report", nil, "Write a report to a .json, .xml (JUnit) or .tap file; repeat for several")
+	evalRunCmd.Flags().Float64Var(&failUnder, "fail-under", 100, "Fail when under this percentage of cases pass")
+	evalRunCmd.Flags().Float64Var(&minScore, "min-score", 0, "Fail when the mean score of any judge assertion is under this")
+	cmdutil.AddSettingFlags(evalRunCmd, "every run of the evaluation")
+
+	return cmdutil.Reporting(evalRunCmd)
+}
+
+// evaluate checks the response of a case's run with its assertions, judge
+// returning the outcome of judge assertions, and stores the outcome with
+// the run. A run that did not complete fails.
+func evaluate(result *caseResult, judge func(i int) eval.Result) {
+	r := result.Run
+	if r.Status == db.RunStatusCompleted {
+		result.Results = eval.Check(result.Case.Assert, r.Response, judge)
+		result.Passed = !slices.ContainsFunc(result.Results, func(res eval.Result) bool { return !res.Passed })
+	}
+	if r.ID == 0 {
+		return
+	}
+	assertions, _ := json.Marshal(result.Results)
+	err := db.CreateEvalResult(&db.EvalResult{
+		RunID:      r.ID,
+		Case:       result.Case.Name,
+		Passed:     result.Passed,
+		Assertions: string(assertions),
+	})
+	if err != nil {
+		log.Warnf("failed to store result of case %s: %v", result.Case.Name, err)
+	}
+}
+
+func printResult(result caseResult) {
+	r := result.Run
+	switch {
+	case r == nil:
+		fmt.Printf("  SKIP  %s: not run\n", result.Case.Name)
+	case r.Status == db.RunStatusCancelled:
+		fmt.Printf("  SKIP  %s (run %d): cancelled\n", result.Case.Name, r.ID)
+	case r.Status != db.RunStatusCompleted:
+		fmt.Printf("  FAIL  %s (run %d): %s: %s\n", result.Case.Name, r.ID, r.Status, r.ErrorMessage)
+	case result.Passed:
+		fmt.Printf("  PASS  %s (run %d)\n", result.Case.Name, r.ID)
+	default:
+		fmt.Printf("  FAIL  %s (run %d)\n", result.Case.Name, r.ID)
+		for _, res := range result.Results {
+			if !res.Passed {
+				fmt.Printf("          %s: %s\n", res.Assertion, res.Message)
+				if res.Rationale != "" {
+					fmt.Printf("            %s\n", res.Rationale)
+				}
+			}
+		}
+	}
+}
+
+// reportCase describes the outcome of a test case for reports.
+func reportCase(result caseResult) report.Case {
+	c := report.Case{Name: result.Case.Name, Assertions: result.Results}
+	r := result.Run
+	if r == nil {
+		c.Status = report.StatusSkipped
+		c.Message = "not run"
+		return c
+	}
+	c.RunID = r.ID
+	c.RunStatus = r.Status
+	c.Duration = r.Duration.Seconds()
+	switch {
+	case r.Status == db.RunStatusCancelled:
+		c.Status = report.StatusSkipped
+		c.Message = "cancelled"
+	case r.Status != db.RunStatusCompleted:
+		c.Status = report.StatusFailed
+		c.Message = fmt.Sprintf("%s: %s", r.Status, r.ErrorMessage)
+	case result.Passed:
+		c.Status = report.StatusPassed
+	default:
+		c.Status = report.StatusFailed
+		failed := 0
+		for _, res := range result.Results {
+			if !res.Passed {
+				failed++
+			}
+		}
+		c.Message = fmt.Sprintf("%d of %d assertion(s) failed", failed, len(result.Results))
+	}
+	return c
+}
+
+// target describes the provider and model runs are made with.
+func target(settings runner.Settings) string {
+	if settings.Options.Model == "" {
+		return settings.Provider
+	}
+	return settings.Provider + "/" + settings.Options.Model
+}
@@ -0,0 +1,191 @@
+package eval
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/cmdutil"
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/eval"
+	"github.com/farbodsalimi/promptctl/internal/templates"
+)
+
+func NewAddCmd() *cobra.Command {
+	var (
+		vars    string
+		asserts []string
+	)
+
+	evalAddCmd := &cobra.Command{
+		Use:   "add <vault>/<name> <case> --vars <vars> --assert <type>=<value>...",
+		Short: "Add a test case to a prompt's evaluation suite",
+		Long: `Add a test case to a prompt's evaluation suite, or replace the case of the
+same name. A case renders the prompt with its variables and checks the
+response with every assertion:
+
+  contains=<text>       the response contains text
+  not-contains=<text>   the response does not contain text
+  regex=<pattern>       the response matches a regular expression
+  json                  the response is valid JSON
+  json-schema=<schema>  the response is JSON matching a JSON Schema, given
+                        inline or as @file; schemas may use type, enum,
+                        const, properties, required, additionalProperties,
+                        items, min/maxItems, min/maxLength, pattern,
+                        (exclusive) minimum and maximum, allOf, anyOf and
+                        oneOf, and other keywords are rejected
+  max-length=<n>        the response is at most n characters long
+  range=<min>..<max>    the response is a number within the range; either
+                        bound may be left out
+  judge=<vault>/<grader>[@<version>],min=<score>[,provider=<p>][,model=<m>][,criteria=<text>]
+                        a grader prompt scores the response at least min
+
+A grader prompt is rendered with the response as {{.response}}, the input
+it answered as {{.input}}, the criteria as {{.criteria}} and the case's
+variables as {{.vars}}. It must respond with a JSON object such as
+{"score": 0.8, "rationale": "Polite but too long"}, on any scale.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			vaultName, promptName, err := cmdutil.PromptArgs(args[:1])
+			if err != nil {
+				log.Fatal(err)
+			}
+			varsMap, err := templates.ParseVars(vars)
+			if err != nil {
+				log.Fatalf("failed to parse variables: %v", err)
+			}
+			c := eval.Case{Name: args[1], Vars: varsMap}
+			for _, spec := range asserts {
+				a, err := eval.ParseAssertion(spec)
+				if err != nil {
+					log.Fatal(err)
+				}
+				c.Assert = append(c.Assert, a)
+			}
+			if len(c.Assert) == 0 {
+				log.Fatal("at least one --assert is required")
+			}
+
+			saveCase(vaultName, promptName, c)
+			fmt.Printf("Saved case '%s' of %s/%s with %d assertion(s)\n", c.Name, vaultName, promptName, len(c.Assert))
+		},
+	}
+
+	evalAddCmd.Flags().StringVar(&vars, "vars", "", "Template variables as JSON object or key=value pairs")
+	evalAddCmd.Flags().StringArrayVarP(&asserts, "assert", "a", nil, "Assertion as <type>=<value>; repeat for several")
+
+	return evalAddCmd
+}
+
+func NewImportCmd() *cobra.Command {
+	evalImportCmd := &cobra.Command{
+		Use:   "import <vault>/<name> <file>",
+		Short: "Add the test cases of a suite file to a prompt's evaluation suite",
+		Long: `Add the test cases of a suite file to a prompt's evaluation suite,
+replacing cases of the same name. A .json file holds a list of cases and a
+.jsonl file one case per line, each written as:
+
+  {"name": "greeting", "vars": {"name": "Ann"},
+   "assert": [{"type": "contains", "value": "Ann"},
+              {"type": "max-length", "max": 200},
+              {"type": "range", "min": 1, "max": 5},
+              {"type": "json-schema", "schema": {"type": "object"}}]}`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			vaultName, promptName, err := cmdutil.PromptArgs(args[:1])
+			if err != nil {
+				log.Fatal(err)
+			}
+			cases, err := eval.ReadSuite(args[1])
+			if err != nil {
+				log.Fatalf("failed to read suite: %v", err)
+			}
+			for _, c := range cases {
+				saveCase(vaultName, promptName, c)
+			}
+			fmt.Printf("Imported %d case(s) into %s/%s\n", len(cases), vaultName, promptName)
+		},
+	}
+	return evalImportCmd
+}
+
+func NewListCmd() *cobra.Command {
+	evalListCmd := &cobra.Command{
+		Use:   "list <vault>/<name>",
+		Short: "List the test cases of a prompt's evaluation suite",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			vaultName, promptName, err := cmdutil.PromptArgs(args)
+			if err != nil {
+				log.Fatal(err)
+			}
+			cases, err := cmdutil.LoadCases(vaultName, promptName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(cases) == 0 {
+				fmt.Printf("Prompt %s/%s has no test cases\n", vaultName, promptName)
+				return
+			}
+			fmt.Printf("Test cases of %s/%s:\n", vaultName, promptName)
+			for _, c := range cases {
+				vars, _ := json.Marshal(c.Vars)
+				fmt.Printf("  %s %s\n", c.Name, vars)
+				for _, a := range c.Assert {
+					fmt.Printf("    - %s\n", a)
+				}
+			}
+		},
+	}
+	return evalListCmd
+}
+
+func NewRemoveCmd() *cobra.Command {
+	evalRemoveCmd := &cobra.Command{
+		Use:   "remove <vault>/<name> <case>",
+		Short: "Remove a test case from a prompt's evaluation suite",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			vaultName, promptName, err := cmdutil.PromptArgs(args[:1])
+			if err != nil {
+				log.Fatal(err)
+			}
+			n, err := db.DeleteEvalCase(vaultName, promptName, args[1])
+			if err != nil {
+				log.Fatalf("failed to remove case: %v", err)
+			}
+			if n == 0 {
+				log.Fatalf("case not found: %s", args[1])
+			}
+			fmt.Printf("Removed case '%s' of %s/%s\n", args[1], vaultName, promptName)
+		},
+	}
+	return evalRemoveCmd
+}
+
+func saveCase(vaultName, promptName string, c eval.Case) {
+	if strings.TrimSpace(c.Name) != c.Name || c.Name == "" {
+		log.Fatalf("invalid case name %q", c.Name)
+	}
+	if c.Vars == nil {
+		c.Vars = map[string]any{}
+	}
+	vars, _ := json.Marshal(c.Vars)
+	assertions, _ := json.Marshal(c.Assert)
+	err := db.SaveEvalCase(vaultName, promptName, &db.EvalCase{
+		Name:       c.Name,
+		Vars:       string(vars),
+		Assertions: string(assertions),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Fatalf("prompt not found: %s/%s", vaultName, promptName)
+	}
+	if err != nil {
+		log.Fatalf("failed to save case %s: %v", c.Name, err)
+	}
+}
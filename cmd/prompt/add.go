@@ -13,19 +13,25 @@ func NewAddCmd() *cobra.Command {
 		vaultName  string
 		promptName string
 		content    string
+		messages   []string
 	)
 
 	promptAddCmd := &cobra.Command{
-		Use:   "add --vault=<vault> --name=<name> --prompt=<prompt>",
+		Use:   "add --vault=<vault> --name=<name> (--prompt=<prompt> | --message=<role:content>...)",
 		Short: "Add a new prompt to a vault",
 		Run: func(cmd *cobra.Command, args []string) {
+			body, format, err := promptContent(content, messages)
+			if err != nil {
+				log.Fatalf("invalid prompt: %v", err)
+			}
+
 			// Get vault
 			vault, err := db.GetVaultByName(vaultName)
 			if err != nil {
 				log.Fatalf("vault not found: %s", vaultName)
 			}
 
-			if err := db.CreatePrompt(vault.ID, promptName, content); err != nil {
+			if err := db.CreatePrompt(vault.ID, promptName, body, format); err != nil {
 				log.Fatalf("failed to create prompt: %v", err)
 			}
 
@@ -39,10 +45,11 @@ func NewAddCmd() *cobra.Command {
 		StringVarP(&promptName, "name", "n", "", "Name for the new prompt (must be unique within vault)")
 	promptAddCmd.Flags().
 		StringVarP(&content, "prompt", "p", "", "Prompt content (supports Go template syntax)")
+	promptAddCmd.Flags().
+		StringArrayVarP(&messages, "message", "m", nil, "Chat message as role:content (system, user or assistant); repeat in conversation order")
 
 	promptAddCmd.MarkFlagRequired("vault")
 	promptAddCmd.MarkFlagRequired("name")
-	promptAddCmd.MarkFlagRequired("prompt")
 
 	return promptAddCmd
 }
@@ -0,0 +1,100 @@
+package prompt
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewChainCmd() *cobra.Command {
+	var (
+		vaultName  string
+		promptName string
+		timeout    string
+		clear      bool
+	)
+
+	var promptChainCmd = &cobra.Command{
+		Use:   "chain --vault=<vault> --name=<name> [provider/model...]",
+		Short: "Show or set a prompt's fallback chain",
+		Long: `Show or set the fallback chain stored with a prompt.
+
+Hops are tried in order until one answers, each written provider/model, for
+example anthropic/claude-sonnet-4-5 openai/gpt-4o. 'run prompt' uses the
+chain with --provider chain, or when no provider is given.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if clear {
+				if len(args) > 0 {
+					log.Fatal("--clear takes no hops")
+				}
+				setChain(vaultName, promptName, "")
+				fmt.Printf("Fallback chain of '%s' in vault '%s' removed\n", promptName, vaultName)
+				return
+			}
+
+			if len(args) == 0 {
+				data, err := db.GetPromptChain(vaultName, promptName)
+				if errors.Is(err, sql.ErrNoRows) {
+					log.Fatalf("prompt not found: %s/%s", vaultName, promptName)
+				}
+				if err != nil {
+					log.Fatalf("failed to get fallback chain: %v", err)
+				}
+				if data == "" {
+					fmt.Printf("Prompt '%s' in vault '%s' has no fallback chain\n", promptName, vaultName)
+					return
+				}
+				var chain providers.Chain
+				if err := json.Unmarshal([]byte(data), &chain); err != nil {
+					log.Fatalf("invalid fallback chain: %v", err)
+				}
+				fmt.Printf("Fallback chain of '%s' in vault '%s':\n", promptName, vaultName)
+				for i, hop := range chain.Hops {
+					fmt.Printf("  %d. %s\n", i+1, hop)
+				}
+				if chain.Timeout != "" {
+					fmt.Printf("  Timeout per hop: %s\n", chain.Timeout)
+				}
+				return
+			}
+
+			chain := providers.Chain{Hops: args, Timeout: timeout}
+			if _, _, err := chain.Parse(); err != nil {
+				log.Fatal(err)
+			}
+			data, err := json.Marshal(chain)
+			if err != nil {
+				log.Fatalf("failed to encode fallback chain: %v", err)
+			}
+			setChain(vaultName, promptName, string(data))
+			fmt.Printf("Fallback chain of '%s' in vault '%s' set: %s\n", promptName, vaultName, strings.Join(args, " -> "))
+		},
+	}
+
+	promptChainCmd.Flags().StringVarP(&vaultName, "vault", "v", "", "Vault")
+	promptChainCmd.Flags().StringVarP(&promptName, "name", "n", "", "Name")
+	promptChainCmd.Flags().StringVar(&timeout, "timeout", "", "Time each hop gets before the next is tried (e.g. 30s)")
+	promptChainCmd.Flags().BoolVar(&clear, "clear", false, "Remove the prompt's fallback chain")
+
+	promptChainCmd.MarkFlagRequired("vault")
+	promptChainCmd.MarkFlagRequired("name")
+
+	return promptChainCmd
+}
+
+func setChain(vaultName, promptName, chain string) {
+	err := db.SetPromptChain(vaultName, promptName, chain)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Fatalf("prompt not found: %s/%s", vaultName, promptName)
+	}
+	if err != nil {
+		log.Fatalf("failed to set fallback chain: %v", err)
+	}
+}
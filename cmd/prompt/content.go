@@ -0,0 +1,44 @@
+package prompt
+
+import (
+	"fmt"
+
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/templates"
+)
+
+// promptContent builds the stored content and format from either a plain
+// --prompt template or a list of --message role:content templates.
+func promptContent(text string, messageFlags []string) (string, string, error) {
+	if len(messageFlags) == 0 {
+		if text == "" {
+			return "", "", fmt.Errorf("either --prompt or --message is required")
+		}
+		return text, db.FormatText, nil
+	}
+	if text != "" {
+		return "", "", fmt.Errorf("--prompt and --message cannot be used together")
+	}
+
+	messages, err := templates.ParseMessageFlags(messageFlags)
+	if err != nil {
+		return "", "", err
+	}
+	content, err := templates.EncodeMessages(messages)
+	if err != nil {
+		return "", "", err
+	}
+	return content, db.FormatChat, nil
+}
+
+// formatContent returns the display form of a stored prompt version.
+func formatContent(pv *db.PromptVersion) (string, error) {
+	if pv.Format != db.FormatChat {
+		return pv.Content, nil
+	}
+	messages, err := templates.ParseMessages(pv.Content)
+	if err != nil {
+		return "", err
+	}
+	return templates.FormatMessages(messages), nil
+}
@@ -0,0 +1,83 @@
+package prompt
+
+import (
+	"fmt"
+
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+	"github.com/farbodsalimi/promptctl/internal/runner"
+	"github.com/farbodsalimi/promptctl/internal/templates"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewRenderCmd() *cobra.Command {
+	var (
+		vaultName  string
+		promptName string
+		revision   int
+		vars       string
+		hash       bool
+	)
+
+	var promptRenderCmd = &cobra.Command{
+		Use:   "render --vault=<vault> --prompt=<prompt> --vars=<vars>",
+		Short: "Render a prompt with variables without running it",
+		Long: `Render a prompt with variables without running it. --hash prints only the
+hash of the rendered messages instead, the key of the prompt's response in
+a mock fixtures file (see 'promptctl config set mock.fixtures').`,
+		Run: func(cmd *cobra.Command, args []string) {
+			varsMap, err := templates.ParseVars(vars)
+			if err != nil {
+				log.Fatalf("failed to parse variables: %v", err)
+			}
+
+			pv, err := db.GetPromptVersion(vaultName, promptName, revision)
+			if err != nil {
+				log.Fatalf("failed to get prompt content: %v", err)
+			}
+
+			if hash {
+				messages, err := runner.Render(pv, varsMap)
+				if err != nil {
+					log.Fatalf("failed to render template: %v", err)
+				}
+				fmt.Println(providers.PromptHash(messages))
+				return
+			}
+
+			var rendered string
+			if pv.Format == db.FormatChat {
+				messages, err := templates.RenderChat(pv.Content, varsMap)
+				if err != nil {
+					log.Fatalf("failed to render template: %v", err)
+				}
+				rendered = templates.FormatMessages(messages)
+			} else {
+				rendered, err = templates.RenderTemplate(pv.Content, varsMap)
+				if err != nil {
+					log.Fatalf("failed to render template: %v", err)
+				}
+			}
+
+			fmt.Printf("Prompt '%s' in vault '%s' (v%d, %s):\n", promptName, vaultName, pv.Version, pv.Format)
+			fmt.Printf("---\n%s\n---\n", rendered)
+		},
+	}
+
+	promptRenderCmd.Flags().
+		StringVarP(&vaultName, "vault", "v", "", "Name of the vault containing the prompt")
+	promptRenderCmd.Flags().
+		StringVarP(&promptName, "prompt", "p", "", "Name of the prompt to render")
+	promptRenderCmd.Flags().
+		IntVarP(&revision, "revision", "r", 0, "Specific revision number to render (default: latest revision)")
+	promptRenderCmd.Flags().
+		StringVarP(&vars, "vars", "", "", "Template variables as JSON object or key=value pairs")
+	promptRenderCmd.Flags().
+		BoolVar(&hash, "hash", false, "Print only the hash of the rendered prompt, as used by mock fixtures")
+
+	promptRenderCmd.MarkFlagRequired("vault")
+	promptRenderCmd.MarkFlagRequired("prompt")
+
+	return promptRenderCmd
+}
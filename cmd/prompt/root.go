@@ -16,6 +16,8 @@ func NewRootCmd() *cobra.Command {
 	promptCmd.AddCommand(NewListCmd())
 	promptCmd.AddCommand(NewHistoryCmd())
 	promptCmd.AddCommand(NewShowCmd())
+	promptCmd.AddCommand(NewRenderCmd())
+	promptCmd.AddCommand(NewChainCmd())
 
 	return promptCmd
 }
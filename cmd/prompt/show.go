@@ -20,21 +20,14 @@ func NewShowCmd() *cobra.Command {
 		Use:   "show --vault=<vault> --prompt=<prompt>",
 		Short: "Show prompt content",
 		Run: func(cmd *cobra.Command, args []string) {
-			var content string
-			var err error
-
-			if revision > 0 {
-				content, err = db.GetPromptVersionContentByVersion(vaultName, promptName, revision)
-			} else {
-				prompt, err2 := db.GetPromptByName(vaultName, promptName)
-				if err2 != nil {
-					log.Fatalf("prompt not found: %s/%s", vaultName, promptName)
-				}
-				content, err = db.GetPromptContent(prompt.ID)
+			pv, err := db.GetPromptVersion(vaultName, promptName, revision)
+			if err != nil {
+				log.Fatalf("failed to get prompt content: %v", err)
 			}
 
+			content, err := formatContent(pv)
 			if err != nil {
-				log.Fatalf("failed to get prompt content: %v", err)
+				log.Fatalf("failed to parse prompt messages: %v", err)
 			}
 
 			versionStr := "latest"
@@ -42,7 +35,7 @@ func NewShowCmd() *cobra.Command {
 				versionStr = "v" + strconv.Itoa(revision)
 			}
 
-			fmt.Printf("Prompt '%s' in vault '%s' (%s):\n", promptName, vaultName, versionStr)
+			fmt.Printf("Prompt '%s' in vault '%s' (%s, %s):\n", promptName, vaultName, versionStr, pv.Format)
 			fmt.Printf("---\n%s\n---\n", content)
 		},
 	}
@@ -13,6 +13,7 @@ func NewUpdateCmd() *cobra.Command {
 		vaultName  string
 		promptName string
 		content    string
+		messages   []string
 	)
 
 	var promptUpdateCmd = &cobra.Command{
@@ -20,7 +21,12 @@ func NewUpdateCmd() *cobra.Command {
 		Short: "Update an existing prompt (creates new version)",
 
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := db.UpdatePrompt(vaultName, promptName, content); err != nil {
+			body, format, err := promptContent(content, messages)
+			if err != nil {
+				log.Fatalf("invalid prompt: %v", err)
+			}
+
+			if err := db.UpdatePrompt(vaultName, promptName, body, format); err != nil {
 				log.Fatalf("failed to update prompt: %v", err)
 			}
 
@@ -31,10 +37,10 @@ func NewUpdateCmd() *cobra.Command {
 	promptUpdateCmd.Flags().StringVarP(&vaultName, "vault", "v", "", "Vault")
 	promptUpdateCmd.Flags().StringVarP(&promptName, "name", "n", "", "Name")
 	promptUpdateCmd.Flags().StringVarP(&content, "prompt", "p", "", "Prompt")
+	promptUpdateCmd.Flags().StringArrayVarP(&messages, "message", "m", nil, "Chat message as role:content")
 
 	promptUpdateCmd.MarkFlagRequired("vault")
 	promptUpdateCmd.MarkFlagRequired("name")
-	promptUpdateCmd.MarkFlagRequired("prompt")
 
 	return promptUpdateCmd
 }
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package provider
+
+import "os/exec"
+
+// detach is a no-op where processes have no sessions.
+func detach(cmd *exec.Cmd) {}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package provider
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts cmd in a session of its own, so the agent outlives the
+// terminal and process group that ran unlock.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
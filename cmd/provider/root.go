@@ -1,10 +1,14 @@
 package provider
 
 import (
-	"encoding/json"
+	"bufio"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
-	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -13,14 +17,70 @@ import (
 )
 
 var providerAddCmd = &cobra.Command{
-	Use:   "add <name> <api_key>",
-	Short: "Add or update a provider API key",
-	Args:  cobra.ExactArgs(2),
+	Use:   "add <name> [api_key]",
+	Short: "Add or update a provider",
+	Long: `Add or update a provider.
+
+Built-in providers (openai, anthropic, google) need an API key. To keep the
+key out of shell history, pass "-" to read it from standard input, or point
+at a key file or a command that prints it:
+
+  promptctl provider add openai -
+  promptctl provider add anthropic --key-file ~/.secrets/anthropic
+  promptctl provider add google --key-command "pass show google/api-key"
+
+Keys given directly are kept in an encrypted credential store, never in
+config.json; the first key added creates the store and asks for a
+passphrase. Keys in OPENAI_API_KEY, ANTHROPIC_API_KEY and GOOGLE_API_KEY (or
+GEMINI_API_KEY) take precedence over the configured source.
+
+Any number of custom providers can be registered under their own name, for
+example a local Ollama server:
+
+  promptctl provider add ollama --type openai-compatible --base-url http://localhost:11434/v1
+
+A provider can also hold named accounts, added as <provider>:<account> and
+selected with 'run prompt --account'. With a rotation policy, requests
+that are rate limited are retried on the provider's other accounts:
+
+  promptctl provider add openai:team-a -
+  promptctl provider add openai:team-b --key-file ~/.secrets/team-b
+  promptctl provider add openai --rotation round-robin`,
+	Args: cobra.RangeArgs(1, 2),
 	Run: func(cmd *cobra.Command, args []string) {
 		providerName := args[0]
-		apiKey := args[1]
+		providerType, _ := cmd.Flags().GetString("type")
+		baseURL, _ := cmd.Flags().GetString("base-url")
+
+		creds, err := credentialsFromFlags(cmd, args)
+		if err != nil {
+			log.Fatalf("failed to add provider: %v", err)
+		}
 
-		if err := updateProviderConfig(providerName, apiKey); err != nil {
+		var rotation *string
+		if cmd.Flags().Changed("rotation") {
+			value, _ := cmd.Flags().GetString("rotation")
+			rotation = &value
+		}
+
+		base, account := providers.SplitAccountName(providerName)
+		switch {
+		case base == providers.MockProvider:
+			err = errMockProvider("add")
+		case account != "":
+			if providerType != "" || rotation != nil {
+				log.Fatal("--type and --rotation apply to the provider, not to one of its accounts")
+			}
+			err = addAccount(providerName, creds)
+		case providerType == "":
+			if creds == (providers.Credentials{}) && rotation == nil {
+				log.Fatal("an api key, --key-file or --key-command is required for built-in providers")
+			}
+			err = updateProviderConfig(providerName, creds, rotation)
+		default:
+			err = addCustomProvider(providerName, providerType, baseURL, creds, rotation)
+		}
+		if err != nil {
 			log.Fatalf("failed to add provider: %v", err)
 		}
 
@@ -30,7 +90,7 @@ var providerAddCmd = &cobra.Command{
 
 var providerListCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List configured providers",
+	Short: "List configured providers and where their keys come from",
 	Run: func(cmd *cobra.Command, args []string) {
 		config, err := providers.LoadConfig()
 		if err != nil {
@@ -38,15 +98,119 @@ var providerListCmd = &cobra.Command{
 		}
 
 		fmt.Println("Configured providers:")
-		if config.OpenAI.APIKey != "" {
-			fmt.Printf("  openai: %s\n", maskAPIKey(config.OpenAI.APIKey))
+		for _, name := range []string{"openai", "anthropic", "google"} {
+			pool := config.Pool(name)
+			settings := config.Settings(name)
+			configured := len(pool.Accounts) > 0 || len(settings.List()) > 0 || len(settings.StoredHeaders) > 0
+			if source := config.KeySource(name); source != "" {
+				fmt.Printf("  %s: key from %s\n", name, source)
+			} else if configured {
+				fmt.Printf("  %s: no default key\n", name)
+			}
+			printSettings(config, name)
+			printAccounts(config, name)
+		}
+
+		fmt.Println("  mock: built in, no api key required")
+
+		names := make([]string, 0, len(config.Custom))
+		for name := range config.Custom {
+			names = append(names, name)
 		}
-		if config.Anthropic.APIKey != "" {
-			fmt.Printf("  anthropic: %s\n", maskAPIKey(config.Anthropic.APIKey))
+		sort.Strings(names)
+		for _, name := range names {
+			custom := config.Custom[name]
+			key := "no api key"
+			if source := config.KeySource(name); source != "" {
+				key = "key from " + source
+			}
+			fmt.Printf("  %s (%s, %s): %s\n", name, custom.Type, custom.BaseURL, key)
+			printSettings(config, name)
+			printAccounts(config, name)
 		}
-		if config.Google.APIKey != "" {
-			fmt.Printf("  google: %s\n", maskAPIKey(config.Google.APIKey))
+	},
+}
+
+// printSettings lists a provider's connection settings. Header values may
+// hold secrets and are not shown.
+func printSettings(config *providers.Config, provider string) {
+	settings := config.Settings(provider)
+	for _, setting := range settings.List() {
+		key, value := setting[0], setting[1]
+		if strings.HasPrefix(key, "header.") {
+			value = "(set)"
+		}
+		if key == "base_url" && config.Custom[provider] != nil {
+			continue
+		}
+		fmt.Printf("    %s: %s\n", key, value)
+	}
+	for _, name := range settings.StoredHeaders {
+		fmt.Printf("    header.%s: (encrypted store)\n", name)
+	}
+}
+
+// printAccounts lists a provider's rotation policy and named accounts.
+func printAccounts(config *providers.Config, provider string) {
+	pool := config.Pool(provider)
+	if len(pool.Accounts) == 0 {
+		return
+	}
+	if pool.Rotation != providers.RotationNone {
+		fmt.Printf("    rotation: %s\n", pool.Rotation)
+	}
+	for _, account := range pool.AccountNames() {
+		key := "no api key"
+		if source := config.KeySource(providers.AccountName(provider, account)); source != "" {
+			key = "key from " + source
+		}
+		fmt.Printf("    %s: %s\n", providers.AccountName(provider, account), key)
+	}
+}
+
+var providerSetCmd = &cobra.Command{
+	Use:   "set <name> <key> <value>",
+	Short: "Change how a provider's API is reached",
+	Long: `Change a connection setting of a built-in or custom provider. An empty
+value restores the default.
+
+Settings:
+  base_url      API endpoint, for example an internal gateway
+  organization  OpenAI organisation ID (OpenAI-style providers only)
+  project       OpenAI project ID (OpenAI-style providers only)
+  stream_usage  Ask for the token usage of streamed responses; set to
+                false for servers that reject it (OpenAI-style providers
+                only, default true)
+  timeout       Request timeout including streaming, e.g. 90s or 5m
+  proxy         HTTP proxy URL (default: HTTPS_PROXY from the environment)
+  ca_bundle     PEM file of extra certificate authorities to trust
+  header.<Name> Header added to every request. Secret ones, whose name
+                contains auth, key, token, secret, password, cookie or
+                signature, are kept in the encrypted credential store
+                once it exists; pass "-" to read the value from stdin
+
+Retries and rate limiting:
+  max_retries          Retries after rate limit, server or network errors (default 2)
+  retry_backoff        Delay before the first retry, doubled after each (default 500ms)
+  max_retry_backoff    Longest delay between retries (default 30s)
+  requests_per_minute  Client-side rate limit (default none)
+  burst                Requests allowed at once under the rate limit (default 1)
+
+Examples:
+  promptctl provider set openai proxy http://proxy.corp.example:3128
+  promptctl provider set openai organization org-123
+  promptctl provider set anthropic timeout 5m
+  promptctl provider set anthropic max_retries 5
+  promptctl provider set google header.X-Gateway-Key -`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		providerName, key, value := args[0], args[1], args[2]
+
+		if err := setProviderSetting(providerName, key, value); err != nil {
+			log.Fatalf("failed to set %s: %v", key, err)
 		}
+
+		fmt.Printf("Updated provider %s: %s\n", providerName, key)
 	},
 }
 
@@ -57,7 +221,19 @@ var providerDeleteCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		providerName := args[0]
 
-		if err := updateProviderConfig(providerName, ""); err != nil {
+		var err error
+		base, account := providers.SplitAccountName(providerName)
+		switch {
+		case base == providers.MockProvider:
+			err = errMockProvider("delete")
+		case account != "":
+			err = deleteAccount(providerName)
+		case providers.IsBuiltinProvider(providerName):
+			err = deleteBuiltinProvider(providerName)
+		default:
+			err = deleteCustomProvider(providerName)
+		}
+		if err != nil {
 			log.Fatalf("failed to delete provider: %v", err)
 		}
 
@@ -65,7 +241,125 @@ var providerDeleteCmd = &cobra.Command{
 	},
 }
 
-func updateProviderConfig(providerName, apiKey string) error {
+// errMockProvider explains why a provider command does not apply to the
+// offline mock provider.
+func errMockProvider(command string) error {
+	return fmt.Errorf(
+		"mock is built in and needs no api key; instead of 'provider %s', configure it with 'promptctl config set mock.<key>'",
+		command,
+	)
+}
+
+// credentialsFromFlags reads the key source given on the command line. An
+// API key of "-" is read from standard input.
+func credentialsFromFlags(cmd *cobra.Command, args []string) (providers.Credentials, error) {
+	var creds providers.Credentials
+	creds.APIKey, _ = cmd.Flags().GetString("api-key")
+	creds.KeyFile, _ = cmd.Flags().GetString("key-file")
+	creds.KeyCommand, _ = cmd.Flags().GetString("key-command")
+	if len(args) == 2 {
+		creds.APIKey = args[1]
+	}
+
+	sources := 0
+	for _, source := range []string{creds.APIKey, creds.KeyFile, creds.KeyCommand} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return creds, fmt.Errorf("only one of an api key, --key-file or --key-command may be given")
+	}
+
+	if creds.APIKey == "-" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return creds, fmt.Errorf("failed to read api key: %w", err)
+		}
+		creds.APIKey = strings.TrimSpace(line)
+		if creds.APIKey == "" {
+			return creds, fmt.Errorf("no api key on standard input")
+		}
+	}
+
+	return creds, nil
+}
+
+func setProviderSetting(providerName, key, value string) error {
+	config, err := providers.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if providerName == providers.MockProvider {
+		return errMockProvider("set")
+	}
+	settings := config.Settings(providerName)
+	if settings == nil {
+		return fmt.Errorf("provider not found: %s", providerName)
+	}
+	custom, isCustom := config.Custom[providerName]
+	switch {
+	case (key == "organization" || key == "project" || key == "stream_usage") && providerName != "openai" && !isCustom:
+		return fmt.Errorf("%s is only supported by OpenAI-style providers", key)
+	case key == "base_url" && isCustom && value == "":
+		return fmt.Errorf("base_url is required for %s providers", custom.Type)
+	}
+
+	// Header values are often gateway keys; "-" reads one from standard
+	// input to keep it out of shell history.
+	if value == "-" && strings.HasPrefix(key, "header.") {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read value: %w", err)
+		}
+		value = strings.TrimSpace(line)
+	}
+
+	if err := settings.Set(key, value); err != nil {
+		return err
+	}
+	return providers.SaveConfig(config)
+}
+
+// updateProviderConfig sets a built-in provider's default credentials, when
+// given, and its rotation policy, when not nil.
+func updateProviderConfig(providerName string, creds providers.Credentials, rotation *string) error {
+	config, err := providers.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	var current *providers.Credentials
+	switch providerName {
+	case "openai":
+		current = &config.OpenAI.Credentials
+	case "anthropic":
+		current = &config.Anthropic.Credentials
+	case "google":
+		current = &config.Google.Credentials
+	default:
+		return fmt.Errorf(
+			"unsupported provider: %s (supported: openai, anthropic, google)",
+			providerName,
+		)
+	}
+	if creds != (providers.Credentials{}) {
+		*current = creds
+		if creds.APIKey == "" {
+			config.ForgetAPIKey(providerName)
+		}
+	}
+	if rotation != nil {
+		if err := setRotation(config.Pool(providerName), *rotation); err != nil {
+			return err
+		}
+	}
+
+	return providers.SaveConfig(config)
+}
+
+func deleteBuiltinProvider(providerName string) error {
 	config, err := providers.LoadConfig()
 	if err != nil {
 		return err
@@ -73,59 +367,192 @@ func updateProviderConfig(providerName, apiKey string) error {
 
 	switch providerName {
 	case "openai":
-		config.OpenAI.APIKey = apiKey
+		config.OpenAI = providers.OpenAIConfig{}
 	case "anthropic":
-		config.Anthropic.APIKey = apiKey
+		config.Anthropic = providers.AnthropicConfig{}
 	case "google":
-		config.Google.APIKey = apiKey
+		config.Google = providers.GoogleConfig{}
 	default:
 		return fmt.Errorf(
 			"unsupported provider: %s (supported: openai, anthropic, google)",
 			providerName,
 		)
 	}
+	config.ForgetAPIKey(providerName)
+	forgetAccounts(config, providerName)
+
+	return providers.SaveConfig(config)
+}
+
+func setRotation(pool *providers.AccountPool, rotation string) error {
+	if !providers.IsValidRotation(rotation) {
+		return fmt.Errorf(
+			"unsupported rotation: %s (supported: %s)",
+			rotation,
+			strings.Join(providers.Rotations, ", "),
+		)
+	}
+	pool.Rotation = rotation
+	return nil
+}
+
+// forgetAccounts removes the stored keys of all of a provider's accounts,
+// before the provider itself is removed from the config.
+func forgetAccounts(config *providers.Config, providerName string) {
+	pool := config.Pool(providerName)
+	if pool == nil {
+		return
+	}
+	for _, account := range pool.AccountNames() {
+		config.ForgetAPIKey(providers.AccountName(providerName, account))
+	}
+}
+
+// addAccount adds or updates a named account, given as
+// "provider:account", of a built-in or custom provider.
+func addAccount(name string, creds providers.Credentials) error {
+	providerName, account := providers.SplitAccountName(name)
+	if account == providers.DefaultAccount {
+		return fmt.Errorf("%q is reserved for the provider's own key; use 'provider add %s'", account, providerName)
+	}
+	if creds == (providers.Credentials{}) {
+		return fmt.Errorf("an api key, --key-file or --key-command is required for an account")
+	}
+
+	config, err := providers.LoadConfig()
+	if err != nil {
+		return err
+	}
 
-	return saveConfig(config)
+	pool := config.Pool(providerName)
+	if pool == nil {
+		return fmt.Errorf("provider not found: %s", providerName)
+	}
+	if pool.Accounts == nil {
+		pool.Accounts = make(map[string]*providers.Credentials)
+	}
+	pool.Accounts[account] = &creds
+	if creds.APIKey == "" {
+		config.ForgetAPIKey(name)
+	}
+
+	return providers.SaveConfig(config)
 }
 
-func saveConfig(config *providers.Config) error {
-	homeDir, err := os.UserHomeDir()
+func deleteAccount(name string) error {
+	providerName, account := providers.SplitAccountName(name)
+
+	config, err := providers.LoadConfig()
 	if err != nil {
 		return err
 	}
 
-	configPath := filepath.Join(homeDir, ".promptctl", "config.json")
-	configDir := filepath.Dir(configPath)
+	pool := config.Pool(providerName)
+	if pool == nil {
+		return fmt.Errorf("provider not found: %s", providerName)
+	}
+	if _, ok := pool.Accounts[account]; !ok {
+		return fmt.Errorf("account not found: %s", name)
+	}
+	delete(pool.Accounts, account)
+	config.ForgetAPIKey(name)
+
+	return providers.SaveConfig(config)
+}
 
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+func addCustomProvider(providerName, providerType, baseURL string, creds providers.Credentials, rotation *string) error {
+	if providers.IsBuiltinProvider(providerName) {
+		return fmt.Errorf("%s is a built-in provider and cannot have a type", providerName)
+	}
+	if err := providers.ValidateCustomName(providerName); err != nil {
 		return err
 	}
+	if providerType != providers.TypeOpenAICompatible {
+		return fmt.Errorf(
+			"unsupported provider type: %s (supported: %s)",
+			providerType,
+			providers.TypeOpenAICompatible,
+		)
+	}
+	if baseURL == "" {
+		return fmt.Errorf("--base-url is required for %s providers", providerType)
+	}
+	if u, err := url.Parse(baseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid base URL: %s", baseURL)
+	}
 
-	data, err := json.MarshalIndent(config, "", "  ")
+	config, err := providers.LoadConfig()
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(configPath, data, 0600)
+	if config.Custom == nil {
+		config.Custom = make(map[string]*providers.CustomProviderConfig)
+	}
+	custom := &providers.CustomProviderConfig{
+		Type:        providerType,
+		Credentials: creds,
+	}
+	// Keep the accounts and settings of a provider being updated.
+	if existing, ok := config.Custom[providerName]; ok {
+		custom.AccountPool = existing.AccountPool
+		custom.Settings = existing.Settings
+	}
+	custom.BaseURL = baseURL
+	if rotation != nil {
+		if err := setRotation(&custom.AccountPool, *rotation); err != nil {
+			return err
+		}
+	}
+	config.Custom[providerName] = custom
+	if creds.APIKey == "" {
+		config.ForgetAPIKey(providerName)
+	}
+
+	return providers.SaveConfig(config)
 }
 
-func maskAPIKey(apiKey string) string {
-	if len(apiKey) <= 8 {
-		return "***"
+func deleteCustomProvider(providerName string) error {
+	config, err := providers.LoadConfig()
+	if err != nil {
+		return err
 	}
-	return apiKey[:4] + "..." + apiKey[len(apiKey)-4:]
+
+	if _, ok := config.Custom[providerName]; !ok {
+		return fmt.Errorf("provider not found: %s", providerName)
+	}
+	forgetAccounts(config, providerName)
+	delete(config.Custom, providerName)
+	config.ForgetAPIKey(providerName)
+
+	return providers.SaveConfig(config)
 }
 
 func NewRootCmd() *cobra.Command {
 	var providerCmd = &cobra.Command{
 		Use:   "provider",
 		Short: "Manage LLM providers",
-		Long:  `Add, update, list, and delete LLM provider configurations.`,
+		Long:  `Add, update, list, and delete LLM provider configurations and manage the encrypted credential store.`,
 	}
 
 	providerCmd.AddCommand(providerAddCmd)
 	providerCmd.AddCommand(providerListCmd)
+	providerCmd.AddCommand(providerSetCmd)
 	providerCmd.AddCommand(providerDeleteCmd)
+	providerCmd.AddCommand(providerLockCmd)
+	providerCmd.AddCommand(providerUnlockCmd)
+	providerCmd.AddCommand(providerRotatePassphraseCmd)
+	providerCmd.AddCommand(providerAgentCmd)
+
+	providerAddCmd.Flags().String("type", "", "Type of a custom provider (openai-compatible)")
+	providerAddCmd.Flags().String("base-url", "", "API base URL of a custom provider (e.g., http://localhost:11434/v1)")
+	providerAddCmd.Flags().String("api-key", "", "API key, as an alternative to the positional argument (\"-\" reads standard input)")
+	providerAddCmd.Flags().String("key-file", "", "File containing the API key")
+	providerAddCmd.Flags().String("key-command", "", "Shell command that prints the API key")
+	providerAddCmd.Flags().String("rotation", "", "How to cycle the provider's accounts when rate limited (round-robin, least-recently-rate-limited; \"\" to disable)")
+
+	providerUnlockCmd.Flags().Duration("ttl", 8*time.Hour, "How long the store stays unlocked")
+	providerAgentCmd.Flags().Duration("ttl", 8*time.Hour, "How long to serve the key")
 
 	return providerCmd
 }
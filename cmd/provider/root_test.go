@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/farbodsalimi/promptctl/internal/providers"
+)
+
+// chatRequest is the part of a chat completions request the fake server
+// checks.
+type chatRequest struct {
+	Model    string `json:"model"`
+	Stream   bool   `json:"stream"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+}
+
+// newChatServer returns a fake OpenAI-compatible server that answers every
+// chat completion with "echo: " and the last message, in one response or
+// streamed in two chunks.
+func newChatServer(t *testing.T, apiKey string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer "+apiKey {
+			http.Error(w, fmt.Sprintf("unexpected authorization %q", got), http.StatusUnauthorized)
+			return
+		}
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Messages) == 0 {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		reply := "echo: " + req.Messages[len(req.Messages)-1].Content
+
+		if !req.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id":"1","object":"chat.completion","model":%q,`+
+				`"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":%q}}],`+
+				`"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`, req.Model, reply)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		half := len(reply) / 2
+		for _, delta := range []string{reply[:half], reply[half:]} {
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":%q,"+
+				"\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", req.Model, delta)
+		}
+		fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":%q,"+
+			"\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n", req.Model)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// useTempHome points the config and credential store at an empty home
+// directory.
+func useTempHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(providers.ProfileEnv, "")
+	return home
+}
+
+func TestOpenAICompatibleProvider(t *testing.T) {
+	home := useTempHome(t)
+	const apiKey = "test-key"
+	server := newChatServer(t, apiKey)
+
+	keyFile := filepath.Join(home, "key")
+	if err := os.WriteFile(keyFile, []byte(apiKey+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	creds := providers.Credentials{KeyFile: keyFile}
+	if err := addCustomProvider("local", providers.TypeOpenAICompatible, server.URL+"/v1", creds, nil); err != nil {
+		t.Fatalf("addCustomProvider: %v", err)
+	}
+
+	ctx := context.Background()
+	router, err := providers.GetProvider(ctx)
+	if err != nil {
+		t.Fatalf("GetProvider: %v", err)
+	}
+	llm, ok := router.Get("local")
+	if !ok {
+		t.Fatalf("provider local not registered (have %v)", router.ListProviders())
+	}
+	messages := []providers.Message{
+		{Role: providers.RoleSystem, Content: "Be brief."},
+		{Role: providers.RoleUser, Content: "hello"},
+	}
+	opts := providers.Options{Model: "llama3"}
+
+	t.Run("chat", func(t *testing.T) {
+		response, err := llm.Chat(ctx, messages, opts)
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+		if response.Content != "echo: hello" {
+			t.Errorf("content = %q, want %q", response.Content, "echo: hello")
+		}
+		if response.Options.Model != "llama3" {
+			t.Errorf("model = %q, want llama3", response.Options.Model)
+		}
+		if response.Usage != (providers.Usage{PromptTokens: 3, CompletionTokens: 2}) {
+			t.Errorf("usage = %+v, want 3 prompt and 2 completion tokens", response.Usage)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var deltas []string
+		response, err := llm.Stream(ctx, messages, opts, func(delta string) {
+			deltas = append(deltas, delta)
+		})
+		if err != nil {
+			t.Fatalf("Stream: %v", err)
+		}
+		if response.Content != "echo: hello" {
+			t.Errorf("content = %q, want %q", response.Content, "echo: hello")
+		}
+		if len(deltas) != 2 {
+			t.Errorf("got %d deltas %q, want 2", len(deltas), deltas)
+		}
+		if response.FinishReason != "stop" {
+			t.Errorf("finish reason = %q, want stop", response.FinishReason)
+		}
+	})
+
+	t.Run("model required", func(t *testing.T) {
+		if _, err := llm.Chat(ctx, messages, providers.Options{}); err == nil {
+			t.Error("Chat without a model succeeded")
+		}
+	})
+}
+
+func TestAddCustomProviderRejectsReservedNames(t *testing.T) {
+	useTempHome(t)
+	for _, name := range []string{"openai", "mock", "chain", "local:team", "local/llama3"} {
+		t.Run(name, func(t *testing.T) {
+			err := addCustomProvider(name, providers.TypeOpenAICompatible, "http://localhost:11434/v1", providers.Credentials{}, nil)
+			if err == nil {
+				t.Errorf("addCustomProvider(%q) succeeded", name)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsReservedCustomNames(t *testing.T) {
+	for _, name := range []string{"chain", "local:team", "local/llama3", "google"} {
+		t.Run(name, func(t *testing.T) {
+			config := &providers.Config{Custom: map[string]*providers.CustomProviderConfig{
+				name: {Type: providers.TypeOpenAICompatible, Settings: providers.Settings{BaseURL: "http://localhost:11434/v1"}},
+			}}
+			if errs := config.Validate(); len(errs) == 0 {
+				t.Errorf("Validate accepted custom provider %q", name)
+			}
+		})
+	}
+}
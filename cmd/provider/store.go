@@ -0,0 +1,195 @@
+package provider
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/credstore"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+)
+
+var providerLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Lock the credential store",
+	Long: `Lock the credential store: move any plaintext keys and secret headers left
+in config.json into it and make the unlock agent forget its key.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := providers.LoadConfig()
+		if err != nil {
+			log.Fatalf("failed to load config: %v", err)
+		}
+		if err := providers.SaveConfig(config); err != nil {
+			log.Fatalf("failed to move keys into credential store: %v", err)
+		}
+
+		socketPath, err := credstore.AgentSocketPath()
+		if err != nil {
+			log.Fatalf("failed to locate agent: %v", err)
+		}
+		if err := credstore.StopAgent(socketPath); err != nil {
+			log.Fatalf("failed to stop agent: %v", err)
+		}
+
+		fmt.Println("Credential store locked")
+	},
+}
+
+var providerUnlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Unlock the credential store for a while",
+	Long: `Unlock the credential store and start a background agent that holds the
+decrypted data key, so later commands do not ask for the passphrase.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+
+		store := openStore()
+		passphrase, err := credstore.CurrentPassphrase("Credential store passphrase: ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := store.Unlock(passphrase); err != nil {
+			log.Fatalf("failed to unlock credential store: %v", err)
+		}
+		dataKey, _ := store.Key()
+
+		socketPath, err := credstore.AgentSocketPath()
+		if err != nil {
+			log.Fatalf("failed to locate agent: %v", err)
+		}
+		if err := credstore.StopAgent(socketPath); err != nil {
+			log.Fatalf("failed to stop running agent: %v", err)
+		}
+		if err := credstore.PrepareAgentDir(socketPath); err != nil {
+			log.Fatalf("failed to start agent: %v", err)
+		}
+		if err := startAgent(dataKey, ttl); err != nil {
+			log.Fatalf("failed to start agent: %v", err)
+		}
+		if err := waitForAgent(socketPath); err != nil {
+			log.Fatalf("agent did not start: %v", err)
+		}
+
+		fmt.Printf("Credential store unlocked for %s\n", ttl)
+	},
+}
+
+var providerRotatePassphraseCmd = &cobra.Command{
+	Use:   "rotate-passphrase",
+	Short: "Change the credential store passphrase",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		store := openStore()
+		passphrase, err := credstore.CurrentPassphrase("Current passphrase: ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := store.Unlock(passphrase); err != nil {
+			log.Fatalf("failed to unlock credential store: %v", err)
+		}
+
+		newPassphrase, err := credstore.NewPassphrase(credstore.NewPassphraseEnv, "New passphrase: ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := store.Rewrap(newPassphrase); err != nil {
+			log.Fatalf("failed to change passphrase: %v", err)
+		}
+		if err := store.Save(); err != nil {
+			log.Fatalf("failed to save credential store: %v", err)
+		}
+
+		fmt.Println("Passphrase changed")
+	},
+}
+
+// providerAgentCmd is started by unlock. It reads the data key from
+// standard input and serves it until the TTL expires or lock is run.
+var providerAgentCmd = &cobra.Command{
+	Use:    "agent",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+
+		encoded, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dataKey, err := base64.StdEncoding.DecodeString(string(encoded))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		socketPath, err := credstore.AgentSocketPath()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Outlive the terminal that ran unlock.
+		signal.Ignore(syscall.SIGHUP)
+		if err := credstore.ServeAgent(socketPath, dataKey, ttl); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func openStore() *credstore.Store {
+	storePath, err := credstore.DefaultPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := credstore.Open(storePath)
+	if err != nil {
+		log.Fatalf("failed to open credential store: %v", err)
+	}
+	if !store.Exists() {
+		log.Fatal("no credential store yet; it is created when the first api key is added")
+	}
+	return store
+}
+
+func startAgent(dataKey []byte, ttl time.Duration) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	agent := exec.Command(executable, "provider", "agent", "--ttl", ttl.String())
+	detach(agent)
+	stdin, err := agent.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := agent.Start(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(stdin, base64.StdEncoding.EncodeToString(dataKey)); err != nil {
+		return err
+	}
+	if err := stdin.Close(); err != nil {
+		return err
+	}
+	return agent.Process.Release()
+}
+
+func waitForAgent(socketPath string) error {
+	var err error
+	for range 20 {
+		if _, err = credstore.AgentKey(socketPath); err == nil {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return err
+}
@@ -1,44 +1,96 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/farbodsalimi/promptctl/cmd/config"
+	"github.com/farbodsalimi/promptctl/cmd/eval"
 	"github.com/farbodsalimi/promptctl/cmd/prompt"
 	"github.com/farbodsalimi/promptctl/cmd/provider"
 	"github.com/farbodsalimi/promptctl/cmd/run"
+	"github.com/farbodsalimi/promptctl/cmd/snapshot"
 	"github.com/farbodsalimi/promptctl/cmd/vault"
 	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+	"github.com/farbodsalimi/promptctl/internal/report"
 )
 
+var profile string
+
 func NewRootCommand() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "promptctl",
 		Short: "A CLI tool for managing prompt vaults",
 		Long:  `promptctl is a CLI tool for storing, versioning, and running prompts with various LLM providers.`,
+		// Every command runs with the active profile's configuration and
+		// database.
+		PersistentPreRunE: initConfig,
 	}
 
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Configuration profile to use (default: $PROMPTCTL_PROFILE or the active profile)")
+
+	rootCmd.AddCommand(config.NewRootCmd())
+	rootCmd.AddCommand(eval.NewRootCmd())
 	rootCmd.AddCommand(prompt.NewRootCmd())
 	rootCmd.AddCommand(provider.NewRootCmd())
 	rootCmd.AddCommand(run.NewRootCmd())
+	rootCmd.AddCommand(snapshot.NewRootCmd())
 	rootCmd.AddCommand(vault.NewRootCmd())
 
 	return rootCmd
 }
 
-func Execute(version string) error {
+// Execute runs the command named by the arguments and returns the process
+// exit code.
+func Execute(version string) int {
 	rootCmd := NewRootCommand()
 	rootCmd.Version = version
+	rootCmd.SilenceErrors = true
 
-	cobra.OnInitialize(initConfig)
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 
-	return rootCmd.Execute()
+	// Commands get a context that is cancelled on Ctrl-C or SIGTERM so they
+	// can record what they were doing. A second signal kills the process as
+	// usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// Commands that report results return a report.Error carrying their
+	// exit code, which is silent when they have already told why.
+	err := rootCmd.ExecuteContext(ctx)
+	var reportErr *report.Error
+	if err != nil && (!errors.As(err, &reportErr) || reportErr.Err != nil) {
+		log.Error(err)
+	}
+	return report.ExitCode(err)
 }
 
-func initConfig() {
-	// Initialize database
-	if err := db.InitDB("promptctl.db"); err != nil {
-		log.Fatalf("failed to initialize database: %v", err)
+func initConfig(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	providers.SelectProfile(profile)
+	config, err := providers.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if warnings := config.Warnings(); len(warnings) > 0 {
+		log.Warnf("config.json has %d problem(s); run 'promptctl config validate'", len(warnings))
+	}
+
+	// Initialize the active profile's database
+	if err := db.InitDB(config.DatabasePath()); err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
 	}
+	return nil
 }
@@ -0,0 +1,259 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/cmdutil"
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+	"github.com/farbodsalimi/promptctl/internal/runner"
+	"github.com/farbodsalimi/promptctl/internal/templates"
+	"github.com/farbodsalimi/promptctl/internal/textdiff"
+)
+
+// abParams are the settings of an A/B test, stored with its run group. Row
+// i of the group holds the runs of both versions on case i.
+type abParams struct {
+	Vault     string `json:"vault"`
+	Prompt    string `json:"prompt"`
+	Versions  []int  `json:"versions"`
+	Input     string `json:"input,omitempty"`
+	InputHash string `json:"input_hash,omitempty"`
+	Cases     int    `json:"cases"`
+	runner.Settings
+}
+
+// abContext is the number of unchanged lines shown around each change in
+// A/B diffs.
+const abContext = 2
+
+var runABCmd = &cobra.Command{
+	Use:   "ab <vault>/<name> --versions <a>,<b> --input <file>",
+	Short: "Compare two versions of a prompt on the same inputs",
+	Long: `Run two versions of a prompt on every case of an input file, with the
+same variables and model settings, and report each pair of runs side by
+side with a diff of their responses.
+
+The input is a .jsonl or .csv file as for 'promptctl run batch'; a single
+case can be given with --vars instead. The runs are stored as one A/B test,
+and 'promptctl run show' on either run of a pair shows the other and the
+diff between them.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vaultName, promptName, err := cmdutil.PromptArgs(args)
+		if err != nil {
+			log.Fatal(err)
+		}
+		versions, _ := cmd.Flags().GetIntSlice("versions")
+		input, _ := cmd.Flags().GetString("input")
+		vars, _ := cmd.Flags().GetString("vars")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		if len(versions) != 2 || versions[0] == versions[1] || slices.Min(versions) < 1 {
+			log.Fatal("--versions must name two different versions, e.g. --versions 7,8")
+		}
+		if (input == "") == (vars == "") {
+			log.Fatal("give the cases with either --input or --vars")
+		}
+		if concurrency < 1 {
+			log.Fatal("concurrency must be at least 1")
+		}
+
+		params := abParams{Vault: vaultName, Prompt: promptName, Versions: versions, Input: input}
+		params.Settings, err = cmdutil.ReadSettings(cmd, vaultName, promptName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var cases []map[string]any
+		if input != "" {
+			cases, params.InputHash, err = readBatchInput(input)
+			if err != nil {
+				log.Fatalf("failed to read input: %v", err)
+			}
+			if len(cases) == 0 {
+				log.Fatalf("%s has no rows", input)
+			}
+		} else {
+			varsMap, err := templates.ParseVars(vars)
+			if err != nil {
+				log.Fatalf("failed to parse variables: %v", err)
+			}
+			cases = []map[string]any{varsMap}
+		}
+		params.Cases = len(cases)
+
+		pvs := make([]*db.PromptVersion, 2)
+		for i, version := range versions {
+			if pvs[i], err = db.GetPromptVersion(vaultName, promptName, version); err != nil {
+				log.Fatalf("failed to get version %d of %s/%s: %v", version, vaultName, promptName, err)
+			}
+		}
+
+		timeout, err := params.TimeLimit()
+		if err != nil {
+			log.Fatalf("invalid timeout: %v", err)
+		}
+		ctx := cmd.Context()
+		router, err := providers.GetProvider(ctx)
+		if err != nil {
+			log.Fatalf("failed to get provider: %v", err)
+		}
+		llm, err := params.Client(router)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Render every case with both versions before sending anything, and
+		// queue the two runs of a case next to each other so they are sent
+		// at about the same time and see the same provider conditions.
+		requests := make([]runner.Request, 0, 2*len(cases))
+		for i, caseVars := range cases {
+			for _, pv := range pvs {
+				messages, err := runner.Render(pv, caseVars)
+				if err != nil {
+					log.Fatalf("failed to render case %d with v%d: %v", i+1, pv.Version, err)
+				}
+				req := params.Request(llm, pv, messages, caseVars)
+				req.GroupRow = i + 1
+				requests = append(requests, req)
+			}
+		}
+
+		paramsJSON, _ := json.Marshal(params)
+		group := &db.RunGroup{Kind: db.RunGroupAB, Params: string(paramsJSON)}
+		if err := db.CreateRunGroup(group); err != nil {
+			log.Fatalf("failed to create A/B test: %v", err)
+		}
+		for i := range requests {
+			requests[i].GroupID = group.ID
+		}
+		fmt.Printf("A/B test %d: %s/%s v%d vs v%d on %d case(s)\n\n", group.ID, vaultName, promptName, versions[0], versions[1], len(cases))
+
+		runs := runner.ExecuteAll(ctx, requests, concurrency, timeout, nil)
+
+		incomplete := 0
+		for i, caseVars := range cases {
+			a, b := runs[2*i], runs[2*i+1]
+			if a == nil || b == nil {
+				incomplete++
+				continue
+			}
+			varsJSON, _ := json.Marshal(caseVars)
+			fmt.Printf("Case %d: %s\n", i+1, varsJSON)
+			printABPair(a, b, "  ")
+			fmt.Println()
+			if a.Status != db.RunStatusCompleted || b.Status != db.RunStatusCompleted {
+				incomplete++
+			}
+		}
+		printABSummary(versions, runs)
+
+		if incomplete > 0 {
+			log.Fatalf("%d of %d cases did not complete with both versions", incomplete, len(cases))
+		}
+	},
+}
+
+// printABPair shows the runs of both versions on a case and the diff of
+// their responses, indenting each line.
+func printABPair(a, b *db.Run, indent string) {
+	for _, run := range []*db.Run{a, b} {
+		fmt.Printf("%sv%d: %s in %s, %d+%d tokens", indent, run.Version, runStatus(run),
+			run.Duration.Round(time.Millisecond), run.PromptTokens, run.CompletionTokens)
+		if run.Cost != nil {
+			fmt.Printf(", %s", formatCost(*run.Cost))
+		}
+		fmt.Printf(" (run %d)\n", run.ID)
+	}
+	for _, run := range []*db.Run{a, b} {
+		if run.Status != db.RunStatusCompleted {
+			fmt.Printf("%sv%d failed: %s\n", indent, run.Version, run.ErrorMessage)
+			return
+		}
+	}
+
+	diff := textdiff.Unified(a.Response, b.Response, fmt.Sprintf("v%d", a.Version), fmt.Sprintf("v%d", b.Version), abContext)
+	if diff == "" {
+		fmt.Printf("%sResponses are identical\n", indent)
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		fmt.Printf("%s%s\n", indent, line)
+	}
+}
+
+// printABSummary totals the runs of each version of an A/B test.
+func printABSummary(versions []int, runs []*db.Run) {
+	identical := 0
+	for i := 0; i+1 < len(runs); i += 2 {
+		a, b := runs[i], runs[i+1]
+		if a != nil && b != nil && a.Status == db.RunStatusCompleted && b.Status == db.RunStatusCompleted && a.Response == b.Response {
+			identical++
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tCOMPLETED\tAVG LATENCY\tPROMPT TOKENS\tCOMPLETION TOKENS\tCOST")
+	for i, version := range versions {
+		var summary db.CostSummary
+		completed := 0
+		var latency time.Duration
+		for j := i; j < len(runs); j += 2 {
+			run := runs[j]
+			if run == nil {
+				continue
+			}
+			summary.PromptTokens += run.PromptTokens
+			summary.CompletionTokens += run.CompletionTokens
+			if run.Cost != nil {
+				summary.Cost += *run.Cost
+			} else if run.PromptTokens > 0 || run.CompletionTokens > 0 {
+				summary.Unpriced++
+			}
+			if run.Status == db.RunStatusCompleted {
+				completed++
+				latency += run.Duration
+			}
+		}
+		if completed > 0 {
+			latency /= time.Duration(completed)
+		}
+		fmt.Fprintf(w, "v%d\t%d/%d\t%s\t%d\t%d\t%s\n", version, completed, len(runs)/2,
+			formatLatency(latency), summary.PromptTokens, summary.CompletionTokens, summaryCost(summary))
+	}
+	w.Flush()
+	fmt.Printf("Identical responses: %d of %d cases\n", identical, len(runs)/2)
+}
+
+// printABPairOf shows the run an A/B run was paired with and the diff
+// between them, oldest version first.
+func printABPairOf(run *db.Run) {
+	runs, err := db.GetGroupRuns(run.GroupID)
+	if err != nil {
+		log.Warnf("failed to get runs of A/B test %d: %v", run.GroupID, err)
+		return
+	}
+	var other *db.Run
+	for i := range runs {
+		if runs[i].GroupRow == run.GroupRow && runs[i].PromptVersionID != run.PromptVersionID {
+			other = &runs[i]
+		}
+	}
+	if other == nil {
+		return
+	}
+	fmt.Printf("  Paired with: run %d (v%d)\n", other.ID, other.Version)
+	a, b := other, run
+	if run.Version < other.Version {
+		a, b = run, other
+	}
+	printABPair(a, b, "    ")
+}
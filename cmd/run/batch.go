@@ -0,0 +1,477 @@
+package run
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/cmdutil"
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+	"github.com/farbodsalimi/promptctl/internal/report"
+	"github.com/farbodsalimi/promptctl/internal/runner"
+)
+
+// batchParams are the settings of a batch, stored with its run group so it
+// can be resumed with them.
+type batchParams struct {
+	Vault     string `json:"vault"`
+	Prompt    string `json:"prompt"`
+	Version   int    `json:"version"`
+	Input     string `json:"input"`
+	InputHash string `json:"input_hash"`
+	Rows      int    `json:"rows"`
+	runner.Settings
+}
+
+var runBatchCmd = &cobra.Command{
+	Use:   "batch <vault>/<name> --input <file>",
+	Short: "Run a prompt once for every row of a JSONL or CSV file",
+	Long: `Render and run a prompt once for every row of an input file, several rows
+at a time, storing each row as a run of a new batch.
+
+A .jsonl input holds one JSON object of template variables per line; a .csv
+input names the variables in its header row. Requests are paced by each
+provider's requests_per_minute limit, shared by all rows of the batch.
+
+A batch that was interrupted or had failed rows is continued with --resume
+<batch>, which runs the rows without a completed run with the settings the
+batch was started with. --output writes the latest run of every row to a
+.jsonl or .csv file.
+
+--report writes a .json, .xml (JUnit) or .tap report of the batch for CI,
+where a row passes when its latest run completed. The exit status is 0 when
+at least --fail-under percent of the rows passed, 1 when fewer did, 2 when
+the batch could not run and 3 when rows were cancelled or not run.`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		resume, _ := flags.GetInt("resume")
+		input, _ := flags.GetString("input")
+		output, _ := flags.GetString("output")
+		concurrency, _ := flags.GetInt("concurrency")
+		reports, _ := flags.GetStringArray("report")
+		failUnder, _ := flags.GetFloat64("fail-under")
+		if concurrency < 1 {
+			return report.Errorf("concurrency must be at least 1")
+		}
+		if output != "" {
+			if _, err := batchOutputFormat(output); err != nil {
+				return report.Fail(err)
+			}
+		}
+		if err := report.ValidateFailUnder(failUnder); err != nil {
+			return report.Fail(err)
+		}
+		for _, path := range reports {
+			if err := report.ValidatePath(path); err != nil {
+				return report.Fail(err)
+			}
+		}
+
+		var (
+			group  *db.RunGroup
+			params batchParams
+			pv     *db.PromptVersion
+			err    error
+		)
+		if resume > 0 {
+			if len(args) > 0 {
+				return report.Errorf("a resumed batch runs the prompt it was started with; omit <vault>/<name>")
+			}
+			for _, name := range append(cmdutil.SettingFlags, "version") {
+				if flags.Changed(name) {
+					return report.Errorf("--%s cannot be changed when resuming a batch", name)
+				}
+			}
+			group, err = db.GetRunGroup(resume)
+			if errors.Is(err, sql.ErrNoRows) || (err == nil && group.Kind != db.RunGroupBatch) {
+				return report.Errorf("batch not found: %d", resume)
+			}
+			if err != nil {
+				return report.Errorf("failed to get batch: %w", err)
+			}
+			if err := json.Unmarshal([]byte(group.Params), &params); err != nil {
+				return report.Errorf("invalid settings of batch %d: %w", resume, err)
+			}
+			if input == "" {
+				input = params.Input
+			}
+			if pv, err = db.GetPromptVersionByID(group.PromptVersionID); err != nil {
+				return report.Errorf("failed to get prompt version of batch %d: %w", resume, err)
+			}
+		} else {
+			params.Vault, params.Prompt, err = cmdutil.PromptArgs(args)
+			if err != nil {
+				return report.Fail(err)
+			}
+			if input == "" {
+				return report.Errorf("--input is required")
+			}
+			if params.Settings, err = cmdutil.ReadSettings(cmd, params.Vault, params.Prompt); err != nil {
+				return report.Fail(err)
+			}
+			version, _ := flags.GetInt("version")
+			if pv, err = db.GetPromptVersion(params.Vault, params.Prompt, version); err != nil {
+				return report.Errorf("failed to get prompt content: %w", err)
+			}
+			params.Version = pv.Version
+		}
+
+		rows, hash, err := readBatchInput(input)
+		if err != nil {
+			return report.Errorf("failed to read input: %w", err)
+		}
+		if resume > 0 && hash != params.InputHash {
+			return report.Errorf("%s has changed since batch %d started; resume it with the original input", input, resume)
+		}
+		if len(rows) == 0 {
+			return report.Errorf("%s has no rows", input)
+		}
+
+		// Render every row first so a bad row stops the batch before any
+		// request is sent.
+		messages := make([][]providers.Message, len(rows))
+		for i, vars := range rows {
+			if messages[i], err = runner.Render(pv, vars); err != nil {
+				return report.Errorf("failed to render row %d: %w", i+1, err)
+			}
+		}
+
+		timeout, err := params.TimeLimit()
+		if err != nil {
+			return report.Errorf("invalid timeout: %w", err)
+		}
+		ctx := cmd.Context()
+		router, err := providers.GetProvider(ctx)
+		if err != nil {
+			return report.Errorf("failed to get provider: %w", err)
+		}
+		llm, err := params.Client(router)
+		if err != nil {
+			return report.Fail(err)
+		}
+
+		done := make(map[int]bool)
+		if resume > 0 {
+			runs, err := db.GetGroupRuns(group.ID)
+			if err != nil {
+				return report.Errorf("failed to get runs of batch %d: %w", group.ID, err)
+			}
+			for _, run := range runs {
+				if run.Status == db.RunStatusCompleted {
+					done[run.GroupRow] = true
+				}
+			}
+		} else {
+			params.Input = input
+			params.InputHash = hash
+			params.Rows = len(rows)
+			paramsJSON, _ := json.Marshal(params)
+			group = &db.RunGroup{Kind: db.RunGroupBatch, PromptVersionID: pv.ID, Params: string(paramsJSON)}
+			if err := db.CreateRunGroup(group); err != nil {
+				return report.Errorf("failed to create batch: %w", err)
+			}
+		}
+
+		var pending []int
+		for row := 1; row <= len(rows); row++ {
+			if !done[row] {
+				pending = append(pending, row)
+			}
+		}
+		if resume > 0 {
+			fmt.Printf("Resuming batch %d: %d of %d rows left to run\n", group.ID, len(pending), len(rows))
+		} else {
+			fmt.Printf("Batch %d: running %d rows of %s/%s v%d\n", group.ID, len(rows), params.Vault, params.Prompt, pv.Version)
+		}
+
+		// Run the pending rows with a fixed number of workers. Ctrl-C stops
+		// new rows from starting and cancels the ones in flight, which are
+		// stored as cancelled and run again on resume.
+		requests := make([]runner.Request, len(pending))
+		for i, row := range pending {
+			requests[i] = params.Request(llm, pv, messages[row-1], rows[row-1])
+			requests[i].GroupID = group.ID
+			requests[i].GroupRow = row
+		}
+		finished := 0
+		runner.ExecuteAll(ctx, requests, concurrency, timeout, func(i int, run *db.Run) {
+			finished++
+			fmt.Printf("[%d/%d] row %d: %s (run %d)\n", finished, len(pending), pending[i], runStatus(run), run.ID)
+		})
+
+		runs, err := db.GetGroupRuns(group.ID)
+		if err != nil {
+			return report.Errorf("failed to get runs of batch %d: %w", group.ID, err)
+		}
+		latest := make(map[int]*db.Run, len(rows))
+		for i := range runs {
+			latest[runs[i].GroupRow] = &runs[i]
+		}
+		if output != "" {
+			if err := writeBatchOutput(output, rows, latest); err != nil {
+				return report.Errorf("failed to write output: %w", err)
+			}
+		}
+
+		rep := batchReport(group.ID, params, len(rows), latest)
+		code := rep.Finish(failUnder)
+		for _, path := range reports {
+			if err := rep.Write(path); err != nil {
+				return report.Errorf("failed to write report: %w", err)
+			}
+		}
+
+		printBatchSummary(group.ID, len(rows), latest)
+		if output != "" {
+			fmt.Printf("Results written to %s\n", output)
+		}
+		for _, path := range reports {
+			fmt.Printf("Report written to %s\n", path)
+		}
+		if code == report.ExitFailed && failUnder < 100 {
+			log.Errorf("pass rate %.2f%% is under %g%%", rep.Summary.PassRate, failUnder)
+		}
+		if rep.Summary.Passed < rep.Summary.Total {
+			hint := fmt.Sprintf("batch %d is incomplete; run the remaining rows with 'promptctl run batch --resume %d'", group.ID, group.ID)
+			if code == report.ExitPassed {
+				log.Warn(hint)
+			} else {
+				log.Error(hint)
+			}
+		}
+		return report.Exit(code)
+	},
+}
+
+// readBatchInput reads the rows of a .jsonl or .csv batch input, along with
+// the SHA-256 hash of the file.
+func readBatchInput(path string) ([]map[string]any, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	var rows []map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl":
+		rows, err = readJSONLRows(data)
+	case ".csv":
+		rows, err = readCSVRows(data)
+	default:
+		err = fmt.Errorf("unsupported input %s (expected a .jsonl or .csv file)", path)
+	}
+	return rows, hash, err
+}
+
+// readJSONLRows reads one JSON object per line, skipping blank lines.
+func readJSONLRows(data []byte) ([]map[string]any, error) {
+	var rows []map[string]any
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var vars map[string]any
+		if err := json.Unmarshal(line, &vars); err != nil || vars == nil {
+			if err == nil {
+				err = fmt.Errorf("expected a JSON object")
+			}
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rows = append(rows, vars)
+	}
+	return rows, nil
+}
+
+// readCSVRows reads a CSV file whose header row names the variables.
+func readCSVRows(data []byte) ([]map[string]any, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(header))
+	for _, name := range header {
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("header: empty or repeated column name %q", name)
+		}
+		seen[name] = true
+	}
+
+	var rows []map[string]any
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		vars := make(map[string]any, len(header))
+		for i, name := range header {
+			vars[name] = record[i]
+		}
+		rows = append(rows, vars)
+	}
+}
+
+// batchReport reports on the rows of a batch from the latest run of each.
+// A row passes when its run completed and is skipped when it was cancelled
+// or not run.
+func batchReport(id int, params batchParams, total int, latest map[int]*db.Run) *report.Report {
+	rep := report.New(db.RunGroupBatch, id, fmt.Sprintf("%s/%s@v%d", params.Vault, params.Prompt, params.Version),
+		params.Provider, params.Options.Model)
+	for row := 1; row <= total; row++ {
+		c := report.Case{Name: fmt.Sprintf("row %d", row)}
+		run, ok := latest[row]
+		switch {
+		case !ok:
+			c.Status = report.StatusSkipped
+			c.Message = "not run"
+		case run.Status == db.RunStatusCompleted:
+			c.Status = report.StatusPassed
+		case run.Status == db.RunStatusCancelled:
+			c.Status = report.StatusSkipped
+			c.Message = "cancelled"
+		default:
+			c.Status = report.StatusFailed
+			c.Message = fmt.Sprintf("%s: %s", run.Status, run.ErrorMessage)
+		}
+		if ok {
+			c.RunID = run.ID
+			c.RunStatus = run.Status
+			c.Duration = run.Duration.Seconds()
+		}
+		rep.Add(c)
+	}
+	return rep
+}
+
+// printBatchSummary prints how the rows of a batch ended, from the latest
+// run of each.
+func printBatchSummary(id, total int, latest map[int]*db.Run) {
+	counts := make(map[string]int)
+	var cost float64
+	for row := 1; row <= total; row++ {
+		run, ok := latest[row]
+		if !ok {
+			counts["not_run"]++
+			continue
+		}
+		counts[run.Status]++
+		if run.Cost != nil {
+			cost += *run.Cost
+		}
+	}
+
+	summary := fmt.Sprintf("Batch %d: %d of %d rows completed", id, counts[db.RunStatusCompleted], total)
+	for _, status := range []string{db.RunStatusFailed, db.RunStatusTimedOut, db.RunStatusCancelled, "not_run"} {
+		if counts[status] > 0 {
+			summary += fmt.Sprintf(", %d %s", counts[status], strings.ReplaceAll(status, "_", " "))
+		}
+	}
+	fmt.Printf("%s; cost %s\n", summary, formatCost(cost))
+}
+
+// batchRecord is a row of a batch as written to its output.
+type batchRecord struct {
+	Row              int            `json:"row"`
+	Vars             map[string]any `json:"vars"`
+	Status           string         `json:"status"`
+	RunID            int            `json:"run_id,omitempty"`
+	Response         string         `json:"response"`
+	Error            string         `json:"error,omitempty"`
+	PromptTokens     int            `json:"prompt_tokens"`
+	CompletionTokens int            `json:"completion_tokens"`
+	CostUSD          *float64       `json:"cost_usd"`
+	LatencyMs        int64          `json:"latency_ms"`
+}
+
+func batchOutputFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl":
+		return formatJSON, nil
+	case ".csv":
+		return formatCSV, nil
+	}
+	return "", fmt.Errorf("unsupported output %s (expected a .jsonl or .csv file)", path)
+}
+
+// writeBatchOutput writes every row of a batch with its latest run. Rows
+// that have not run yet have the status "not_run".
+func writeBatchOutput(path string, rows []map[string]any, latest map[int]*db.Run) error {
+	format, err := batchOutputFormat(path)
+	if err != nil {
+		return err
+	}
+	records := make([]batchRecord, 0, len(rows))
+	for i, vars := range rows {
+		record := batchRecord{Row: i + 1, Vars: vars, Status: "not_run"}
+		if run, ok := latest[i+1]; ok {
+			record.Status = run.Status
+			record.RunID = run.ID
+			record.Response = run.Response
+			if run.ErrorClass != "" {
+				record.Error = run.ErrorClass + ": " + run.ErrorMessage
+			}
+			record.PromptTokens = run.PromptTokens
+			record.CompletionTokens = run.CompletionTokens
+			record.CostUSD = run.Cost
+			record.LatencyMs = run.Duration.Milliseconds()
+		}
+		records = append(records, record)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if format == formatJSON {
+		encoder := json.NewEncoder(f)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return f.Close()
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"row", "vars", "status", "run_id", "response", "error",
+		"prompt_tokens", "completion_tokens", "cost_usd", "latency_ms"})
+	for _, r := range records {
+		vars, _ := json.Marshal(r.Vars)
+		cost := ""
+		if r.CostUSD != nil {
+			cost = strconv.FormatFloat(*r.CostUSD, 'f', 6, 64)
+		}
+		w.Write([]string{strconv.Itoa(r.Row), string(vars), r.Status, strconv.Itoa(r.RunID), r.Response, r.Error,
+			strconv.Itoa(r.PromptTokens), strconv.Itoa(r.CompletionTokens), cost, strconv.FormatInt(r.LatencyMs, 10)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,311 @@
+package run
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+	"github.com/farbodsalimi/promptctl/internal/report"
+)
+
+func TestReadJSONLRows(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		input   string
+		want    []map[string]any
+		wantErr string
+	}{
+		{"empty", "", nil, ""},
+		{
+			"rows",
+			`{"name": "Ann", "n": 1}` + "\n" + `{"name": "Bob", "tags": ["a"]}`,
+			[]map[string]any{{"name": "Ann", "n": 1.0}, {"name": "Bob", "tags": []any{"a"}}},
+			"",
+		},
+		{
+			"blank lines and CRLF",
+			"\n{\"a\": 1}\r\n  \r\n{\"a\": 2}\n\n",
+			[]map[string]any{{"a": 1.0}, {"a": 2.0}},
+			"",
+		},
+		{"invalid JSON", `{"a": 1}` + "\n" + `{"a":`, nil, "line 2:"},
+		{"not an object", `{"a": 1}` + "\n\n" + `[1, 2]`, nil, "line 3:"},
+		{"null", `null`, nil, "line 1: expected a JSON object"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readJSONLRows([]byte(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("rows = %v, want %v", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCSVRows(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		input   string
+		want    []map[string]any
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"header only", "name,n\n", nil, false},
+		{
+			"rows",
+			"name,n\nAnn,1\n\"Bob, Jr.\",\"2\"\n",
+			[]map[string]any{{"name": "Ann", "n": "1"}, {"name": "Bob, Jr.", "n": "2"}},
+			false,
+		},
+		{"quoted newline", "text\n\"a\nb\"\n", []map[string]any{{"text": "a\nb"}}, false},
+		{"repeated column", "a,a\n1,2\n", nil, true},
+		{"empty column name", "a,\n1,2\n", nil, true},
+		{"short row", "a,b\n1\n", nil, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readCSVRows([]byte(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("rows = %v, want an error", rows)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("rows = %v, want %v", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadBatchInput(t *testing.T) {
+	dir := t.TempDir()
+	jsonl := filepath.Join(dir, "in.JSONL")
+	if err := os.WriteFile(jsonl, []byte(`{"a": 1}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rows, hash, err := readBatchInput(jsonl)
+	if err != nil || len(rows) != 1 || len(hash) != 64 {
+		t.Errorf("readBatchInput = %v, %q, %v", rows, hash, err)
+	}
+	if err := os.WriteFile(jsonl, []byte(`{"a": 2}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, changed, _ := readBatchInput(jsonl); changed == hash {
+		t.Error("hash did not change with the input")
+	}
+
+	txt := filepath.Join(dir, "in.txt")
+	if err := os.WriteFile(txt, []byte("a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readBatchInput(txt); err == nil {
+		t.Error("readBatchInput accepted a .txt input")
+	}
+}
+
+func TestWriteBatchOutput(t *testing.T) {
+	cost := 0.5
+	rows := []map[string]any{{"n": 1.0}, {"n": 2.0}, {"n": 3.0}}
+	// Runs finish out of order; the output follows the rows.
+	latest := map[int]*db.Run{
+		3: {ID: 30, Status: db.RunStatusCompleted, Response: "three", PromptTokens: 2, CompletionTokens: 1,
+			Cost: &cost, Duration: 1500 * time.Millisecond},
+		1: {ID: 31, Status: db.RunStatusFailed, ErrorClass: "rate_limit", ErrorMessage: "slow down"},
+	}
+	dir := t.TempDir()
+
+	jsonlPath := filepath.Join(dir, "out.jsonl")
+	if err := writeBatchOutput(jsonlPath, rows, latest); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(jsonlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []batchRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record batchRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	want := []batchRecord{
+		{Row: 1, Vars: rows[0], Status: db.RunStatusFailed, RunID: 31, Error: "rate_limit: slow down"},
+		{Row: 2, Vars: rows[1], Status: "not_run"},
+		{Row: 3, Vars: rows[2], Status: db.RunStatusCompleted, RunID: 30, Response: "three", PromptTokens: 2,
+			CompletionTokens: 1, CostUSD: &cost, LatencyMs: 1500},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %+v, want %+v", records, want)
+	}
+
+	csvPath := filepath.Join(dir, "out.csv")
+	if err := writeBatchOutput(csvPath, rows, latest); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	table, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTable := [][]string{
+		{"row", "vars", "status", "run_id", "response", "error", "prompt_tokens", "completion_tokens", "cost_usd", "latency_ms"},
+		{"1", `{"n":1}`, "failed", "31", "", "rate_limit: slow down", "0", "0", "", "0"},
+		{"2", `{"n":2}`, "not_run", "0", "", "", "0", "0", "", "0"},
+		{"3", `{"n":3}`, "completed", "30", "three", "", "2", "1", "0.500000", "1500"},
+	}
+	if !reflect.DeepEqual(table, wantTable) {
+		t.Errorf("csv = %q, want %q", table, wantTable)
+	}
+
+	if err := writeBatchOutput(filepath.Join(dir, "out.txt"), rows, latest); err == nil {
+		t.Error("writeBatchOutput accepted a .txt output")
+	}
+}
+
+var registerFlags sync.Once
+
+// runBatch runs 'run batch' with args, as a fresh invocation would.
+func runBatch(t *testing.T, args ...string) error {
+	t.Helper()
+	registerFlags.Do(func() { NewRootCmd() })
+	runBatchCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+	runBatchCmd.SetContext(context.Background())
+	if err := runBatchCmd.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+	return runBatchCmd.RunE(runBatchCmd, runBatchCmd.Flags().Args())
+}
+
+// useMock configures the mock provider of the test home directory.
+func useMock(t *testing.T, mock providers.MockConfig) {
+	t.Helper()
+	config, err := providers.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Mock = mock
+	if err := providers.SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchResume(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PROMPTCTL_PROFILE", "")
+	if err := os.MkdirAll(filepath.Join(home, ".promptctl"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InitDB(filepath.Join(home, "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateVault("v"); err != nil {
+		t.Fatal(err)
+	}
+	vault, err := db.GetVaultByName("v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreatePrompt(vault.ID, "p", "say {{.word}}", db.FormatText); err != nil {
+		t.Fatal(err)
+	}
+
+	input := filepath.Join(home, "in.jsonl")
+	words := []string{"ok", "fail", "ok", "fail"}
+	var lines []string
+	for _, word := range words {
+		lines = append(lines, `{"word": "`+word+`"}`)
+	}
+	if err := os.WriteFile(input, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(home, "out.jsonl")
+
+	// The first run fails the rows the strict mock has no rule for.
+	useMock(t, providers.MockConfig{Strict: true, Rules: []providers.MockRule{{Match: "^say ok$", Response: "fine"}}})
+	err = runBatch(t, "v/p", "-p", "mock", "-m", "m", "--input", input, "--output", output, "--concurrency", "2")
+	if code := report.ExitCode(err); code != report.ExitFailed {
+		t.Fatalf("first run: exit code %d (%v), want %d", code, err, report.ExitFailed)
+	}
+	// The batch is the first run group of the new database.
+	const id = 1
+	if group, err := db.GetRunGroup(id); err != nil || group.Kind != db.RunGroupBatch {
+		t.Fatalf("batch %d = %+v, %v", id, group, err)
+	}
+
+	// Resuming runs only the failed rows again.
+	useMock(t, providers.MockConfig{})
+	err = runBatch(t, "--resume", strconv.Itoa(id), "--output", output)
+	if code := report.ExitCode(err); code != report.ExitPassed {
+		t.Fatalf("resume: exit code %d (%v), want %d", code, err, report.ExitPassed)
+	}
+	runs, err := db.GetGroupRuns(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := make(map[int]int)
+	for _, r := range runs {
+		ran[r.GroupRow]++
+	}
+	if want := map[int]int{1: 1, 2: 2, 3: 1, 4: 2}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("runs per row = %v, want %v", ran, want)
+	}
+
+	if err := runBatch(t, "--resume", strconv.Itoa(id), "-p", "openai"); report.ExitCode(err) != report.ExitError {
+		t.Errorf("resume with another provider: %v, want an error", err)
+	}
+
+	// The output has every row in order with its latest run.
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record batchRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, record.Status+" "+record.Response)
+	}
+	want := []string{"completed fine", "completed say fail", "completed fine", "completed say fail"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,219 @@
+package run
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/cmdutil"
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+	"github.com/farbodsalimi/promptctl/internal/runner"
+	"github.com/farbodsalimi/promptctl/internal/templates"
+)
+
+// compareParams are the settings of a comparison, stored with its run
+// group. Row i of the group is the run of Targets[i-1].
+type compareParams struct {
+	Vault   string            `json:"vault"`
+	Prompt  string            `json:"prompt"`
+	Version int               `json:"version"`
+	Vars    map[string]any    `json:"vars"`
+	Targets []string          `json:"targets"`
+	Options providers.Options `json:"options"`
+	Timeout string            `json:"timeout,omitempty"`
+}
+
+var runCompareCmd = &cobra.Command{
+	Use:   "compare <vault>/<name> --target <provider>/<model> --target ...",
+	Short: "Run a prompt against several providers and models side by side",
+	Long: `Render a prompt once and run it against every target at the same time,
+then show the results in columns with their latency, tokens and cost.
+
+A target is a provider and model such as openai/gpt-4o, an account as in
+openai:team-a/gpt-4o, or a fallback chain such as chain:default. A target
+without a model uses the profile's default model. The runs are stored as
+one comparison; list them with 'promptctl run list --group <comparison>'.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vaultName, promptName, err := cmdutil.PromptArgs(args)
+		if err != nil {
+			log.Fatal(err)
+		}
+		targets, _ := cmd.Flags().GetStringArray("target")
+		vars, _ := cmd.Flags().GetString("vars")
+		version, _ := cmd.Flags().GetInt("version")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		tags, _ := cmd.Flags().GetStringArray("tag")
+		if len(targets) < 2 {
+			log.Fatal("at least two --target are required")
+		}
+		if timeout < 0 {
+			log.Fatal("timeout must not be negative")
+		}
+		for _, tag := range tags {
+			if err := db.ValidateTag(tag); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		config, err := providers.LoadConfig()
+		if err != nil {
+			log.Fatalf("failed to load config: %v", err)
+		}
+		promptChain, err := db.GetPromptChain(vaultName, promptName)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Fatalf("prompt not found: %s/%s", vaultName, promptName)
+		}
+		if err != nil {
+			log.Fatalf("failed to get prompt: %v", err)
+		}
+		opts, err := cmdutil.GenerationOptions(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		varsMap, err := templates.ParseVars(vars)
+		if err != nil {
+			log.Fatalf("failed to parse variables: %v", err)
+		}
+		pv, err := db.GetPromptVersion(vaultName, promptName, version)
+		if err != nil {
+			log.Fatalf("failed to get prompt content: %v", err)
+		}
+		messages, err := runner.Render(pv, varsMap)
+		if err != nil {
+			log.Fatalf("failed to render template: %v", err)
+		}
+
+		ctx := cmd.Context()
+		router, err := providers.GetProvider(ctx)
+		if err != nil {
+			log.Fatalf("failed to get provider: %v", err)
+		}
+		requests := make([]runner.Request, len(targets))
+		for i, target := range targets {
+			provider, model, _ := strings.Cut(target, "/")
+			if provider == "" {
+				log.Fatalf("invalid target %q (use provider/model)", target)
+			}
+			provider, model, err = runner.ResolveProvider(config, provider, model, promptChain)
+			if err != nil {
+				log.Fatalf("target %s: %v", target, err)
+			}
+			llm, err := runner.Resolve(router, config, provider, "", promptChain)
+			if err != nil {
+				log.Fatalf("target %s: %v", target, err)
+			}
+			requests[i] = runner.Request{
+				PromptVersion: pv,
+				Messages:      messages,
+				Vars:          varsMap,
+				Provider:      provider,
+				LLM:           llm,
+				Options:       opts,
+				Tags:          tags,
+				GroupRow:      i + 1,
+			}
+			requests[i].Options.Model = model
+		}
+
+		params := compareParams{
+			Vault:   vaultName,
+			Prompt:  promptName,
+			Version: pv.Version,
+			Vars:    varsMap,
+			Targets: targets,
+			Options: opts,
+		}
+		if timeout > 0 {
+			params.Timeout = timeout.String()
+		}
+		paramsJSON, _ := json.Marshal(params)
+		group := &db.RunGroup{Kind: db.RunGroupCompare, PromptVersionID: pv.ID, Params: string(paramsJSON)}
+		if err := db.CreateRunGroup(group); err != nil {
+			log.Fatalf("failed to create comparison: %v", err)
+		}
+		fmt.Printf("Comparison %d: %s/%s v%d against %d targets\n\n", group.ID, vaultName, promptName, pv.Version, len(targets))
+
+		for i := range requests {
+			requests[i].GroupID = group.ID
+		}
+		runs := runner.ExecuteAll(ctx, requests, len(requests), timeout, nil)
+		if slices.Contains(runs, nil) {
+			log.Fatalf("comparison %d cancelled before every target started", group.ID)
+		}
+
+		printComparison(targets, runs)
+
+		failed := 0
+		for _, run := range runs {
+			if run.Status != db.RunStatusCompleted {
+				failed++
+			}
+		}
+		if failed > 0 {
+			log.Fatalf("%d of %d targets did not complete", failed, len(runs))
+		}
+	},
+}
+
+// printComparison shows the runs of a comparison in a column per target,
+// followed by their responses.
+func printComparison(targets []string, runs []*db.Run) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	rows := []struct {
+		label string
+		value func(run *db.Run) string
+	}{
+		{"RUN", func(run *db.Run) string { return strconv.Itoa(run.ID) }},
+		{"STATUS", runStatus},
+		{"PROVIDER", func(run *db.Run) string { return run.Provider }},
+		{"MODEL", func(run *db.Run) string { return orDash(run.Model) }},
+		{"LATENCY", func(run *db.Run) string { return formatLatency(run.Duration) }},
+		{"FIRST TOKEN", func(run *db.Run) string { return formatLatency(run.TimeToFirstToken) }},
+		{"PROMPT TOKENS", func(run *db.Run) string { return strconv.Itoa(run.PromptTokens) }},
+		{"COMPLETION TOKENS", func(run *db.Run) string { return strconv.Itoa(run.CompletionTokens) }},
+		{"COST", func(run *db.Run) string {
+			if run.Cost == nil {
+				return "-"
+			}
+			return formatCost(*run.Cost)
+		}},
+	}
+
+	fmt.Fprintln(w, "\t"+strings.Join(targets, "\t"))
+	for _, row := range rows {
+		values := make([]string, len(runs))
+		for i, run := range runs {
+			values[i] = row.value(run)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", row.label, strings.Join(values, "\t"))
+	}
+	w.Flush()
+
+	for i, run := range runs {
+		fmt.Printf("\n%s (run %d):\n---\n", targets[i], run.ID)
+		if run.ErrorMessage != "" {
+			fmt.Printf("error: %s\n", run.ErrorMessage)
+		} else {
+			fmt.Println(run.Response)
+		}
+		fmt.Println("---")
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,163 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/pricing"
+)
+
+var runCostCmd = &cobra.Command{
+	Use:   "cost",
+	Short: "Summarise token usage, latency and cost of runs",
+	Long: `Summarise the token usage, average latency and cost of runs by provider
+and model. Costs are worked out when a run is stored, from the prices in
+effect at the time; see 'promptctl run pricing'.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := runFilter(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		summaries, err := db.GetCostSummary(filter)
+		if err != nil {
+			log.Fatalf("failed to summarise runs: %v", err)
+		}
+		if len(summaries) == 0 {
+			fmt.Println("No runs found")
+			return
+		}
+
+		var total db.CostSummary
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PROVIDER\tMODEL\tRUNS\tPROMPT TOKENS\tCOMPLETION TOKENS\tAVG LATENCY\tCOST")
+		for _, s := range summaries {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\t%s\n", s.Provider, s.Model, s.Runs,
+				s.PromptTokens, s.CompletionTokens, s.AvgLatency.Round(time.Millisecond), summaryCost(s))
+			total.Runs += s.Runs
+			total.PromptTokens += s.PromptTokens
+			total.CompletionTokens += s.CompletionTokens
+			total.Cost += s.Cost
+			total.Unpriced += s.Unpriced
+		}
+		fmt.Fprintf(w, "TOTAL\t\t%d\t%d\t%d\t\t%s\n", total.Runs, total.PromptTokens, total.CompletionTokens, summaryCost(total))
+		w.Flush()
+	},
+}
+
+// summaryCost formats the cost of a summary, noting runs that could not be
+// priced.
+func summaryCost(s db.CostSummary) string {
+	cost := formatCost(s.Cost)
+	if s.Unpriced > 0 {
+		cost += fmt.Sprintf(" (+%d unpriced)", s.Unpriced)
+	}
+	return cost
+}
+
+// formatCost formats a cost in US dollars, keeping the precision of small
+// per-run amounts.
+func formatCost(cost float64) string {
+	if cost != 0 && cost < 0.01 {
+		return "$" + strconv.FormatFloat(cost, 'f', 6, 64)
+	}
+	return "$" + strconv.FormatFloat(cost, 'f', 2, 64)
+}
+
+func newPricingCmd() *cobra.Command {
+	pricingCmd := &cobra.Command{
+		Use:   "pricing",
+		Short: "Manage the token prices runs are costed with",
+		Long: `Manage the token prices runs are costed with, in US dollars per million
+tokens, by provider and model. Until a price is changed the built-in list
+prices are used; after that ~/.promptctl/pricing.json holds the whole table
+and may also be edited by hand.
+
+A model without its own price takes that of the model it is a dated
+version of, so gpt-4o prices gpt-4o-2024-08-06 and claude-sonnet-4 prices
+claude-sonnet-4-20250514, but not of another model whose name it extends,
+like o3-mini of o3. The model "*" prices every other model of a provider.`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List token prices",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			table, err := pricing.Load()
+			if err != nil {
+				log.Fatalf("failed to load prices: %v", err)
+			}
+			path, err := pricing.Path()
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, err := os.Stat(path); err == nil {
+				fmt.Printf("Prices from %s (USD per million tokens):\n", path)
+			} else {
+				fmt.Println("Built-in prices (USD per million tokens):")
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "  PROVIDER\tMODEL\tINPUT\tOUTPUT")
+			for _, entry := range table.Entries() {
+				fmt.Fprintf(w, "  %s\t%s\t%g\t%g\n", entry.Provider, entry.Model, entry.Input, entry.Output)
+			}
+			w.Flush()
+		},
+	}
+
+	var input, output float64
+	setCmd := &cobra.Command{
+		Use:   "set <provider> <model> --input <price> --output <price>",
+		Short: "Set the price of a model",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if input < 0 || output < 0 {
+				log.Fatal("prices must not be negative")
+			}
+			table, err := pricing.Load()
+			if err != nil {
+				log.Fatalf("failed to load prices: %v", err)
+			}
+			table.Set(args[0], args[1], pricing.Price{Input: input, Output: output})
+			if err := pricing.Save(table); err != nil {
+				log.Fatalf("failed to save prices: %v", err)
+			}
+			fmt.Printf("Set price of %s/%s: $%g input, $%g output per million tokens\n", args[0], args[1], input, output)
+		},
+	}
+	setCmd.Flags().Float64Var(&input, "input", 0, "Price of a million prompt tokens in US dollars")
+	setCmd.Flags().Float64Var(&output, "output", 0, "Price of a million completion tokens in US dollars")
+	setCmd.MarkFlagRequired("input")
+	setCmd.MarkFlagRequired("output")
+
+	unsetCmd := &cobra.Command{
+		Use:   "unset <provider> <model>",
+		Short: "Remove the price of a model",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			table, err := pricing.Load()
+			if err != nil {
+				log.Fatalf("failed to load prices: %v", err)
+			}
+			if !table.Unset(args[0], args[1]) {
+				log.Fatalf("no price for %s/%s", args[0], args[1])
+			}
+			if err := pricing.Save(table); err != nil {
+				log.Fatalf("failed to save prices: %v", err)
+			}
+			fmt.Printf("Removed price of %s/%s\n", args[0], args[1])
+		},
+	}
+
+	pricingCmd.AddCommand(listCmd, setCmd, unsetCmd)
+	return pricingCmd
+}
@@ -0,0 +1,81 @@
+package run
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/db"
+)
+
+// addFilterFlags registers the run selection flags read by runFilter.
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("vault", "v", "", "Only include runs of prompts in this vault")
+	cmd.Flags().StringP("prompt", "p", "", "Only include runs of this prompt")
+	cmd.Flags().Int("version", 0, "Only include runs of this prompt version")
+	cmd.Flags().String("provider", "", "Only include runs answered by this provider")
+	cmd.Flags().String("model", "", "Only include runs answered by this model, as reported by the provider")
+	cmd.Flags().String("tag", "", "Only include runs with this tag")
+	cmd.Flags().Int("group", 0, "Only include runs of this batch or other run group")
+	cmd.Flags().String("since", "", "Only include runs created since this time or age (e.g. 2006-01-02 or 7d)")
+	cmd.Flags().String("until", "", "Only include runs created before this time or age")
+}
+
+// runFilter reads the run selection flags.
+func runFilter(cmd *cobra.Command) (db.RunFilter, error) {
+	var filter db.RunFilter
+	flags := cmd.Flags()
+	filter.Vault, _ = flags.GetString("vault")
+	filter.Prompt, _ = flags.GetString("prompt")
+	filter.Version, _ = flags.GetInt("version")
+	filter.Provider, _ = flags.GetString("provider")
+	filter.Model, _ = flags.GetString("model")
+	filter.Tag, _ = flags.GetString("tag")
+	filter.Group, _ = flags.GetInt("group")
+	if filter.Version < 0 {
+		return filter, fmt.Errorf("invalid --version: %d", filter.Version)
+	}
+	if filter.Group < 0 {
+		return filter, fmt.Errorf("invalid --group: %d", filter.Group)
+	}
+
+	now := time.Now()
+	for _, f := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		value, _ := flags.GetString(f.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseTime(value, now)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --%s: %w", f.name, err)
+		}
+		*f.dst = t
+	}
+	return filter, nil
+}
+
+// parseTime parses a date, an RFC 3339 time or an age before now such as
+// 90m, 24h or 7d.
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.ParseFloat(days, 64); err == nil && n >= 0 {
+			return now.Add(-time.Duration(n * float64(24*time.Hour))), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date, time or age (e.g. 2006-01-02 or 7d)", value)
+}
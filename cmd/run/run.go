@@ -2,38 +2,73 @@ package run
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/farbodsalimi/promptctl/internal/cmdutil"
 	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/eval"
 	"github.com/farbodsalimi/promptctl/internal/providers"
+	"github.com/farbodsalimi/promptctl/internal/runner"
 	"github.com/farbodsalimi/promptctl/internal/templates"
 )
 
 var promptRunCmd = &cobra.Command{
 	Use:   "prompt <vault> <name>",
 	Short: "Run a prompt with an LLM provider",
-	Args:  cobra.ExactArgs(2),
+	Long: `Render a prompt with --vars and send it to a provider. Generation options
+that are not given are left to the provider's defaults. This includes
+--temperature, which used to default to 0.7: without it, runs now use the
+provider's default temperature.`,
+	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		vaultName := args[0]
 		promptName := args[1]
 
 		provider, _ := cmd.Flags().GetString("provider")
+		account, _ := cmd.Flags().GetString("account")
 		model, _ := cmd.Flags().GetString("model")
 		vars, _ := cmd.Flags().GetString("vars")
 		version, _ := cmd.Flags().GetInt("version")
-		temperature, _ := cmd.Flags().GetFloat32("temperature")
+		stream, _ := cmd.Flags().GetBool("stream")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		tags, _ := cmd.Flags().GetStringArray("tag")
+		for _, tag := range tags {
+			if err := db.ValidateTag(tag); err != nil {
+				log.Fatal(err)
+			}
+		}
 
-		if provider == "" {
-			log.Fatal("provider is required (use --provider)")
+		config, err := providers.LoadConfig()
+		if err != nil {
+			log.Fatalf("failed to load config: %v", err)
 		}
-		if model == "" {
-			log.Fatal("model is required (use --model)")
+		promptChain, err := db.GetPromptChain(vaultName, promptName)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Fatalf("prompt not found: %s/%s", vaultName, promptName)
+		}
+		if err != nil {
+			log.Fatalf("failed to get prompt: %v", err)
+		}
+		provider, model, err = runner.ResolveProvider(config, provider, model, promptChain)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts, err := cmdutil.GenerationOptions(cmd)
+		if err != nil {
+			log.Fatal(err)
 		}
+		opts.Model = model
 
 		// Parse variables
 		varsMap, err := templates.ParseVars(vars)
@@ -42,76 +77,104 @@ var promptRunCmd = &cobra.Command{
 		}
 
 		// Get prompt content
-		var content string
-		var promptVersionID int
-
-		if version > 0 {
-			content, err = db.GetPromptVersionContentByVersion(vaultName, promptName, version)
-		} else {
-			prompt, err2 := db.GetPromptByName(vaultName, promptName)
-			if err2 != nil {
-				log.Fatalf("prompt not found: %s/%s", vaultName, promptName)
-			}
-			promptVersionID, content, err = db.GetPromptVersionContent(prompt.ID)
-		}
-
+		pv, err := db.GetPromptVersion(vaultName, promptName, version)
 		if err != nil {
 			log.Fatalf("failed to get prompt content: %v", err)
 		}
 
 		// Render template
-		renderedPrompt, err := templates.RenderTemplate(content, varsMap)
+		messages, err := runner.Render(pv, varsMap)
 		if err != nil {
 			log.Fatalf("failed to render template: %v", err)
 		}
 
-		fmt.Printf("Rendered prompt:\n---\n%s\n---\n\n", renderedPrompt)
+		fmt.Printf("Rendered prompt:\n---\n%s\n---\n\n", formatMessages(pv, messages))
 
-		// Get LLM provider
-		ctx := context.Background()
+		// Get LLM provider. Ctrl-C and --timeout cancel the request rather
+		// than killing the process so the run, and any partial streamed
+		// response, can still be stored.
+		ctx := cmd.Context()
+		if timeout < 0 {
+			log.Fatal("timeout must not be negative")
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
 		router, err := providers.GetProvider(ctx)
 		if err != nil {
 			log.Fatalf("failed to get provider: %v", err)
 		}
 
-		// Get specific LLM provider
-		llm, ok := router.Get(provider)
-		if !ok {
-			log.Fatalf("provider not found: %s", provider)
-		}
-
-		// Execute request
-		response, err := llm.Complete(renderedPrompt)
+		// Get specific LLM provider, one of its accounts or a fallback chain
+		llm, err := runner.Resolve(router, config, provider, account, promptChain)
 		if err != nil {
-			log.Fatalf("failed to generate response: %v", err)
+			log.Fatal(err)
 		}
 
-		fmt.Printf("Response:\n%s\n", response)
-
-		// Store run in database
-		paramsData := map[string]any{
-			"provider":    provider,
-			"model":       model,
-			"temperature": temperature,
-			"vars":        varsMap,
+		// Execute request and store the run
+		req := runner.Request{
+			PromptVersion: pv,
+			Messages:      messages,
+			Vars:          varsMap,
+			Provider:      provider,
+			LLM:           llm,
+			Options:       opts,
+			Tags:          tags,
+		}
+		if stream {
+			fmt.Println("Response:")
+			req.OnDelta = func(delta string) { fmt.Print(delta) }
+		}
+		run, err := runner.Execute(ctx, req)
+		if stream {
+			fmt.Println()
+		} else if err == nil {
+			fmt.Printf("Response:\n%s\n", run.Response)
 		}
-		paramsJSON, _ := json.Marshal(paramsData)
 
-		err = db.CreateRun(promptVersionID, provider, string(paramsJSON), response)
-		if err != nil {
-			log.Printf("warning: failed to store run in database: %v", err)
+		switch run.Status {
+		case db.RunStatusFailed:
+			log.Fatalf("failed to generate response: %v (stored as run %d)", err, run.ID)
+		case db.RunStatusTimedOut:
+			log.Fatalf("run timed out after %s; stored as run %d", timeout, run.ID)
+		case db.RunStatusCancelled:
+			log.Fatalf("run cancelled after %s; stored as run %d", run.Duration.Round(time.Millisecond), run.ID)
 		}
 	},
 }
 
+func formatMessages(pv *db.PromptVersion, messages []providers.Message) string {
+	if pv.Format != db.FormatChat {
+		return messages[0].Content
+	}
+	display := make([]templates.Message, 0, len(messages))
+	for _, msg := range messages {
+		display = append(display, templates.Message{Role: string(msg.Role), Content: msg.Content})
+	}
+	return templates.FormatMessages(display)
+}
+
 var runListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List recent runs",
 	Run: func(cmd *cobra.Command, args []string) {
-		promptName, _ := cmd.Flags().GetString("prompt")
-		vaultName, _ := cmd.Flags().GetString("vault")
+		filter, err := runFilter(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		filter.Status, _ = cmd.Flags().GetString("status")
+		if filter.Status != "" && !slices.Contains(db.RunStatuses, filter.Status) {
+			log.Fatalf("invalid status %q (supported: %s)", filter.Status, strings.Join(db.RunStatuses, ", "))
+		}
+		limit, _ := cmd.Flags().GetInt("limit")
+		cursor, _ := cmd.Flags().GetInt("cursor")
+		if limit < 0 || cursor < 0 {
+			log.Fatal("--limit and --cursor must not be negative")
+		}
 
-		runs, err := db.GetRuns(vaultName, promptName)
+		runs, next, err := db.GetRuns(filter, limit, cursor)
 		if err != nil {
 			log.Fatalf("failed to list runs: %v", err)
 		}
@@ -123,8 +186,15 @@ var runListCmd = &cobra.Command{
 
 		fmt.Println("Recent runs:")
 		for _, run := range runs {
-			fmt.Printf("  Run %d: %s with %s (created: %s)\n",
-				run.ID, run.PromptName, run.Provider, run.Created)
+			tags := ""
+			if len(run.Tags) > 0 {
+				tags = " [" + strings.Join(run.Tags, ", ") + "]"
+			}
+			fmt.Printf("  Run %d: %s with %s, %s (created: %s)%s\n",
+				run.ID, run.PromptName, run.Provider, runStatus(&run), run.Created, tags)
+		}
+		if next != 0 {
+			fmt.Printf("More runs: use --cursor %d for the next page\n", next)
 		}
 	},
 }
@@ -148,12 +218,127 @@ var runShowCmd = &cobra.Command{
 		fmt.Printf("Run %d:\n", run.ID)
 		fmt.Printf("  Prompt: %s\n", run.PromptName)
 		fmt.Printf("  Provider: %s\n", run.Provider)
+		if run.Account != "" {
+			fmt.Printf("  Account: %s\n", run.Account)
+		}
+		fmt.Printf("  Model: %s\n", run.Model)
+		fmt.Printf("  Status: %s\n", run.Status)
+		fmt.Printf("  Attempts: %d\n", run.Attempts)
+		if len(run.Tags) > 0 {
+			fmt.Printf("  Tags: %s\n", strings.Join(run.Tags, ", "))
+		}
+		if run.Duration > 0 {
+			fmt.Printf("  Latency: %s", run.Duration)
+			if run.TimeToFirstToken > 0 {
+				fmt.Printf(" (first token: %s)", run.TimeToFirstToken)
+			}
+			fmt.Println()
+		}
+		if run.PromptTokens > 0 || run.CompletionTokens > 0 {
+			fmt.Printf("  Tokens: %d prompt, %d completion\n", run.PromptTokens, run.CompletionTokens)
+			if run.Cost != nil {
+				fmt.Printf("  Cost: %s\n", formatCost(*run.Cost))
+			} else {
+				fmt.Println("  Cost: unknown (no price for this model; see 'promptctl run pricing')")
+			}
+		}
+		if run.ErrorClass != "" {
+			fmt.Printf("  Error: %s: %s\n", run.ErrorClass, run.ErrorMessage)
+		}
+		if run.Chain != "" {
+			printHops(run)
+		}
+		if run.GradedRunID != 0 {
+			fmt.Printf("  Grades: run %d\n", run.GradedRunID)
+		}
+		if graders, err := db.GetGraderRuns(run.ID); err == nil && len(graders) > 0 {
+			ids := make([]string, 0, len(graders))
+			for _, g := range graders {
+				ids = append(ids, strconv.Itoa(g.ID))
+			}
+			fmt.Printf("  Graded by: run(s) %s\n", strings.Join(ids, ", "))
+		}
+		if run.GroupID != 0 {
+			fmt.Printf("  Group: %s %d, row %d\n", run.GroupKind, run.GroupID, run.GroupRow)
+			switch run.GroupKind {
+			case db.RunGroupAB:
+				printABPairOf(run)
+			case db.RunGroupEval:
+				printEvalResult(run)
+			}
+		}
 		fmt.Printf("  Created: %s\n", run.Created)
 		fmt.Printf("  Parameters:\n%s\n", run.Params)
 		fmt.Printf("  Response:\n---\n%s\n---\n", run.Response)
 	},
 }
 
+// runStatus is a run's status, with the class of its error if it has one.
+func runStatus(run *db.Run) string {
+	if run.ErrorClass != "" {
+		return run.Status + ": " + run.ErrorClass
+	}
+	return run.Status
+}
+
+// printEvalResult shows the outcome of the test case a run evaluated.
+func printEvalResult(run *db.Run) {
+	result, err := db.GetEvalResult(run.ID)
+	if err != nil {
+		return
+	}
+	outcome := "failed"
+	if result.Passed {
+		outcome = "passed"
+	}
+	fmt.Printf("  Case: %s, %s\n", result.Case, outcome)
+	var assertions []eval.Result
+	if err := json.Unmarshal([]byte(result.Assertions), &assertions); err != nil {
+		return
+	}
+	for _, a := range assertions {
+		outcome := "pass"
+		if !a.Passed {
+			outcome = "fail"
+		}
+		line := fmt.Sprintf("    %s: %s", outcome, a.Assertion)
+		if a.Message != "" {
+			line += ": " + a.Message
+		}
+		if a.Score != nil {
+			line += fmt.Sprintf(" (score %g, grader run %d)", *a.Score, a.GraderRunID)
+		} else if a.GraderRunID != 0 {
+			line += fmt.Sprintf(" (grader run %d)", a.GraderRunID)
+		}
+		fmt.Println(line)
+		if a.Rationale != "" {
+			fmt.Printf("      %s\n", a.Rationale)
+		}
+	}
+}
+
+// printHops shows which hop of a run's fallback chain answered and why the
+// hops before it were skipped.
+func printHops(run *db.Run) {
+	if run.Chain == providers.PromptChain {
+		fmt.Println("  Chain: the prompt's fallback chain")
+	} else {
+		fmt.Printf("  Chain: %s\n", run.Chain)
+	}
+	var hops []providers.Hop
+	if err := json.Unmarshal([]byte(run.Hops), &hops); err != nil {
+		return
+	}
+	for i, hop := range hops {
+		name := providers.ChainHop{Provider: hop.Provider, Model: hop.Model}.String()
+		if hop.Error == "" {
+			fmt.Printf("    %d. %s: answered\n", i+1, name)
+		} else {
+			fmt.Printf("    %d. %s: failed: %s\n", i+1, name, hop.Error)
+		}
+	}
+}
+
 func NewRootCmd() *cobra.Command {
 	runCmd := &cobra.Command{
 		Use:   "run",
@@ -162,17 +347,57 @@ func NewRootCmd() *cobra.Command {
 	}
 
 	runCmd.AddCommand(promptRunCmd)
+	runCmd.AddCommand(cmdutil.Reporting(runBatchCmd))
+	runCmd.AddCommand(runCompareCmd)
+	runCmd.AddCommand(runABCmd)
 	runCmd.AddCommand(runListCmd)
 	runCmd.AddCommand(runShowCmd)
+	runCmd.AddCommand(runCostCmd)
+	runCmd.AddCommand(runStatsCmd)
+	runCmd.AddCommand(newPricingCmd())
 
-	promptRunCmd.Flags().StringP("provider", "p", "", "LLM provider to use (openai, anthropic, google)")
-	promptRunCmd.Flags().StringP("model", "m", "", "Model name (e.g., gpt-4, claude-3-sonnet, gemini-pro)")
+	promptRunCmd.Flags().StringP("provider", "p", "", "LLM provider to use (openai, anthropic, google, mock, a custom provider name, chain:<name> for a fallback chain or chain for the prompt's own; default: the prompt's chain, then the profile default)")
+	promptRunCmd.Flags().String("account", "", "Named provider account to use (default: the provider's default key or its rotation policy)")
+	promptRunCmd.Flags().StringP("model", "m", "", "Model name (e.g., gpt-4, claude-3-sonnet, gemini-pro; default: the profile default)")
 	promptRunCmd.Flags().StringP("vars", "", "", "Template variables as JSON object or key=value pairs (e.g., '{\"name\":\"John\"}' or 'name=John,age=30')")
 	promptRunCmd.Flags().IntP("version", "v", 0, "Specific prompt version to use (default: latest version)")
-	promptRunCmd.Flags().Float32P("temperature", "t", 0.7, "Sampling temperature for response generation (0.0-2.0, higher = more creative)")
+	promptRunCmd.Flags().Bool("stream", false, "Print the response as it is generated")
+	promptRunCmd.Flags().StringArray("tag", nil, "Tag the run, e.g. --tag prod; repeat for several")
+	promptRunCmd.Flags().Duration("timeout", 0, "Give up on the run after this long, e.g. 30s or 2m, counting retries and fallbacks (default: no limit)")
+	cmdutil.AddGenerationFlags(promptRunCmd)
+
+	runBatchCmd.Flags().String("input", "", "JSONL or CSV file with the template variables of each row")
+	runBatchCmd.Flags().String("output", "", "Write the result of each row to this .jsonl or .csv file")
+	runBatchCmd.Flags().Int("concurrency", 4, "Number of rows to run at once")
+	runBatchCmd.Flags().Int("resume", 0, "Continue this batch, running the rows without a completed run")
+	runBatchCmd.Flags().IntP("version", "v", 0, "Specific prompt version to use (default: latest version)")
+	runBatchCmd.Flags().StringArray("report", nil, "Write a report to a .json, .xml (JUnit) or .tap file; repeat for several")
+	runBatchCmd.Flags().Float64("fail-under", 100, "Fail when under this percentage of rows complete")
+	cmdutil.AddSettingFlags(runBatchCmd, "every run of the batch")
+
+	runCompareCmd.Flags().StringArray("target", nil, "Provider and model to run the prompt with, e.g. openai/gpt-4o; repeat for each target")
+	runCompareCmd.Flags().StringP("vars", "", "", "Template variables as JSON object or key=value pairs")
+	runCompareCmd.Flags().IntP("version", "v", 0, "Specific prompt version to use (default: latest version)")
+	runCompareCmd.Flags().StringArray("tag", nil, "Tag every run of the comparison; repeat for several")
+	runCompareCmd.Flags().Duration("timeout", 0, "Give up on a target after this long, e.g. 30s (default: no limit)")
+	cmdutil.AddGenerationFlags(runCompareCmd)
+
+	runABCmd.Flags().IntSlice("versions", nil, "The two prompt versions to compare, e.g. 7,8")
+	runABCmd.Flags().String("input", "", "JSONL or CSV file with the template variables of each case")
+	runABCmd.Flags().StringP("vars", "", "", "Template variables of a single case, as for 'run prompt'")
+	runABCmd.Flags().Int("concurrency", 4, "Number of runs to make at once")
+	cmdutil.AddSettingFlags(runABCmd, "every run of the A/B test")
+
+	addFilterFlags(runListCmd)
+	runListCmd.Flags().String("status", "", "Only include runs with this status (completed, cancelled, timed_out or failed)")
+	runListCmd.Flags().Int("limit", 20, "Maximum number of runs to show (0 for all)")
+	runListCmd.Flags().Int("cursor", 0, "Show the runs after this cursor, as printed at the end of the previous page")
+
+	addFilterFlags(runCostCmd)
 
-	runListCmd.Flags().StringP("prompt", "p", "", "Filter results by prompt name")
-	runListCmd.Flags().StringP("vault", "v", "", "Filter results by vault name")
+	runStatsCmd.Flags().StringSlice("by", []string{db.GroupPrompt}, "Group runs by vault, prompt, version, provider, account or model; comma separated for several")
+	runStatsCmd.Flags().String("format", formatTable, "Output format: table, json or csv")
+	addFilterFlags(runStatsCmd)
 
 	return runCmd
 }
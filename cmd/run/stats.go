@@ -0,0 +1,173 @@
+package run
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/db"
+)
+
+// Output formats of run stats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+var runStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Aggregate runs by vault, prompt, version, provider, account or model",
+	Long: `Aggregate runs over a time window: run counts, failure rate, median and
+95th percentile latency of completed runs, tokens and cost.
+
+Group with --by, for example --by version to compare the versions of each
+prompt or --by prompt,provider. The accounts of a provider are grouped
+together; add --by provider,account to tell them apart. Times for --since
+and --until are a date (2006-01-02), an RFC 3339 time or an age such as
+24h or 7d.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		groupBy, _ := cmd.Flags().GetStringSlice("by")
+		format, _ := cmd.Flags().GetString("format")
+		if !slices.Contains([]string{formatTable, formatJSON, formatCSV}, format) {
+			log.Fatalf("invalid format %q (supported: table, json, csv)", format)
+		}
+
+		filter, err := runFilter(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stats, err := db.GetRunStats(filter, groupBy)
+		if err != nil {
+			log.Fatalf("failed to aggregate runs: %v", err)
+		}
+
+		switch format {
+		case formatJSON:
+			printStatsJSON(groupBy, stats)
+		case formatCSV:
+			printStatsCSV(groupBy, stats)
+		default:
+			if len(stats) == 0 {
+				fmt.Println("No runs found")
+				return
+			}
+			printStatsTable(groupBy, stats)
+		}
+	},
+}
+
+// statsRecord is a group of run stats as written in JSON and CSV.
+type statsRecord struct {
+	Group            map[string]string `json:"group"`
+	Runs             int               `json:"runs"`
+	Failed           int               `json:"failed"`
+	Cancelled        int               `json:"cancelled"`
+	FailureRate      float64           `json:"failure_rate"`
+	P50LatencyMs     int64             `json:"p50_latency_ms"`
+	P95LatencyMs     int64             `json:"p95_latency_ms"`
+	PromptTokens     int               `json:"prompt_tokens"`
+	CompletionTokens int               `json:"completion_tokens"`
+	CostUSD          float64           `json:"cost_usd"`
+	Unpriced         int               `json:"unpriced"`
+}
+
+func newStatsRecord(groupBy []string, s *db.RunStats) statsRecord {
+	group := make(map[string]string, len(groupBy))
+	for i, key := range groupBy {
+		group[key] = s.Keys[i]
+	}
+	return statsRecord{
+		Group:            group,
+		Runs:             s.Runs,
+		Failed:           s.Failed,
+		Cancelled:        s.Cancelled,
+		FailureRate:      s.FailureRate(),
+		P50LatencyMs:     s.P50Latency.Milliseconds(),
+		P95LatencyMs:     s.P95Latency.Milliseconds(),
+		PromptTokens:     s.PromptTokens,
+		CompletionTokens: s.CompletionTokens,
+		CostUSD:          s.Cost,
+		Unpriced:         s.Unpriced,
+	}
+}
+
+func printStatsJSON(groupBy []string, stats []*db.RunStats) {
+	records := make([]statsRecord, 0, len(stats))
+	for _, s := range stats {
+		records = append(records, newStatsRecord(groupBy, s))
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		log.Fatalf("failed to encode stats: %v", err)
+	}
+	fmt.Println(string(data))
+}
+
+func printStatsCSV(groupBy []string, stats []*db.RunStats) {
+	w := csv.NewWriter(os.Stdout)
+	header := append(slices.Clone(groupBy), "runs", "failed", "cancelled", "failure_rate",
+		"p50_latency_ms", "p95_latency_ms", "prompt_tokens", "completion_tokens", "cost_usd", "unpriced")
+	w.Write(header)
+	for _, s := range stats {
+		r := newStatsRecord(groupBy, s)
+		row := append(slices.Clone(s.Keys),
+			strconv.Itoa(r.Runs), strconv.Itoa(r.Failed), strconv.Itoa(r.Cancelled),
+			strconv.FormatFloat(r.FailureRate, 'f', 4, 64),
+			strconv.FormatInt(r.P50LatencyMs, 10), strconv.FormatInt(r.P95LatencyMs, 10),
+			strconv.Itoa(r.PromptTokens), strconv.Itoa(r.CompletionTokens),
+			strconv.FormatFloat(r.CostUSD, 'f', 6, 64), strconv.Itoa(r.Unpriced))
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatalf("failed to write stats: %v", err)
+	}
+}
+
+func printStatsTable(groupBy []string, stats []*db.RunStats) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := make([]string, 0, len(groupBy)+7)
+	for _, key := range groupBy {
+		header = append(header, strings.ToUpper(key))
+	}
+	header = append(header, "RUNS", "FAILED", "P50", "P95", "PROMPT TOKENS", "COMPLETION TOKENS", "COST")
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	for _, s := range stats {
+		row := make([]string, 0, len(header))
+		for _, key := range s.Keys {
+			if key == "" {
+				key = "-"
+			}
+			row = append(row, key)
+		}
+		row = append(row,
+			strconv.Itoa(s.Runs),
+			fmt.Sprintf("%d (%.1f%%)", s.Failed, 100*s.FailureRate()),
+			formatLatency(s.P50Latency),
+			formatLatency(s.P95Latency),
+			strconv.Itoa(s.PromptTokens),
+			strconv.Itoa(s.CompletionTokens),
+			summaryCost(db.CostSummary{Cost: s.Cost, Unpriced: s.Unpriced}))
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+func formatLatency(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,254 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/cmdutil"
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+	"github.com/farbodsalimi/promptctl/internal/report"
+	"github.com/farbodsalimi/promptctl/internal/runner"
+	"github.com/farbodsalimi/promptctl/internal/snapshot"
+	"github.com/farbodsalimi/promptctl/internal/textdiff"
+)
+
+// diffContext is the number of unchanged lines shown around each change of
+// a drifted response.
+const diffContext = 2
+
+// checkParams are the settings of a snapshot check, stored with its run
+// group. Row i of the group is the run of Cases[i-1].
+type checkParams struct {
+	Vault   string           `json:"vault"`
+	Prompt  string           `json:"prompt"`
+	Version int              `json:"version"`
+	Cases   []string         `json:"cases"`
+	Matcher snapshot.Matcher `json:"matcher"`
+	runner.Settings
+}
+
+func NewCheckCmd() *cobra.Command {
+	var (
+		only        []string
+		matcher     snapshot.Matcher
+		concurrency int
+		reports     []string
+	)
+
+	snapshotCheckCmd := &cobra.Command{
+		Use:   "check <vault>/<name>[@<version>]",
+		Short: "Check a prompt's responses against their golden responses",
+		Long: `Run every test case of a prompt's evaluation suite and compare each response
+with the case's golden response. --mode sets how they are compared:
+
+  exact       the responses are identical (default)
+  whitespace  the responses are identical once runs of whitespace are
+              collapsed and the ends trimmed
+  similarity  the responses share at least --threshold of their words, in
+              order, from 0 to 1
+
+Drifted responses are shown as a diff against the golden. Cases without a
+golden fail as new. Accept the responses of the check as the new goldens
+with 'promptctl snapshot update'.
+
+--report writes the outcome to a .json, .xml (JUnit) or .tap file. The exit
+status is 0 when every response matches its golden, 1 when any drifted, is
+new or failed, 2 when the check could not run and 3 when it was
+interrupted before every case ran.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultName, promptName, version, err := cmdutil.PromptRef(args[0])
+			if err != nil {
+				return report.Fail(err)
+			}
+			if concurrency < 1 {
+				return report.Errorf("concurrency must be at least 1")
+			}
+			if matcher.Mode != snapshot.ModeSimilarity {
+				matcher.Threshold = 0
+			}
+			if err := matcher.Validate(); err != nil {
+				return report.Fail(err)
+			}
+			for _, path := range reports {
+				if err := report.ValidatePath(path); err != nil {
+					return report.Fail(err)
+				}
+			}
+
+			params := checkParams{Vault: vaultName, Prompt: promptName, Matcher: matcher}
+			params.Settings, err = cmdutil.ReadSettings(cmd, vaultName, promptName)
+			if err != nil {
+				return report.Fail(err)
+			}
+			pv, err := db.GetPromptVersion(vaultName, promptName, version)
+			if err != nil {
+				return report.Errorf("failed to get prompt content: %w", err)
+			}
+			params.Version = pv.Version
+
+			cases, err := cmdutil.LoadCases(vaultName, promptName)
+			if err != nil {
+				return report.Fail(err)
+			}
+			if cases, err = cmdutil.SelectCases(cases, only); err != nil {
+				return report.Fail(err)
+			}
+			if len(cases) == 0 {
+				return report.Errorf("%s/%s has no test cases (add some with 'promptctl eval add')", vaultName, promptName)
+			}
+			goldens, err := db.GetSnapshots(pv.PromptID)
+			if err != nil {
+				return report.Errorf("failed to get golden responses: %w", err)
+			}
+
+			timeout, err := params.TimeLimit()
+			if err != nil {
+				return report.Errorf("invalid timeout: %w", err)
+			}
+			ctx := cmd.Context()
+			router, err := providers.GetProvider(ctx)
+			if err != nil {
+				return report.Errorf("failed to get provider: %w", err)
+			}
+			llm, err := params.Client(router)
+			if err != nil {
+				return report.Fail(err)
+			}
+
+			requests := make([]runner.Request, len(cases))
+			for i, c := range cases {
+				messages, err := runner.Render(pv, c.Vars)
+				if err != nil {
+					return report.Errorf("failed to render case %s: %w", c.Name, err)
+				}
+				requests[i] = params.Request(llm, pv, messages, c.Vars)
+				requests[i].GroupRow = i + 1
+				params.Cases = append(params.Cases, c.Name)
+			}
+
+			paramsJSON, _ := json.Marshal(params)
+			group := &db.RunGroup{Kind: db.RunGroupSnapshot, PromptVersionID: pv.ID, Params: string(paramsJSON)}
+			if err := db.CreateRunGroup(group); err != nil {
+				return report.Errorf("failed to create snapshot check: %w", err)
+			}
+			for i := range requests {
+				requests[i].GroupID = group.ID
+			}
+			target := params.Provider
+			if params.Options.Model != "" {
+				target += "/" + params.Options.Model
+			}
+			fmt.Printf("Snapshot check %d: %s/%s v%d, %d case(s) with %s, %s\n", group.ID, vaultName, promptName,
+				pv.Version, len(cases), target, matcher)
+
+			runs := runner.ExecuteAll(ctx, requests, concurrency, timeout, nil)
+
+			rep := report.New(db.RunGroupSnapshot, group.ID, fmt.Sprintf("%s/%s@v%d", vaultName, promptName, pv.Version),
+				params.Provider, params.Options.Model)
+			changed := 0
+			for i, c := range cases {
+				golden, hasGolden := goldens[c.Name]
+				result := checkCase(c.Name, runs[i], golden, hasGolden, matcher)
+				if result.Status == report.StatusFailed && result.RunStatus == db.RunStatusCompleted {
+					changed++
+				}
+				rep.Add(result)
+			}
+
+			code := rep.Finish(100)
+			for _, path := range reports {
+				if err := rep.Write(path); err != nil {
+					return report.Errorf("failed to write report: %w", err)
+				}
+			}
+			summary := rep.Summary
+			line := fmt.Sprintf("%d case(s): %d matched, %d failed", summary.Total, summary.Passed, summary.Failed)
+			if summary.Skipped > 0 {
+				line += fmt.Sprintf(", %d not run", summary.Skipped)
+			}
+			fmt.Println(line)
+			for _, path := range reports {
+				fmt.Printf("Report written to %s\n", path)
+			}
+			if changed > 0 {
+				fmt.Printf("Accept the new responses with 'promptctl snapshot update %s/%s'\n", vaultName, promptName)
+			}
+
+			switch code {
+			case report.ExitIncomplete:
+				log.Errorf("snapshot check %d was interrupted before %d case(s) ran", group.ID, summary.Skipped)
+			case report.ExitFailed:
+				log.Errorf("%d of %d cases failed the snapshot check", summary.Failed, summary.Total)
+			}
+			return report.Exit(code)
+		},
+	}
+
+	snapshotCheckCmd.Flags().StringArrayVar(&only, "case", nil, "Only check this case; repeat for several")
+	snapshotCheckCmd.Flags().StringVar(&matcher.Mode, "mode", snapshot.ModeExact, "How responses are compared: exact, whitespace or similarity")
+	snapshotCheckCmd.Flags().Float64Var(&matcher.Threshold, "threshold", 0.9, "Least similarity, from 0 to 1, of a matching response in similarity mode")
+	snapshotCheckCmd.Flags().IntVar(&concurrency, "concurrency", 4, "Number of cases to run at once")
+	snapshotCheckCmd.Flags().StringArrayVar(&reports, "report", nil, "Write a report to a .json, .xml (JUnit) or .tap file; repeat for several")
+	cmdutil.AddSettingFlags(snapshotCheckCmd, "every run of the check")
+
+	return cmdutil.Reporting(snapshotCheckCmd)
+}
+
+// checkCase compares the response of a case's run, nil if it never
+// started, with the case's golden, printing and returning the outcome.
+func checkCase(name string, r *db.Run, golden db.Snapshot, hasGolden bool, matcher snapshot.Matcher) report.Case {
+	c := report.Case{Name: name}
+	if r == nil {
+		fmt.Printf("  SKIP   %s: not run\n", name)
+		c.Status = report.StatusSkipped
+		c.Message = "not run"
+		return c
+	}
+	c.RunID = r.ID
+	c.RunStatus = r.Status
+	c.Duration = r.Duration.Seconds()
+
+	switch {
+	case r.Status == db.RunStatusCancelled:
+		fmt.Printf("  SKIP   %s (run %d): cancelled\n", name, r.ID)
+		c.Status = report.StatusSkipped
+		c.Message = "cancelled"
+	case r.Status != db.RunStatusCompleted:
+		fmt.Printf("  FAIL   %s (run %d): %s: %s\n", name, r.ID, r.Status, r.ErrorMessage)
+		c.Status = report.StatusFailed
+		c.Message = fmt.Sprintf("%s: %s", r.Status, r.ErrorMessage)
+	case !hasGolden:
+		fmt.Printf("  NEW    %s (run %d): no golden response\n", name, r.ID)
+		c.Status = report.StatusFailed
+		c.Message = "no golden response"
+	default:
+		matched, similarity := matcher.Match(golden.Response, r.Response)
+		detail := fmt.Sprintf("run %d", r.ID)
+		if matcher.Mode == snapshot.ModeSimilarity || !matched {
+			detail += fmt.Sprintf(", similarity %.2f", similarity)
+		}
+		if matched {
+			fmt.Printf("  PASS   %s (%s)\n", name, detail)
+			c.Status = report.StatusPassed
+			return c
+		}
+		fmt.Printf("  DRIFT  %s (%s)\n", name, detail)
+		diff := textdiff.Unified(golden.Response, r.Response, fmt.Sprintf("golden (run %d)", golden.RunID),
+			fmt.Sprintf("run %d", r.ID), diffContext)
+		if diff == "" {
+			diff = "The responses differ only in trailing newlines\n"
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+			fmt.Printf("         %s\n", line)
+		}
+		c.Status = report.StatusFailed
+		c.Message = fmt.Sprintf("response drifted from golden run %d (similarity %.2f)", golden.RunID, similarity)
+	}
+	return c
+}
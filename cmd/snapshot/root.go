@@ -0,0 +1,20 @@
+package snapshot
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func NewRootCmd() *cobra.Command {
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Check responses against approved golden responses",
+		Long:  `Approve a golden response for each test case of a prompt and check new responses against it.`,
+	}
+
+	snapshotCmd.AddCommand(NewCheckCmd())
+	snapshotCmd.AddCommand(NewListCmd())
+	snapshotCmd.AddCommand(NewPromoteCmd())
+	snapshotCmd.AddCommand(NewUpdateCmd())
+
+	return snapshotCmd
+}
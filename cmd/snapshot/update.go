@@ -0,0 +1,255 @@
+package snapshot
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/cmdutil"
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/eval"
+	"github.com/farbodsalimi/promptctl/internal/runner"
+)
+
+func NewUpdateCmd() *cobra.Command {
+	var (
+		only    []string
+		checkID int
+	)
+
+	snapshotUpdateCmd := &cobra.Command{
+		Use:   "update <vault>/<name>",
+		Short: "Accept the responses of a snapshot check as golden responses",
+		Long: `Accept the responses of the latest snapshot check of a prompt, or of the
+check given with --check, as the golden responses of their cases. Only the
+responses that drifted or had no golden are accepted, unless cases are
+named with --case, whose responses are accepted whatever they are.`,
+		Args: cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			vaultName, promptName, err := cmdutil.PromptArgs(args)
+			if err != nil {
+				log.Fatal(err)
+			}
+			prompt, err := db.GetPromptByName(vaultName, promptName)
+			if errors.Is(err, sql.ErrNoRows) {
+				log.Fatalf("prompt not found: %s/%s", vaultName, promptName)
+			}
+			if err != nil {
+				log.Fatalf("failed to get prompt: %v", err)
+			}
+
+			var group *db.RunGroup
+			if checkID > 0 {
+				group, err = db.GetRunGroup(checkID)
+				if errors.Is(err, sql.ErrNoRows) || (err == nil && group.Kind != db.RunGroupSnapshot) {
+					log.Fatalf("snapshot check not found: %d", checkID)
+				}
+			} else {
+				group, err = db.GetLatestRunGroup(db.RunGroupSnapshot, prompt.ID)
+				if errors.Is(err, sql.ErrNoRows) {
+					log.Fatalf("%s/%s has no snapshot check (run 'promptctl snapshot check %s/%s')",
+						vaultName, promptName, vaultName, promptName)
+				}
+			}
+			if err != nil {
+				log.Fatalf("failed to get snapshot check: %v", err)
+			}
+			var params checkParams
+			if err := json.Unmarshal([]byte(group.Params), &params); err != nil {
+				log.Fatalf("invalid settings of snapshot check %d: %v", group.ID, err)
+			}
+			if params.Vault != vaultName || params.Prompt != promptName {
+				log.Fatalf("snapshot check %d checked %s/%s, not %s/%s", group.ID, params.Vault, params.Prompt, vaultName, promptName)
+			}
+			for _, name := range only {
+				if !slices.Contains(params.Cases, name) {
+					log.Fatalf("case %s was not checked by snapshot check %d", name, group.ID)
+				}
+			}
+
+			runs, err := db.GetGroupRuns(group.ID)
+			if err != nil {
+				log.Fatalf("failed to get runs of snapshot check %d: %v", group.ID, err)
+			}
+			goldens, err := db.GetSnapshots(prompt.ID)
+			if err != nil {
+				log.Fatalf("failed to get golden responses: %v", err)
+			}
+
+			accepted := 0
+			for _, r := range runs {
+				name := params.Cases[r.GroupRow-1]
+				named := slices.Contains(only, name)
+				if len(only) > 0 && !named {
+					continue
+				}
+				if r.Status != db.RunStatusCompleted {
+					if named {
+						log.Warnf("case %s: run %d did not complete; keeping its golden response", name, r.ID)
+					}
+					continue
+				}
+				golden, hasGolden := goldens[name]
+				if hasGolden && !named {
+					if matched, _ := params.Matcher.Match(golden.Response, r.Response); matched {
+						continue
+					}
+				}
+				if err := db.SaveSnapshot(prompt.ID, name, r.ID); err != nil {
+					log.Fatalf("failed to save golden response of case %s: %v", name, err)
+				}
+				accepted++
+				if hasGolden {
+					fmt.Printf("  %s: run %d (was run %d)\n", name, r.ID, golden.RunID)
+				} else {
+					fmt.Printf("  %s: run %d (new)\n", name, r.ID)
+				}
+			}
+			if accepted == 0 {
+				fmt.Printf("No new responses of %s/%s to accept from snapshot check %d\n", vaultName, promptName, group.ID)
+				return
+			}
+			fmt.Printf("Updated %d golden response(s) of %s/%s from snapshot check %d\n", accepted, vaultName, promptName, group.ID)
+		},
+	}
+
+	snapshotUpdateCmd.Flags().StringArrayVar(&only, "case", nil, "Accept the response of this case; repeat for several")
+	snapshotUpdateCmd.Flags().IntVar(&checkID, "check", 0, "Snapshot check to accept responses from (default: the latest)")
+
+	return snapshotUpdateCmd
+}
+
+func NewPromoteCmd() *cobra.Command {
+	var caseName string
+
+	snapshotPromoteCmd := &cobra.Command{
+		Use:   "promote <run>",
+		Short: "Make a run's response the golden response of a test case",
+		Long: `Make the response of a completed run the golden response of a test case of
+its prompt. The case is the one the run was made for by 'promptctl eval
+run' or 'promptctl snapshot check', or the one named with --case.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.Atoi(args[0])
+			if err != nil {
+				log.Fatalf("invalid run ID: %s", args[0])
+			}
+			r, err := db.GetRunByID(id)
+			if errors.Is(err, sql.ErrNoRows) {
+				log.Fatalf("run not found: %d", id)
+			}
+			if err != nil {
+				log.Fatalf("failed to get run: %v", err)
+			}
+			if r.Status != db.RunStatusCompleted {
+				log.Fatalf("run %d did not complete (%s)", r.ID, r.Status)
+			}
+			if caseName == "" {
+				caseName = caseOf(r)
+			}
+			if caseName == "" {
+				log.Fatalf("run %d was not made for a test case; name one with --case", r.ID)
+			}
+
+			cases, err := cmdutil.LoadCases(r.VaultName, r.PromptName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			i := slices.IndexFunc(cases, func(c eval.Case) bool { return c.Name == caseName })
+			if i < 0 {
+				log.Fatalf("case not found: %s", caseName)
+			}
+			var params runner.Params
+			if err := json.Unmarshal([]byte(r.Params), &params); err == nil {
+				runVars, _ := json.Marshal(params.Vars)
+				caseVars, _ := json.Marshal(cases[i].Vars)
+				if string(runVars) != string(caseVars) {
+					log.Warnf("run %d was made with other variables than case %s", r.ID, caseName)
+				}
+			}
+
+			pv, err := db.GetPromptVersionByID(r.PromptVersionID)
+			if err != nil {
+				log.Fatalf("failed to get prompt version: %v", err)
+			}
+			if err := db.SaveSnapshot(pv.PromptID, caseName, r.ID); err != nil {
+				log.Fatalf("failed to save golden response: %v", err)
+			}
+			fmt.Printf("Run %d is the golden response of case '%s' of %s/%s\n", r.ID, caseName, r.VaultName, r.PromptName)
+		},
+	}
+
+	snapshotPromoteCmd.Flags().StringVar(&caseName, "case", "", "Test case the run's response becomes the golden of")
+
+	return snapshotPromoteCmd
+}
+
+// caseOf returns the test case a run was made for by an evaluation or a
+// snapshot check, or "" if it was not.
+func caseOf(r *db.Run) string {
+	switch r.GroupKind {
+	case db.RunGroupEval:
+		if result, err := db.GetEvalResult(r.ID); err == nil {
+			return result.Case
+		}
+	case db.RunGroupSnapshot:
+		group, err := db.GetRunGroup(r.GroupID)
+		if err != nil {
+			return ""
+		}
+		var params checkParams
+		if err := json.Unmarshal([]byte(group.Params), &params); err == nil && r.GroupRow <= len(params.Cases) {
+			return params.Cases[r.GroupRow-1]
+		}
+	}
+	return ""
+}
+
+func NewListCmd() *cobra.Command {
+	snapshotListCmd := &cobra.Command{
+		Use:   "list <vault>/<name>",
+		Short: "List the golden responses of a prompt's test cases",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			vaultName, promptName, err := cmdutil.PromptArgs(args)
+			if err != nil {
+				log.Fatal(err)
+			}
+			prompt, err := db.GetPromptByName(vaultName, promptName)
+			if errors.Is(err, sql.ErrNoRows) {
+				log.Fatalf("prompt not found: %s/%s", vaultName, promptName)
+			}
+			if err != nil {
+				log.Fatalf("failed to get prompt: %v", err)
+			}
+			goldens, err := db.GetSnapshots(prompt.ID)
+			if err != nil {
+				log.Fatalf("failed to get golden responses: %v", err)
+			}
+			cases, err := cmdutil.LoadCases(vaultName, promptName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(cases) == 0 {
+				fmt.Printf("Prompt %s/%s has no test cases\n", vaultName, promptName)
+				return
+			}
+			fmt.Printf("Golden responses of %s/%s:\n", vaultName, promptName)
+			for _, c := range cases {
+				golden, ok := goldens[c.Name]
+				if !ok {
+					fmt.Printf("  %s: none\n", c.Name)
+					continue
+				}
+				fmt.Printf("  %s: run %d, v%d (updated: %s)\n", c.Name, golden.RunID, golden.Version, golden.Updated)
+			}
+		},
+	}
+	return snapshotListCmd
+}
@@ -0,0 +1,44 @@
+package cmdutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/eval"
+)
+
+// LoadCases returns the evaluation suite of a prompt.
+func LoadCases(vaultName, promptName string) ([]eval.Case, error) {
+	stored, err := db.GetEvalCases(vaultName, promptName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get test cases: %w", err)
+	}
+	cases := make([]eval.Case, 0, len(stored))
+	for _, s := range stored {
+		c := eval.Case{Name: s.Name}
+		if err := json.Unmarshal([]byte(s.Vars), &c.Vars); err != nil {
+			return nil, fmt.Errorf("case %s: invalid variables: %w", s.Name, err)
+		}
+		if err := json.Unmarshal([]byte(s.Assertions), &c.Assert); err != nil {
+			return nil, fmt.Errorf("case %s: invalid assertions: %w", s.Name, err)
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+// SelectCases keeps the cases named by --case, or all of them when none
+// are named.
+func SelectCases(cases []eval.Case, names []string) ([]eval.Case, error) {
+	if len(names) == 0 {
+		return cases, nil
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(cases, func(c eval.Case) bool { return c.Name == name }) {
+			return nil, fmt.Errorf("case not found: %s", name)
+		}
+	}
+	return slices.DeleteFunc(cases, func(c eval.Case) bool { return !slices.Contains(names, c.Name) }), nil
+}
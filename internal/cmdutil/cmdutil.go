@@ -0,0 +1,137 @@
+// Package cmdutil holds the argument parsing and flags shared by the
+// commands of promptctl.
+package cmdutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+	"github.com/farbodsalimi/promptctl/internal/runner"
+)
+
+// SettingFlags are the flags read by ReadSettings.
+var SettingFlags = []string{
+	"provider", "account", "model", "timeout", "tag",
+	"temperature", "max-tokens", "top-p", "stop", "seed",
+}
+
+// AddSettingFlags registers the flags read by ReadSettings. what names the
+// runs, as in "every run of the batch".
+func AddSettingFlags(cmd *cobra.Command, what string) {
+	cmd.Flags().StringP("provider", "p", "", "LLM provider to use, as for 'run prompt' (default: the prompt's chain, then the profile default)")
+	cmd.Flags().String("account", "", "Named provider account to use")
+	cmd.Flags().StringP("model", "m", "", "Model name (default: the profile default)")
+	cmd.Flags().StringArray("tag", nil, fmt.Sprintf("Tag %s; repeat for several", what))
+	cmd.Flags().Duration("timeout", 0, "Give up on a run after this long, e.g. 30s (default: no limit)")
+	AddGenerationFlags(cmd)
+}
+
+// ReadSettings reads the settings of runs of a prompt from their flags,
+// falling back to the prompt's fallback chain and the profile defaults.
+func ReadSettings(cmd *cobra.Command, vaultName, promptName string) (runner.Settings, error) {
+	var settings runner.Settings
+	flags := cmd.Flags()
+	settings.Provider, _ = flags.GetString("provider")
+	settings.Account, _ = flags.GetString("account")
+	model, _ := flags.GetString("model")
+	timeout, _ := flags.GetDuration("timeout")
+	settings.Tags, _ = flags.GetStringArray("tag")
+	for _, tag := range settings.Tags {
+		if err := db.ValidateTag(tag); err != nil {
+			return settings, err
+		}
+	}
+	if timeout < 0 {
+		return settings, fmt.Errorf("timeout must not be negative")
+	}
+	if timeout > 0 {
+		settings.Timeout = timeout.String()
+	}
+
+	var err error
+	settings.Options, err = GenerationOptions(cmd)
+	if err != nil {
+		return settings, err
+	}
+	settings.Options.Model = model
+	return settings, runner.ResolveSettings(&settings, vaultName, promptName)
+}
+
+// PromptArgs reads a prompt given as <vault>/<name> or as <vault> <name>.
+func PromptArgs(args []string) (string, string, error) {
+	switch len(args) {
+	case 1:
+		vault, name, ok := strings.Cut(args[0], "/")
+		if ok && vault != "" && name != "" {
+			return vault, name, nil
+		}
+	case 2:
+		return args[0], args[1], nil
+	}
+	return "", "", fmt.Errorf("expected a prompt as <vault>/<name>")
+}
+
+// PromptRef parses a prompt written as <vault>/<name>, optionally followed
+// by @<version> or @v<version>. The version is 0 when not given.
+func PromptRef(ref string) (string, string, int, error) {
+	ref, versionText, hasVersion := strings.Cut(ref, "@")
+	vaultName, promptName, err := PromptArgs([]string{ref})
+	if err != nil || !hasVersion {
+		return vaultName, promptName, 0, err
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(versionText, "v"))
+	if err != nil || version < 1 {
+		return "", "", 0, fmt.Errorf("invalid version %q", versionText)
+	}
+	return vaultName, promptName, version, nil
+}
+
+// GenerationOptions reads the generation flags, leaving unset flags to the
+// provider's defaults.
+func GenerationOptions(cmd *cobra.Command) (providers.Options, error) {
+	var opts providers.Options
+	flags := cmd.Flags()
+
+	if flags.Changed("temperature") {
+		temperature, _ := flags.GetFloat64("temperature")
+		if temperature < 0 || temperature > 2 {
+			return opts, fmt.Errorf("temperature must be between 0.0 and 2.0")
+		}
+		opts.Temperature = &temperature
+	}
+	if flags.Changed("max-tokens") {
+		maxTokens, _ := flags.GetInt("max-tokens")
+		if maxTokens <= 0 {
+			return opts, fmt.Errorf("max-tokens must be positive")
+		}
+		opts.MaxTokens = &maxTokens
+	}
+	if flags.Changed("top-p") {
+		topP, _ := flags.GetFloat64("top-p")
+		if topP < 0 || topP > 1 {
+			return opts, fmt.Errorf("top-p must be between 0.0 and 1.0")
+		}
+		opts.TopP = &topP
+	}
+	if flags.Changed("seed") {
+		seed, _ := flags.GetInt64("seed")
+		opts.Seed = &seed
+	}
+	opts.Stop, _ = flags.GetStringArray("stop")
+
+	return opts, nil
+}
+
+// AddGenerationFlags registers the flags read by GenerationOptions.
+func AddGenerationFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64P("temperature", "t", 0, "Sampling temperature (0.0-2.0, higher = more creative; default: provider default, not 0.7)")
+	cmd.Flags().Int("max-tokens", 0, "Maximum number of tokens to generate (default: provider default)")
+	cmd.Flags().Float64("top-p", 0, "Nucleus sampling probability mass (0.0-1.0; default: provider default)")
+	cmd.Flags().StringArray("stop", nil, "Stop sequence; repeat for several")
+	cmd.Flags().Int64("seed", 0, "Seed for deterministic sampling, where the provider supports it")
+}
@@ -0,0 +1,37 @@
+package cmdutil
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/farbodsalimi/promptctl/internal/report"
+)
+
+// Reporting marks cmd as a command that reports results, whose exit code
+// tells their outcome apart from errors: bad flags and arguments, and
+// failing to load the configuration, end it with report.ExitError like
+// the errors its RunE returns with report.Fail.
+func Reporting(cmd *cobra.Command) *cobra.Command {
+	cmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return report.Fail(err)
+	})
+	if args := cmd.Args; args != nil {
+		cmd.Args = func(cmd *cobra.Command, a []string) error {
+			if err := args(cmd, a); err != nil {
+				return report.Fail(err)
+			}
+			return nil
+		}
+	}
+	// The command's own hook replaces the root's, which loads the
+	// configuration.
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		if root := cmd.Root(); root.PersistentPreRunE != nil {
+			if err := root.PersistentPreRunE(cmd, args); err != nil {
+				return report.Fail(err)
+			}
+		}
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,165 @@
+package credstore
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// The agent keeps an unlocked data key in memory and hands it to other
+// promptctl processes over a Unix socket, the way ssh-agent does for
+// private keys, so the passphrase is typed once per session.
+
+// AgentSocketEnv overrides the agent socket path.
+const AgentSocketEnv = "PROMPTCTL_AGENT_SOCK"
+
+const agentDialTimeout = 2 * time.Second
+
+// AgentSocketPath returns $PROMPTCTL_AGENT_SOCK or
+// ~/.promptctl/agent/agent.sock.
+func AgentSocketPath() (string, error) {
+	if path := os.Getenv(AgentSocketEnv); path != "" {
+		return path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".promptctl", "agent", "agent.sock"), nil
+}
+
+// ServeAgent serves dataKey on socketPath until ttl elapses or a client asks
+// the agent to stop.
+func ServeAgent(socketPath string, dataKey []byte, ttl time.Duration) error {
+	// A socket left behind by an agent that did not shut down cleanly
+	// would make Listen fail.
+	if _, err := AgentKey(socketPath); err != nil {
+		os.Remove(socketPath)
+	}
+
+	// The socket is created with the umask's permissions and only then
+	// restricted, so it must live in a directory other users cannot enter.
+	if err := PrepareAgentDir(socketPath); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-time.After(ttl):
+		case <-stop:
+		}
+		listener.Close()
+	}()
+
+	encoded := base64.StdEncoding.EncodeToString(dataKey)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return nil
+		}
+		if handleAgentConn(conn, encoded) {
+			close(stop)
+			return nil
+		}
+	}
+}
+
+// PrepareAgentDir creates the directory of socketPath, accessible only to
+// the current user, or checks that an existing one is.
+func PrepareAgentDir(socketPath string) error {
+	dir := filepath.Dir(socketPath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	// Windows does not report access by other users in the mode bits.
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s is accessible to other users; the agent socket needs a directory only you can access", dir)
+	}
+	return nil
+}
+
+// handleAgentConn answers a single request and reports whether it asked
+// the agent to stop.
+func handleAgentConn(conn net.Conn, encodedKey string) bool {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(agentDialTimeout))
+
+	request, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	switch strings.TrimSpace(request) {
+	case "key":
+		fmt.Fprintln(conn, encodedKey)
+	case "stop":
+		fmt.Fprintln(conn, "ok")
+		return true
+	default:
+		fmt.Fprintln(conn, "error unknown request")
+	}
+	return false
+}
+
+// AgentKey fetches the data key from a running agent.
+func AgentKey(socketPath string) ([]byte, error) {
+	response, err := agentRequest(socketPath, "key")
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(response)
+}
+
+// StopAgent asks a running agent to forget its key and exit. It is not an
+// error if no agent is running.
+func StopAgent(socketPath string) error {
+	_, err := agentRequest(socketPath, "stop")
+	if errors.Is(err, errNoAgent) {
+		return nil
+	}
+	return err
+}
+
+var errNoAgent = errors.New("no agent running")
+
+func agentRequest(socketPath, request string) (string, error) {
+	conn, err := net.DialTimeout("unix", socketPath, agentDialTimeout)
+	if err != nil {
+		return "", errNoAgent
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(agentDialTimeout))
+
+	if _, err := fmt.Fprintln(conn, request); err != nil {
+		return "", err
+	}
+	response, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	response = strings.TrimSpace(response)
+	if strings.HasPrefix(response, "error ") {
+		return "", errors.New(strings.TrimPrefix(response, "error "))
+	}
+	return response, nil
+}
@@ -0,0 +1,335 @@
+// Package credstore keeps provider API keys in an encrypted file.
+//
+// Secrets are encrypted with AES-256-GCM under a random per-user data key.
+// The data key is itself wrapped with AES-256-GCM under a key derived from
+// the user's passphrase with scrypt, so changing the passphrase only
+// re-wraps the data key. The names of stored secrets are kept in the clear
+// so callers can tell where a key comes from without unlocking the store.
+package credstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	envelopeVersion = 1
+	keySize         = 32
+	saltSize        = 16
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var (
+	ErrLocked          = errors.New("credential store is locked")
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	ErrNotInitialized  = errors.New("credential store has not been created")
+	ErrAlreadyExists   = errors.New("credential store already exists")
+)
+
+type kdfParams struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// check rejects key derivation parameters other than those wrap writes, so
+// that a tampered store cannot make Unlock spend unbounded memory or time.
+func (k kdfParams) check() error {
+	if k.Name != "scrypt" || k.N != scryptN || k.R != scryptR || k.P != scryptP || len(k.Salt) != saltSize {
+		return fmt.Errorf("unsupported key derivation %s (n=%d, r=%d, p=%d, %d-byte salt)", k.Name, k.N, k.R, k.P, len(k.Salt))
+	}
+	return nil
+}
+
+// envelope is the on-disk format. Byte slices are base64 encoded by
+// encoding/json; ciphertexts are prefixed with their GCM nonce.
+type envelope struct {
+	Version    int       `json:"version"`
+	KDF        kdfParams `json:"kdf"`
+	WrappedKey []byte    `json:"wrapped_key"`
+	Names      []string  `json:"names"`
+	Data       []byte    `json:"data"`
+}
+
+type Store struct {
+	path     string
+	exists   bool
+	envelope envelope
+	dataKey  []byte
+	secrets  map[string]string
+}
+
+// DefaultPath returns ~/.promptctl/credentials.enc.
+func DefaultPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".promptctl", "credentials.enc"), nil
+}
+
+// Open reads the store at path without unlocking it. A missing file yields
+// an empty store for which Exists reports false.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &s.envelope); err != nil {
+		return nil, fmt.Errorf("invalid credential store %s: %w", path, err)
+	}
+	if s.envelope.Version != envelopeVersion {
+		return nil, fmt.Errorf("unsupported credential store version %d", s.envelope.Version)
+	}
+	if err := s.envelope.KDF.check(); err != nil {
+		return nil, fmt.Errorf("invalid credential store %s: %w", path, err)
+	}
+	s.exists = true
+	return s, nil
+}
+
+func (s *Store) Path() string {
+	return s.path
+}
+
+func (s *Store) Exists() bool {
+	return s.exists
+}
+
+func (s *Store) Unlocked() bool {
+	return s.dataKey != nil
+}
+
+// Has reports whether a secret is stored under name. It does not require
+// the store to be unlocked.
+func (s *Store) Has(name string) bool {
+	for _, n := range s.envelope.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns the names of the stored secrets. It does not require the
+// store to be unlocked.
+func (s *Store) Names() []string {
+	return slices.Clone(s.envelope.Names)
+}
+
+// Init creates a new data key protected by passphrase. The store is left
+// unlocked and must be saved.
+func (s *Store) Init(passphrase string) error {
+	if s.exists {
+		return ErrAlreadyExists
+	}
+
+	s.dataKey = make([]byte, keySize)
+	if _, err := rand.Read(s.dataKey); err != nil {
+		return err
+	}
+	s.secrets = make(map[string]string)
+	s.envelope = envelope{Version: envelopeVersion}
+	return s.wrap(passphrase)
+}
+
+// Unlock decrypts the store with passphrase.
+func (s *Store) Unlock(passphrase string) error {
+	if !s.exists {
+		return ErrNotInitialized
+	}
+
+	kdf := s.envelope.KDF
+	if err := kdf.check(); err != nil {
+		return err
+	}
+	kek, err := scrypt.Key([]byte(passphrase), kdf.Salt, kdf.N, kdf.R, kdf.P, keySize)
+	if err != nil {
+		return err
+	}
+	dataKey, err := open(kek, s.envelope.WrappedKey)
+	if err != nil {
+		return ErrWrongPassphrase
+	}
+	return s.UnlockWithKey(dataKey)
+}
+
+// UnlockWithKey decrypts the store with a data key previously obtained from
+// Key, for example one cached by the agent.
+func (s *Store) UnlockWithKey(dataKey []byte) error {
+	if !s.exists {
+		return ErrNotInitialized
+	}
+
+	plaintext, err := open(dataKey, s.envelope.Data)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt credential store: %w", err)
+	}
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return fmt.Errorf("invalid credential store contents: %w", err)
+	}
+
+	s.dataKey = dataKey
+	s.secrets = secrets
+	return nil
+}
+
+// Key returns the data key of an unlocked store.
+func (s *Store) Key() ([]byte, error) {
+	if !s.Unlocked() {
+		return nil, ErrLocked
+	}
+	return s.dataKey, nil
+}
+
+func (s *Store) Get(name string) (string, error) {
+	if !s.Unlocked() {
+		return "", ErrLocked
+	}
+	return s.secrets[name], nil
+}
+
+func (s *Store) Set(name, secret string) error {
+	if !s.Unlocked() {
+		return ErrLocked
+	}
+	s.secrets[name] = secret
+	return nil
+}
+
+func (s *Store) Delete(name string) error {
+	if !s.Unlocked() {
+		return ErrLocked
+	}
+	delete(s.secrets, name)
+	return nil
+}
+
+// Rewrap protects the existing data key with a new passphrase. The store
+// must be unlocked and saved afterwards.
+func (s *Store) Rewrap(passphrase string) error {
+	if !s.Unlocked() {
+		return ErrLocked
+	}
+	return s.wrap(passphrase)
+}
+
+// Save encrypts the secrets and writes the store with owner-only
+// permissions.
+func (s *Store) Save() error {
+	if !s.Unlocked() {
+		return ErrLocked
+	}
+
+	plaintext, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+	s.envelope.Data, err = seal(s.dataKey, plaintext)
+	if err != nil {
+		return err
+	}
+
+	s.envelope.Names = s.envelope.Names[:0]
+	for name := range s.secrets {
+		s.envelope.Names = append(s.envelope.Names, name)
+	}
+	sort.Strings(s.envelope.Names)
+
+	data, err := json.MarshalIndent(s.envelope, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.exists = true
+	return nil
+}
+
+// wrap derives a key from passphrase with a fresh salt and encrypts the
+// data key with it.
+func (s *Store) wrap(passphrase string) error {
+	if passphrase == "" {
+		return errors.New("passphrase must not be empty")
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	kek, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return err
+	}
+	wrapped, err := seal(kek, s.dataKey)
+	if err != nil {
+		return err
+	}
+
+	s.envelope.KDF = kdfParams{Name: "scrypt", Salt: salt, N: scryptN, R: scryptR, P: scryptP}
+	s.envelope.WrappedKey = wrapped
+	return nil
+}
+
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,338 @@
+package credstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newStore creates, fills and saves a store at a temporary path and returns
+// the path.
+func newStore(t *testing.T, passphrase string, secrets map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Exists() {
+		t.Fatal("new store exists")
+	}
+	if err := s.Init(passphrase); err != nil {
+		t.Fatal(err)
+	}
+	for name, secret := range secrets {
+		if err := s.Set(name, secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// openStore opens the store at path and unlocks it with passphrase.
+func openStore(t *testing.T, path, passphrase string) *Store {
+	t.Helper()
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Unlock(passphrase); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	return s
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	secrets := map[string]string{"openai": "sk-1", "profile/work/anthropic": "sk-2"}
+	path := newStore(t, "pw", secrets)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("store mode = %v, want 0600", info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range secrets {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("secret %q is stored in the clear", secret)
+		}
+	}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Exists() || s.Unlocked() {
+		t.Fatalf("opened store: exists %t, unlocked %t", s.Exists(), s.Unlocked())
+	}
+	// Names are readable while locked; secrets are not.
+	if want := []string{"openai", "profile/work/anthropic"}; !slices.Equal(s.Names(), want) {
+		t.Errorf("names = %v, want %v", s.Names(), want)
+	}
+	if !s.Has("openai") || s.Has("google") {
+		t.Error("Has does not match the stored names")
+	}
+	if _, err := s.Get("openai"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Get on a locked store: %v, want ErrLocked", err)
+	}
+
+	if err := s.Unlock("pw"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	for name, want := range secrets {
+		if got, err := s.Get(name); err != nil || got != want {
+			t.Errorf("Get(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+
+	// Changes survive another save and open.
+	if err := s.Delete("openai"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("google", "key-3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	s = openStore(t, path, "pw")
+	if want := []string{"google", "profile/work/anthropic"}; !slices.Equal(s.Names(), want) {
+		t.Errorf("names after save = %v, want %v", s.Names(), want)
+	}
+	if got, _ := s.Get("google"); got != "key-3" {
+		t.Errorf("google = %q, want key-3", got)
+	}
+}
+
+func TestStoreInitErrors(t *testing.T) {
+	path := newStore(t, "pw", nil)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init("pw"); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Init over an existing store: %v, want ErrAlreadyExists", err)
+	}
+
+	missing, err := Open(filepath.Join(t.TempDir(), "missing.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := missing.Unlock("pw"); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Unlock of a missing store: %v, want ErrNotInitialized", err)
+	}
+	if err := missing.Init(""); err == nil {
+		t.Error("Init accepted an empty passphrase")
+	}
+}
+
+func TestStoreWrongPassphrase(t *testing.T) {
+	path := newStore(t, "right", map[string]string{"openai": "sk-1"})
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, passphrase := range []string{"wrong", "", "right "} {
+		if err := s.Unlock(passphrase); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("Unlock(%q) = %v, want ErrWrongPassphrase", passphrase, err)
+		}
+	}
+	if s.Unlocked() {
+		t.Error("store unlocked after wrong passphrases")
+	}
+}
+
+func TestStoreRewrap(t *testing.T) {
+	path := newStore(t, "old", map[string]string{"openai": "sk-1"})
+	s := openStore(t, path, "old")
+	key, err := s.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rewrap("new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Unlock("old"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Unlock with the old passphrase: %v, want ErrWrongPassphrase", err)
+	}
+	if err := reopened.Unlock("new"); err != nil {
+		t.Fatalf("Unlock with the new passphrase: %v", err)
+	}
+	if got, _ := reopened.Get("openai"); got != "sk-1" {
+		t.Errorf("openai = %q after rewrap, want sk-1", got)
+	}
+	// Only the wrapping changes, so keys cached by an agent stay valid.
+	newKey, _ := reopened.Key()
+	if string(newKey) != string(key) {
+		t.Error("rewrap changed the data key")
+	}
+
+	locked, _ := Open(path)
+	if err := locked.Rewrap("newer"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Rewrap of a locked store: %v, want ErrLocked", err)
+	}
+}
+
+func TestStoreUnlockWithKey(t *testing.T) {
+	path := newStore(t, "pw", map[string]string{"openai": "sk-1"})
+	key, err := openStore(t, path, "pw").Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ := Open(path)
+	if err := s.UnlockWithKey(key); err != nil {
+		t.Fatalf("UnlockWithKey: %v", err)
+	}
+	if got, _ := s.Get("openai"); got != "sk-1" {
+		t.Errorf("openai = %q, want sk-1", got)
+	}
+
+	other, _ := Open(path)
+	wrongKey := make([]byte, keySize)
+	if err := other.UnlockWithKey(wrongKey); err == nil {
+		t.Error("UnlockWithKey accepted the wrong key")
+	}
+	if other.Unlocked() {
+		t.Error("store unlocked with the wrong key")
+	}
+}
+
+func TestOpenRejectsKDFParameters(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		change func(*kdfParams)
+	}{
+		{"huge n", func(k *kdfParams) { k.N = 1 << 30 }},
+		{"small n", func(k *kdfParams) { k.N = 2 }},
+		{"huge r", func(k *kdfParams) { k.R = 1 << 20 }},
+		{"huge p", func(k *kdfParams) { k.P = 1 << 20 }},
+		{"other kdf", func(k *kdfParams) { k.Name = "pbkdf2" }},
+		{"short salt", func(k *kdfParams) { k.Salt = k.Salt[:4] }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := newStore(t, "pw", nil)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var e envelope
+			if err := json.Unmarshal(data, &e); err != nil {
+				t.Fatal(err)
+			}
+			tt.change(&e.KDF)
+			data, _ = json.Marshal(e)
+			if err := os.WriteFile(path, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			if _, err := Open(path); err == nil {
+				t.Error("Open accepted the parameters")
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Open took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestAgentUnlock(t *testing.T) {
+	path := newStore(t, "pw", map[string]string{"openai": "sk-1"})
+	key, err := openStore(t, path, "pw").Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socketPath := filepath.Join(t.TempDir(), "agent", "agent.sock")
+	done := make(chan error, 1)
+	go func() { done <- ServeAgent(socketPath, key, time.Minute) }()
+	t.Cleanup(func() { StopAgent(socketPath) })
+
+	var got []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if got, err = AgentKey(socketPath); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("AgentKey: %v", err)
+	}
+	if string(got) != string(key) {
+		t.Fatal("agent returned another key")
+	}
+	info, err := os.Stat(filepath.Dir(socketPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("agent directory mode = %v, want 0700", info.Mode().Perm())
+	}
+
+	// UnlockAuto takes the key from the agent when no passphrase is set.
+	t.Setenv(PassphraseEnv, "")
+	t.Setenv(AgentSocketEnv, socketPath)
+	s, _ := Open(path)
+	if err := s.UnlockAuto(); err != nil {
+		t.Fatalf("UnlockAuto: %v", err)
+	}
+	if secret, _ := s.Get("openai"); secret != "sk-1" {
+		t.Errorf("openai = %q, want sk-1", secret)
+	}
+
+	if err := StopAgent(socketPath); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ServeAgent: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent did not stop")
+	}
+	if _, err := AgentKey(socketPath); err == nil {
+		t.Error("agent still answers after stopping")
+	}
+	if err := StopAgent(socketPath); err != nil {
+		t.Errorf("StopAgent without an agent: %v", err)
+	}
+}
+
+func TestPrepareAgentDirRejectsSharedDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows does not report access by other users in the mode bits")
+	}
+	dir := filepath.Join(t.TempDir(), "agent")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := PrepareAgentDir(filepath.Join(dir, "agent.sock")); err == nil {
+		t.Error("PrepareAgentDir accepted a directory other users can enter")
+	}
+}
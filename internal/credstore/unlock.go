@@ -0,0 +1,99 @@
+package credstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// PassphraseEnv supplies the passphrase non-interactively, for CI.
+// NewPassphraseEnv does the same for the new passphrase when rotating.
+const (
+	PassphraseEnv    = "PROMPTCTL_PASSPHRASE"
+	NewPassphraseEnv = "PROMPTCTL_NEW_PASSPHRASE"
+)
+
+// CurrentPassphrase returns PROMPTCTL_PASSPHRASE if set, or reads the
+// passphrase from the terminal.
+func CurrentPassphrase(prompt string) (string, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	return ReadPassphrase(prompt)
+}
+
+// UnlockAuto unlocks the store with, in order: the passphrase in
+// PROMPTCTL_PASSPHRASE, the data key held by a running agent, or a
+// passphrase typed at the terminal.
+func (s *Store) UnlockAuto() error {
+	if s.Unlocked() {
+		return nil
+	}
+	if !s.exists {
+		return ErrNotInitialized
+	}
+
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return s.Unlock(passphrase)
+	}
+
+	if socketPath, err := AgentSocketPath(); err == nil {
+		if dataKey, err := AgentKey(socketPath); err == nil {
+			if err := s.UnlockWithKey(dataKey); err == nil {
+				return nil
+			}
+		}
+	}
+
+	passphrase, err := ReadPassphrase("Credential store passphrase: ")
+	if err != nil {
+		return err
+	}
+	return s.Unlock(passphrase)
+}
+
+// NewPassphrase returns the value of envVar if set, or asks for a new
+// passphrase twice at the terminal.
+func NewPassphrase(envVar, prompt string) (string, error) {
+	if passphrase := os.Getenv(envVar); passphrase != "" {
+		return passphrase, nil
+	}
+
+	passphrase, err := ReadPassphrase(prompt)
+	if err != nil {
+		return "", err
+	}
+	confirm, err := ReadPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase != confirm {
+		return "", errors.New("passphrases do not match")
+	}
+	if passphrase == "" {
+		return "", errors.New("passphrase must not be empty")
+	}
+	return passphrase, nil
+}
+
+// ReadPassphrase reads a passphrase from the terminal without echoing it.
+func ReadPassphrase(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf(
+			"%w: set %s or run 'promptctl provider unlock'",
+			ErrLocked,
+			PassphraseEnv,
+		)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(passphrase), nil
+}
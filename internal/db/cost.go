@@ -0,0 +1,55 @@
+package db
+
+import "time"
+
+// CostSummary totals the runs of one provider and model.
+type CostSummary struct {
+	Provider         string
+	Model            string
+	Runs             int
+	PromptTokens     int
+	CompletionTokens int
+	// Cost is in US dollars. Unpriced counts the runs with token usage but
+	// no cost because their model had no price.
+	Cost       float64
+	Unpriced   int
+	AvgLatency time.Duration
+}
+
+// GetCostSummary totals the runs selected by filter by provider and model,
+// most expensive first.
+func GetCostSummary(filter RunFilter) ([]CostSummary, error) {
+	where, args := filter.where()
+	query := `
+		SELECT r.provider, COALESCE(r.model, ''), COUNT(*),
+		       COALESCE(SUM(r.prompt_tokens), 0), COALESCE(SUM(r.completion_tokens), 0),
+		       COALESCE(SUM(r.cost), 0),
+		       COUNT(CASE WHEN r.cost IS NULL AND (r.prompt_tokens > 0 OR r.completion_tokens > 0) THEN 1 END),
+		       COALESCE(AVG(r.duration_ms), 0)
+		FROM runs r
+		JOIN prompt_versions pv ON r.prompt_version_id = pv.id
+		JOIN prompts p ON pv.prompt_id = p.id
+		JOIN vaults v ON p.vault_id = v.id` + where + `
+		GROUP BY r.provider, COALESCE(r.model, '')
+		ORDER BY 6 DESC, 3 DESC, r.provider, 2
+	`
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []CostSummary
+	for rows.Next() {
+		var summary CostSummary
+		var avgLatencyMs float64
+		err := rows.Scan(&summary.Provider, &summary.Model, &summary.Runs,
+			&summary.PromptTokens, &summary.CompletionTokens, &summary.Cost, &summary.Unpriced, &avgLatencyMs)
+		if err != nil {
+			return nil, err
+		}
+		summary.AvgLatency = time.Duration(avgLatencyMs * float64(time.Millisecond))
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
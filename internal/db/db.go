@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -27,6 +28,7 @@ func InitDB(path string) error {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		vault_id INTEGER,
 		name TEXT,
+		chain TEXT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY(vault_id) REFERENCES vaults(id),
 		UNIQUE(vault_id, name)
@@ -37,6 +39,7 @@ func InitDB(path string) error {
 		prompt_id INTEGER,
 		version INTEGER,
 		content TEXT,
+		format TEXT NOT NULL DEFAULT 'text',
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY(prompt_id) REFERENCES prompts(id)
 	);
@@ -45,12 +48,177 @@ func InitDB(path string) error {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		prompt_version_id INTEGER,
 		provider TEXT,
+		account TEXT,
+		model TEXT,
 		params TEXT,
 		response TEXT,
+		status TEXT NOT NULL DEFAULT 'completed',
+		attempts INTEGER NOT NULL DEFAULT 1,
+		chain TEXT,
+		hops TEXT,
+		duration_ms INTEGER,
+		error_class TEXT,
+		error_message TEXT,
+		prompt_tokens INTEGER,
+		completion_tokens INTEGER,
+		ttft_ms INTEGER,
+		cost REAL,
+		group_id INTEGER,
+		group_row INTEGER,
+		graded_run_id INTEGER,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(prompt_version_id) REFERENCES prompt_versions(id),
+		FOREIGN KEY(group_id) REFERENCES run_groups(id),
+		FOREIGN KEY(graded_run_id) REFERENCES runs(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS run_tags (
+		run_id INTEGER NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY(run_id, tag),
+		FOREIGN KEY(run_id) REFERENCES runs(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS run_groups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		prompt_version_id INTEGER,
+		params TEXT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY(prompt_version_id) REFERENCES prompt_versions(id)
 	);
+
+	CREATE TABLE IF NOT EXISTS eval_cases (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		prompt_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		vars TEXT NOT NULL DEFAULT '{}',
+		assertions TEXT NOT NULL DEFAULT '[]',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(prompt_id) REFERENCES prompts(id),
+		UNIQUE(prompt_id, name)
+	);
+
+	CREATE TABLE IF NOT EXISTS eval_results (
+		run_id INTEGER PRIMARY KEY,
+		case_name TEXT NOT NULL,
+		passed INTEGER NOT NULL,
+		assertions TEXT NOT NULL DEFAULT '[]',
+		FOREIGN KEY(run_id) REFERENCES runs(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		prompt_id INTEGER NOT NULL,
+		case_name TEXT NOT NULL,
+		run_id INTEGER NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(prompt_id) REFERENCES prompts(id),
+		FOREIGN KEY(run_id) REFERENCES runs(id),
+		UNIQUE(prompt_id, case_name)
+	);
 	`
-	_, err = DB.Exec(schema)
-	return err
+	if _, err = DB.Exec(schema); err != nil {
+		return err
+	}
+
+	if err := migrate(); err != nil {
+		return err
+	}
+	return createIndexes()
+}
+
+// columnMigrations lists columns added after a table was first released.
+// They are already part of the schema above for new databases and are added
+// to existing databases on startup.
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"prompt_versions", "format", "TEXT NOT NULL DEFAULT 'text'"},
+	{"runs", "model", "TEXT"},
+	{"runs", "status", "TEXT NOT NULL DEFAULT 'completed'"},
+	{"runs", "account", "TEXT"},
+	{"runs", "attempts", "INTEGER NOT NULL DEFAULT 1"},
+	{"prompts", "chain", "TEXT"},
+	{"runs", "chain", "TEXT"},
+	{"runs", "hops", "TEXT"},
+	{"runs", "duration_ms", "INTEGER"},
+	{"runs", "error_class", "TEXT"},
+	{"runs", "error_message", "TEXT"},
+	{"runs", "prompt_tokens", "INTEGER"},
+	{"runs", "completion_tokens", "INTEGER"},
+	{"runs", "ttft_ms", "INTEGER"},
+	{"runs", "cost", "REAL"},
+	{"runs", "group_id", "INTEGER REFERENCES run_groups(id)"},
+	{"runs", "group_row", "INTEGER"},
+	{"runs", "graded_run_id", "INTEGER REFERENCES runs(id)"},
+}
+
+func migrate() error {
+	for _, m := range columnMigrations {
+		exists, err := hasColumn(m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition))
+		if err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	return nil
+}
+
+// indexes back the run history filters. They are created after the column
+// migrations since some index migrated columns.
+var indexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_prompt_versions_prompt ON prompt_versions(prompt_id, version)",
+	"CREATE INDEX IF NOT EXISTS idx_runs_prompt_version ON runs(prompt_version_id, id)",
+	"CREATE INDEX IF NOT EXISTS idx_runs_created ON runs(created_at)",
+	"CREATE INDEX IF NOT EXISTS idx_runs_provider ON runs(provider, created_at)",
+	"CREATE INDEX IF NOT EXISTS idx_runs_model ON runs(model, created_at)",
+	"CREATE INDEX IF NOT EXISTS idx_runs_status ON runs(status, created_at)",
+	"CREATE INDEX IF NOT EXISTS idx_run_tags_tag ON run_tags(tag, run_id)",
+	"CREATE INDEX IF NOT EXISTS idx_runs_group ON runs(group_id, group_row)",
+	"CREATE INDEX IF NOT EXISTS idx_runs_graded ON runs(graded_run_id)",
+}
+
+func createIndexes() error {
+	for _, index := range indexes {
+		if _, err := DB.Exec(index); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+	return nil
+}
+
+func hasColumn(table, column string) (bool, error) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
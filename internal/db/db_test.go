@@ -0,0 +1,50 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTestDB opens an empty database in a temporary directory with the
+// prompts v/p and v/q, and returns the ID of the first version of each.
+func useTestDB(t *testing.T) (p, q int) {
+	t.Helper()
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DB.Close() })
+	if err := CreateVault("v"); err != nil {
+		t.Fatal(err)
+	}
+	vault, err := GetVaultByName("v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]int, 2)
+	for i, name := range []string{"p", "q"} {
+		if err := CreatePrompt(vault.ID, name, "hello", FormatText); err != nil {
+			t.Fatal(err)
+		}
+		pv, err := GetPromptVersion("v", name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = pv.ID
+	}
+	return ids[0], ids[1]
+}
+
+// createRun stores run, created at the given time if it is not zero.
+func createRun(t *testing.T, run Run, created time.Time) int {
+	t.Helper()
+	if err := CreateRun(&run); err != nil {
+		t.Fatal(err)
+	}
+	if !created.IsZero() {
+		if _, err := DB.Exec("UPDATE runs SET created_at = ? WHERE id = ?", sqliteTime(created), run.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return run.ID
+}
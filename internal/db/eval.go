@@ -0,0 +1,118 @@
+package db
+
+// EvalCase is a test case of a prompt's evaluation suite.
+type EvalCase struct {
+	ID       int
+	PromptID int
+	Name     string
+	// Vars is a JSON object of template variables and Assertions a JSON
+	// list of the checks of the response.
+	Vars       string
+	Assertions string
+	Created    string
+}
+
+// SaveEvalCase adds a case to a prompt's suite, replacing the case of the
+// same name if there is one. It returns sql.ErrNoRows if there is no such
+// prompt.
+func SaveEvalCase(vaultName, promptName string, c *EvalCase) error {
+	prompt, err := GetPromptByName(vaultName, promptName)
+	if err != nil {
+		return err
+	}
+	c.PromptID = prompt.ID
+	return DB.QueryRow(`
+		INSERT INTO eval_cases (prompt_id, name, vars, assertions) VALUES (?, ?, ?, ?)
+		ON CONFLICT(prompt_id, name) DO UPDATE SET vars = excluded.vars, assertions = excluded.assertions
+		RETURNING id, created_at
+	`, c.PromptID, c.Name, c.Vars, c.Assertions).Scan(&c.ID, &c.Created)
+}
+
+// GetEvalCases returns the suite of a prompt in the order its cases were
+// added.
+func GetEvalCases(vaultName, promptName string) ([]EvalCase, error) {
+	rows, err := DB.Query(`
+		SELECT c.id, c.prompt_id, c.name, c.vars, c.assertions, c.created_at
+		FROM eval_cases c
+		JOIN prompts p ON c.prompt_id = p.id
+		JOIN vaults v ON p.vault_id = v.id
+		WHERE v.name = ? AND p.name = ?
+		ORDER BY c.id
+	`, vaultName, promptName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cases []EvalCase
+	for rows.Next() {
+		var c EvalCase
+		if err := rows.Scan(&c.ID, &c.PromptID, &c.Name, &c.Vars, &c.Assertions, &c.Created); err != nil {
+			return nil, err
+		}
+		cases = append(cases, c)
+	}
+	return cases, rows.Err()
+}
+
+// DeleteEvalCase removes a case from a prompt's suite, returning the number
+// of cases removed.
+func DeleteEvalCase(vaultName, promptName, name string) (int64, error) {
+	result, err := DB.Exec(`
+		DELETE FROM eval_cases
+		WHERE name = ? AND prompt_id = (
+			SELECT p.id FROM prompts p JOIN vaults v ON p.vault_id = v.id WHERE v.name = ? AND p.name = ?
+		)
+	`, name, vaultName, promptName)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// EvalResult is the outcome of an evaluation case, stored with its run.
+type EvalResult struct {
+	RunID  int
+	Case   string
+	Passed bool
+	// Assertions is a JSON list of the outcome of each assertion.
+	Assertions string
+}
+
+// CreateEvalResult stores the outcome of an evaluated run.
+func CreateEvalResult(result *EvalResult) error {
+	_, err := DB.Exec("INSERT INTO eval_results (run_id, case_name, passed, assertions) VALUES (?, ?, ?, ?)",
+		result.RunID, result.Case, result.Passed, result.Assertions)
+	return err
+}
+
+// GetEvalResult returns the outcome of an evaluated run, or sql.ErrNoRows
+// if the run was not evaluated.
+func GetEvalResult(runID int) (*EvalResult, error) {
+	var result EvalResult
+	err := DB.QueryRow("SELECT run_id, case_name, passed, assertions FROM eval_results WHERE run_id = ?", runID).
+		Scan(&result.RunID, &result.Case, &result.Passed, &result.Assertions)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetGraderRuns returns the runs of the grader prompts that graded a run.
+func GetGraderRuns(runID int) ([]Run, error) {
+	rows, err := DB.Query(runQuery+" WHERE r.graded_run_id = ? ORDER BY r.id", runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
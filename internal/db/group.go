@@ -0,0 +1,84 @@
+package db
+
+import "database/sql"
+
+// Run group kinds.
+const (
+	RunGroupBatch    = "batch"
+	RunGroupCompare  = "compare"
+	RunGroupAB       = "ab"
+	RunGroupEval     = "eval"
+	RunGroupSnapshot = "snapshot"
+)
+
+// RunGroup ties together the runs of one command, such as the rows of a
+// batch, the targets of a comparison or the cases of an A/B test, an
+// evaluation or a snapshot check.
+type RunGroup struct {
+	ID   int
+	Kind string
+	// PromptVersionID is the prompt version the group runs, or 0 when its
+	// runs use several.
+	PromptVersionID int
+	// Params is a JSON document of the group's settings, in a format that
+	// depends on its kind.
+	Params  string
+	Created string
+}
+
+// CreateRunGroup stores a run group and sets its ID.
+func CreateRunGroup(group *RunGroup) error {
+	return DB.QueryRow(
+		"INSERT INTO run_groups (kind, prompt_version_id, params) VALUES (?, NULLIF(?, 0), ?) RETURNING id, created_at",
+		group.Kind, group.PromptVersionID, group.Params,
+	).Scan(&group.ID, &group.Created)
+}
+
+// GetRunGroup returns a run group, or sql.ErrNoRows if there is none.
+func GetRunGroup(id int) (*RunGroup, error) {
+	var group RunGroup
+	var promptVersionID sql.NullInt64
+	err := DB.QueryRow("SELECT id, kind, prompt_version_id, params, created_at FROM run_groups WHERE id = ?", id).
+		Scan(&group.ID, &group.Kind, &promptVersionID, &group.Params, &group.Created)
+	if err != nil {
+		return nil, err
+	}
+	group.PromptVersionID = int(promptVersionID.Int64)
+	return &group, nil
+}
+
+// GetLatestRunGroup returns the latest run group of a kind that ran a
+// version of a prompt, or sql.ErrNoRows if there is none.
+func GetLatestRunGroup(kind string, promptID int) (*RunGroup, error) {
+	var id int
+	err := DB.QueryRow(`
+		SELECT g.id FROM run_groups g
+		JOIN prompt_versions pv ON g.prompt_version_id = pv.id
+		WHERE g.kind = ? AND pv.prompt_id = ?
+		ORDER BY g.id DESC LIMIT 1
+	`, kind, promptID).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return GetRunGroup(id)
+}
+
+// GetGroupRuns returns the runs of a group ordered by row, oldest first
+// within a row.
+func GetGroupRuns(groupID int) ([]Run, error) {
+	rows, err := DB.Query(runQuery+" WHERE r.group_id = ? ORDER BY r.group_row, r.id", groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
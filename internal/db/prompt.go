@@ -1,6 +1,12 @@
 package db
 
-import "fmt"
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
 
 type Prompt struct {
 	ID            int
@@ -44,20 +50,7 @@ func GetPrompts(vaultName string) ([]Prompt, error) {
 	return prompts, nil
 }
 
-func GetPromptContent(promptID int) (string, error) {
-	query := `
-		SELECT content FROM prompt_versions pv
-		JOIN prompts p ON pv.prompt_id = p.id
-		WHERE p.id = ?
-		ORDER BY pv.version DESC
-		LIMIT 1
-	`
-	var content string
-	err := DB.QueryRow(query, promptID).Scan(&content)
-	return content, err
-}
-
-func CreatePrompt(vaultID int, name, content string) error {
+func CreatePrompt(vaultID int, name, content, format string) error {
 	var promptID int
 	err := DB.QueryRow("INSERT INTO prompts (vault_id, name) VALUES (?, ?) RETURNING id",
 		vaultID, name).Scan(&promptID)
@@ -66,31 +59,163 @@ func CreatePrompt(vaultID int, name, content string) error {
 	}
 
 	_, err = DB.Exec(
-		"INSERT INTO prompt_versions (prompt_id, version, content) VALUES (?, 1, ?)",
+		"INSERT INTO prompt_versions (prompt_id, version, content, format) VALUES (?, 1, ?, ?)",
 		promptID,
 		content,
+		format,
 	)
 	return err
 }
 
-func GetPromptVersionContent(promptID int) (int, string, error) {
+// Prompt version content formats. Text prompts store a single template;
+// chat prompts store a JSON array of role-tagged message templates.
+const (
+	FormatText = "text"
+	FormatChat = "chat"
+)
+
+type PromptVersion struct {
+	ID       int
+	PromptID int
+	Version  int
+	Content  string
+	Format   string
+	Created  string
+}
+
+// GetPromptVersion returns the given version of a prompt, or the latest
+// version when version is 0.
+func GetPromptVersion(vaultName, promptName string, version int) (*PromptVersion, error) {
 	query := `
-		SELECT pv.id, pv.content FROM prompt_versions pv
+		SELECT pv.id, pv.prompt_id, pv.version, pv.content, pv.format, pv.created_at
+		FROM prompt_versions pv
 		JOIN prompts p ON pv.prompt_id = p.id
-		WHERE p.id = ?
-		ORDER BY pv.version DESC
-		LIMIT 1
+		JOIN vaults v ON p.vault_id = v.id
+		WHERE v.name = ? AND p.name = ?
 	`
-	var promptVersionID int
-	var content string
-	err := DB.QueryRow(query, promptID).Scan(&promptVersionID, &content)
-	return promptVersionID, content, err
+	args := []any{vaultName, promptName}
+	if version > 0 {
+		query += " AND pv.version = ?"
+		args = append(args, version)
+	}
+	query += " ORDER BY pv.version DESC LIMIT 1"
+
+	var pv PromptVersion
+	err := DB.QueryRow(query, args...).Scan(
+		&pv.ID,
+		&pv.PromptID,
+		&pv.Version,
+		&pv.Content,
+		&pv.Format,
+		&pv.Created,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &pv, nil
+}
+
+// GetPromptVersionByID returns a prompt version by its ID.
+func GetPromptVersionByID(id int) (*PromptVersion, error) {
+	var pv PromptVersion
+	err := DB.QueryRow(
+		"SELECT id, prompt_id, version, content, format, created_at FROM prompt_versions WHERE id = ?", id,
+	).Scan(&pv.ID, &pv.PromptID, &pv.Version, &pv.Content, &pv.Format, &pv.Created)
+	if err != nil {
+		return nil, err
+	}
+	return &pv, nil
+}
+
+// Run statuses.
+const (
+	RunStatusCompleted = "completed"
+	RunStatusCancelled = "cancelled"
+	RunStatusTimedOut  = "timed_out"
+	RunStatusFailed    = "failed"
+)
+
+// RunStatuses lists every run status.
+var RunStatuses = []string{RunStatusCompleted, RunStatusCancelled, RunStatusTimedOut, RunStatusFailed}
+
+// CreateRun stores a run and its tags and sets its ID. An empty status is
+// stored as completed and zero attempts as one.
+func CreateRun(run *Run) error {
+	// Tags are read back joined with commas, so they cannot hold one.
+	for _, tag := range run.Tags {
+		if err := ValidateTag(tag); err != nil {
+			return err
+		}
+	}
+	if run.Status == "" {
+		run.Status = RunStatusCompleted
+	}
+	if run.Attempts == 0 {
+		run.Attempts = 1
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		`INSERT INTO runs (prompt_version_id, provider, account, model, params, response, status, attempts, chain, hops,
+			duration_ms, error_class, error_message, prompt_tokens, completion_tokens, ttft_ms, cost, group_id, group_row,
+			graded_run_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''), NULLIF(?, ''),
+			NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0), ?, NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0)) RETURNING id`,
+		run.PromptVersionID, run.Provider, run.Account, run.Model, run.Params, run.Response, run.Status,
+		run.Attempts, run.Chain, run.Hops, run.Duration.Milliseconds(), run.ErrorClass, run.ErrorMessage,
+		run.PromptTokens, run.CompletionTokens, run.TimeToFirstToken.Milliseconds(), run.Cost,
+		run.GroupID, run.GroupRow, run.GradedRunID,
+	).Scan(&run.ID)
+	if err != nil {
+		return err
+	}
+	for _, tag := range run.Tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO run_tags (run_id, tag) VALUES (?, ?)", run.ID, tag); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-func CreateRun(promptVersionID int, provider, params, response string) error {
-	_, err := DB.Exec(
-		"INSERT INTO runs (prompt_version_id, provider, params, response) VALUES (?, ?, ?, ?)",
-		promptVersionID, provider, params, response)
+// ValidateTag checks that tag can be stored on a run.
+func ValidateTag(tag string) error {
+	if tag == "" || strings.TrimSpace(tag) != tag || strings.Contains(tag, ",") {
+		return fmt.Errorf("invalid tag %q: tags must be non-empty, without commas or surrounding spaces", tag)
+	}
+	return nil
+}
+
+// GetPromptChain returns the fallback chain stored with a prompt as a JSON
+// document, or "" if it has none.
+func GetPromptChain(vaultName, promptName string) (string, error) {
+	var chain string
+	err := DB.QueryRow(`
+		SELECT COALESCE(p.chain, '')
+		FROM prompts p
+		JOIN vaults v ON p.vault_id = v.id
+		WHERE v.name = ? AND p.name = ?
+	`, vaultName, promptName).Scan(&chain)
+	return chain, err
+}
+
+// SetPromptChain stores a prompt's fallback chain; "" removes it. It
+// returns sql.ErrNoRows if there is no such prompt.
+func SetPromptChain(vaultName, promptName, chain string) error {
+	result, err := DB.Exec(`
+		UPDATE prompts SET chain = NULLIF(?, '')
+		WHERE name = ? AND vault_id = (SELECT id FROM vaults WHERE name = ?)
+	`, chain, promptName, vaultName)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
 	return err
 }
 
@@ -143,7 +268,7 @@ func GetPromptByName(vaultName, promptName string) (*Prompt, error) {
 	return &prompt, nil
 }
 
-func UpdatePrompt(vaultName, promptName, content string) error {
+func UpdatePrompt(vaultName, promptName, content, format string) error {
 	// Get the prompt
 	prompt, err := GetPromptByName(vaultName, promptName)
 	if err != nil {
@@ -155,101 +280,216 @@ func UpdatePrompt(vaultName, promptName, content string) error {
 
 	// Insert new version
 	_, err = DB.Exec(
-		"INSERT INTO prompt_versions (prompt_id, version, content) VALUES (?, ?, ?)",
+		"INSERT INTO prompt_versions (prompt_id, version, content, format) VALUES (?, ?, ?, ?)",
 		prompt.ID,
 		nextVersion,
 		content,
+		format,
 	)
 	return err
 }
 
-func GetPromptVersionContentByVersion(vaultName, promptName string, version int) (string, error) {
-	query := `
-		SELECT pv.content
-		FROM prompt_versions pv
-		JOIN prompts p ON pv.prompt_id = p.id
-		JOIN vaults v ON p.vault_id = v.id
-		WHERE v.name = ? AND p.name = ? AND pv.version = ?
-	`
-	var content string
-	err := DB.QueryRow(query, vaultName, promptName, version).Scan(&content)
-	return content, err
+type Run struct {
+	ID              int
+	PromptVersionID int
+	PromptName      string
+	VaultName       string
+	Version         int
+	Provider        string
+	Account         string
+	Model           string
+	Params          string
+	Response        string
+	Status          string
+	Attempts        int
+	// Chain is the fallback chain the run went through, if any, and Hops
+	// the JSON list of hops it tried.
+	Chain string
+	Hops  string
+	// Duration is the time spent waiting for the provider.
+	Duration time.Duration
+	// ErrorClass and ErrorMessage describe why a failed, cancelled or
+	// timed out run did not complete.
+	ErrorClass   string
+	ErrorMessage string
+	// PromptTokens and CompletionTokens are zero when the provider did not
+	// report usage.
+	PromptTokens     int
+	CompletionTokens int
+	// TimeToFirstToken is the time until the first text arrived, or zero
+	// when the response was not streamed.
+	TimeToFirstToken time.Duration
+	// Cost is in US dollars, or nil when the model has no price.
+	Cost *float64
+	Tags []string
+	// GroupID is the run group the run belongs to, if any, GroupKind its
+	// kind and GroupRow the run's row, counting from 1.
+	GroupID   int
+	GroupKind string
+	GroupRow  int
+	// GradedRunID is the run a grader run graded, if any.
+	GradedRunID int
+	Created     string
 }
 
-type Run struct {
-	ID         int
-	PromptName string
-	VaultName  string
-	Provider   string
-	Params     string
-	Response   string
-	Created    string
+// RunFilter selects runs. Empty fields match every run.
+type RunFilter struct {
+	Vault    string
+	Prompt   string
+	Version  int
+	Status   string
+	Provider string
+	Model    string
+	Tag      string
+	Group    int
+	// Since and Until select runs created in [Since, Until).
+	Since time.Time
+	Until time.Time
 }
 
-func GetRuns(vaultName, promptName string) ([]Run, error) {
-	query := `
-		SELECT r.id, p.name as prompt_name, v.name as vault_name, 
-		       r.provider, r.params, r.response, r.created_at
-		FROM runs r
-		JOIN prompt_versions pv ON r.prompt_version_id = pv.id
-		JOIN prompts p ON pv.prompt_id = p.id
-		JOIN vaults v ON p.vault_id = v.id
-	`
-	var args []any
+// sqliteTime formats t like CURRENT_TIMESTAMP so it compares with stored
+// timestamps.
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
 
-	conditions := []string{}
-	if vaultName != "" {
+// runQuery selects the columns read by scanRun.
+const runQuery = `
+	SELECT r.id, r.prompt_version_id, p.name as prompt_name, v.name as vault_name, pv.version,
+	       r.provider, COALESCE(r.account, ''), COALESCE(r.model, ''), r.params, r.response, r.status, r.attempts,
+	       COALESCE(r.chain, ''), COALESCE(r.hops, ''), COALESCE(r.duration_ms, 0),
+	       COALESCE(r.error_class, ''), COALESCE(r.error_message, ''),
+	       COALESCE(r.prompt_tokens, 0), COALESCE(r.completion_tokens, 0), COALESCE(r.ttft_ms, 0), r.cost,
+	       COALESCE((SELECT group_concat(tag, ',') FROM run_tags WHERE run_id = r.id), ''),
+	       COALESCE(r.group_id, 0), COALESCE((SELECT kind FROM run_groups WHERE id = r.group_id), ''),
+	       COALESCE(r.group_row, 0), COALESCE(r.graded_run_id, 0), r.created_at
+	FROM runs r
+	JOIN prompt_versions pv ON r.prompt_version_id = pv.id
+	JOIN prompts p ON pv.prompt_id = p.id
+	JOIN vaults v ON p.vault_id = v.id
+`
+
+func scanRun(row interface{ Scan(...any) error }) (*Run, error) {
+	var run Run
+	var durationMs, ttftMs int64
+	var cost sql.NullFloat64
+	var tags string
+	err := row.Scan(&run.ID, &run.PromptVersionID, &run.PromptName, &run.VaultName, &run.Version,
+		&run.Provider, &run.Account, &run.Model, &run.Params, &run.Response, &run.Status, &run.Attempts,
+		&run.Chain, &run.Hops, &durationMs, &run.ErrorClass, &run.ErrorMessage,
+		&run.PromptTokens, &run.CompletionTokens, &ttftMs, &cost, &tags,
+		&run.GroupID, &run.GroupKind, &run.GroupRow, &run.GradedRunID, &run.Created)
+	if err != nil {
+		return nil, err
+	}
+	if tags != "" {
+		run.Tags = strings.Split(tags, ",")
+		sort.Strings(run.Tags)
+	}
+	run.Duration = time.Duration(durationMs) * time.Millisecond
+	run.TimeToFirstToken = time.Duration(ttftMs) * time.Millisecond
+	if cost.Valid {
+		run.Cost = &cost.Float64
+	}
+	return &run, nil
+}
+
+// where returns the WHERE clause selecting the filter's runs, if any, and
+// its arguments.
+func (f RunFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+	if f.Vault != "" {
 		conditions = append(conditions, "v.name = ?")
-		args = append(args, vaultName)
+		args = append(args, f.Vault)
 	}
-	if promptName != "" {
+	if f.Prompt != "" {
 		conditions = append(conditions, "p.name = ?")
-		args = append(args, promptName)
+		args = append(args, f.Prompt)
 	}
+	if f.Status != "" {
+		conditions = append(conditions, "r.status = ?")
+		args = append(args, f.Status)
+	}
+	if f.Version > 0 {
+		conditions = append(conditions, "pv.version = ?")
+		args = append(args, f.Version)
+	}
+	if f.Provider != "" {
+		conditions = append(conditions, "r.provider = ?")
+		args = append(args, f.Provider)
+	}
+	if f.Model != "" {
+		conditions = append(conditions, "r.model = ?")
+		args = append(args, f.Model)
+	}
+	if f.Tag != "" {
+		conditions = append(conditions, "r.id IN (SELECT run_id FROM run_tags WHERE tag = ?)")
+		args = append(args, f.Tag)
+	}
+	if f.Group > 0 {
+		conditions = append(conditions, "r.group_id = ?")
+		args = append(args, f.Group)
+	}
+	if !f.Since.IsZero() {
+		conditions = append(conditions, "r.created_at >= ?")
+		args = append(args, sqliteTime(f.Since))
+	}
+	if !f.Until.IsZero() {
+		conditions = append(conditions, "r.created_at < ?")
+		args = append(args, sqliteTime(f.Until))
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
 
-	if len(conditions) > 0 {
-		query += " WHERE " + conditions[0]
-		for i := 1; i < len(conditions); i++ {
-			query += " AND " + conditions[i]
+// GetRuns returns the runs selected by filter, newest first: at most limit
+// of them, or all for 0, starting after the run whose ID is cursor, or with
+// the newest for 0. next is the cursor of the following page, or 0 if there
+// is none.
+func GetRuns(filter RunFilter, limit, cursor int) (runs []Run, next int, err error) {
+	where, args := filter.where()
+	if cursor > 0 {
+		if where == "" {
+			where = " WHERE r.id < ?"
+		} else {
+			where += " AND r.id < ?"
 		}
+		args = append(args, cursor)
+	}
+	// IDs increase with creation time, and unlike created_at are unique
+	// and indexed, so they order pages without gaps or repeats.
+	query := runQuery + where + " ORDER BY r.id DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit+1)
 	}
-
-	query += " ORDER BY r.created_at DESC LIMIT 20"
 
 	rows, err := DB.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
-	var runs []Run
 	for rows.Next() {
-		var run Run
-		err := rows.Scan(&run.ID, &run.PromptName, &run.VaultName,
-			&run.Provider, &run.Params, &run.Response, &run.Created)
+		run, err := scanRun(rows)
 		if err != nil {
-			continue
+			return nil, 0, err
 		}
-		runs = append(runs, run)
+		runs = append(runs, *run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+		next = runs[limit-1].ID
 	}
-	return runs, nil
+	return runs, next, nil
 }
 
 func GetRunByID(id int) (*Run, error) {
-	query := `
-		SELECT r.id, p.name as prompt_name, v.name as vault_name, 
-		       r.provider, r.params, r.response, r.created_at
-		FROM runs r
-		JOIN prompt_versions pv ON r.prompt_version_id = pv.id
-		JOIN prompts p ON pv.prompt_id = p.id
-		JOIN vaults v ON p.vault_id = v.id
-		WHERE r.id = ?
-	`
-	var run Run
-	err := DB.QueryRow(query, id).Scan(&run.ID, &run.PromptName, &run.VaultName,
-		&run.Provider, &run.Params, &run.Response, &run.Created)
-	if err != nil {
-		return nil, err
-	}
-	return &run, nil
+	return scanRun(DB.QueryRow(runQuery+" WHERE r.id = ?", id))
 }
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetRunsPaging(t *testing.T) {
+	p, _ := useTestDB(t)
+	var ids []int
+	for range 5 {
+		ids = append(ids, createRun(t, Run{PromptVersionID: p, Provider: "mock", Model: "m"}, time.Time{}))
+	}
+	slices.Reverse(ids)
+
+	for _, tt := range []struct {
+		name  string
+		limit int
+		pages [][]int
+	}{
+		{"all at once", 0, [][]int{ids}},
+		{"pages of two", 2, [][]int{ids[:2], ids[2:4], ids[4:]}},
+		{"exact pages", 5, [][]int{ids}},
+		{"pages of one", 1, [][]int{ids[:1], ids[1:2], ids[2:3], ids[3:4], ids[4:]}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := 0
+			for i, want := range tt.pages {
+				runs, next, err := GetRuns(RunFilter{}, tt.limit, cursor)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := runIDs(runs); !slices.Equal(got, want) {
+					t.Fatalf("page %d = %v, want %v", i+1, got, want)
+				}
+				last := i == len(tt.pages)-1
+				if last != (next == 0) {
+					t.Fatalf("page %d: next cursor %d", i+1, next)
+				}
+				cursor = next
+			}
+		})
+	}
+
+	// A cursor past the oldest run gives an empty page.
+	runs, next, err := GetRuns(RunFilter{}, 2, ids[len(ids)-1])
+	if err != nil || len(runs) != 0 || next != 0 {
+		t.Errorf("page after the oldest run = %v, %d, %v", runIDs(runs), next, err)
+	}
+}
+
+func TestGetRunsTimeRange(t *testing.T) {
+	p, _ := useTestDB(t)
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	before := createRun(t, Run{PromptVersionID: p}, day.Add(-time.Second))
+	start := createRun(t, Run{PromptVersionID: p}, day)
+	during := createRun(t, Run{PromptVersionID: p}, day.Add(time.Hour))
+	end := createRun(t, Run{PromptVersionID: p}, day.Add(24*time.Hour))
+
+	for _, tt := range []struct {
+		name   string
+		filter RunFilter
+		want   []int
+	}{
+		{"no range", RunFilter{}, []int{end, during, start, before}},
+		{"since is inclusive", RunFilter{Since: day}, []int{end, during, start}},
+		{"until is exclusive", RunFilter{Until: day.Add(24 * time.Hour)}, []int{during, start, before}},
+		{"both", RunFilter{Since: day, Until: day.Add(24 * time.Hour)}, []int{during, start}},
+		{"other time zone", RunFilter{Since: day.In(time.FixedZone("UTC+5", 5*60*60))}, []int{end, during, start}},
+		{"empty range", RunFilter{Since: day.Add(2 * time.Hour), Until: day.Add(3 * time.Hour)}, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, _, err := GetRuns(tt.filter, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := runIDs(runs); !slices.Equal(got, tt.want) {
+				t.Errorf("runs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRunsFilters(t *testing.T) {
+	p, q := useTestDB(t)
+	group := &RunGroup{Kind: RunGroupBatch, PromptVersionID: p, Params: "{}"}
+	if err := CreateRunGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	a := createRun(t, Run{PromptVersionID: p, Provider: "openai", Model: "gpt-4o", Tags: []string{"prod", "v2"}}, time.Time{})
+	b := createRun(t, Run{PromptVersionID: p, Provider: "anthropic", Model: "claude", Status: RunStatusFailed,
+		Tags: []string{"prod"}}, time.Time{})
+	c := createRun(t, Run{PromptVersionID: q, Provider: "openai", Model: "gpt-4o-mini", GroupID: group.ID, GroupRow: 1},
+		time.Time{})
+
+	for _, tt := range []struct {
+		name   string
+		filter RunFilter
+		want   []int
+	}{
+		{"vault", RunFilter{Vault: "v"}, []int{c, b, a}},
+		{"unknown vault", RunFilter{Vault: "w"}, nil},
+		{"prompt", RunFilter{Vault: "v", Prompt: "p"}, []int{b, a}},
+		{"version", RunFilter{Prompt: "q", Version: 1}, []int{c}},
+		{"missing version", RunFilter{Prompt: "q", Version: 2}, nil},
+		{"status", RunFilter{Status: RunStatusFailed}, []int{b}},
+		{"provider", RunFilter{Provider: "openai"}, []int{c, a}},
+		{"model", RunFilter{Model: "gpt-4o"}, []int{a}},
+		{"tag", RunFilter{Tag: "prod"}, []int{b, a}},
+		{"second tag", RunFilter{Tag: "v2"}, []int{a}},
+		{"tag is not a prefix", RunFilter{Tag: "pro"}, nil},
+		{"group", RunFilter{Group: group.ID}, []int{c}},
+		{"combined", RunFilter{Provider: "openai", Tag: "prod"}, []int{a}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, _, err := GetRuns(tt.filter, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := runIDs(runs); !slices.Equal(got, tt.want) {
+				t.Errorf("runs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Tags are read back sorted.
+	run, err := GetRunByID(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(run.Tags, []string{"prod", "v2"}) {
+		t.Errorf("tags = %q, want [prod v2]", run.Tags)
+	}
+}
+
+func TestCreateRunRejectsInvalidTags(t *testing.T) {
+	p, _ := useTestDB(t)
+	for _, tag := range []string{"a,b", "", " prod", "prod "} {
+		if err := CreateRun(&Run{PromptVersionID: p, Tags: []string{"ok", tag}}); err == nil {
+			t.Errorf("CreateRun accepted the tag %q", tag)
+		}
+	}
+	runs, _, err := GetRuns(RunFilter{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 0 {
+		t.Errorf("stored %d runs with invalid tags", len(runs))
+	}
+}
+
+func TestGetRunsReturnsScanErrors(t *testing.T) {
+	p, _ := useTestDB(t)
+	createRun(t, Run{PromptVersionID: p}, time.Time{})
+	bad := createRun(t, Run{PromptVersionID: p}, time.Time{})
+	if _, err := DB.Exec("UPDATE runs SET duration_ms = 'slow' WHERE id = ?", bad); err != nil {
+		t.Fatal(err)
+	}
+	if runs, _, err := GetRuns(RunFilter{}, 0, 0); err == nil {
+		t.Errorf("GetRuns = %v, want the error reading run %d", runIDs(runs), bad)
+	}
+}
+
+func runIDs(runs []Run) []int {
+	var ids []int
+	for _, r := range runs {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
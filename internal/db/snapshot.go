@@ -0,0 +1,50 @@
+package db
+
+// Snapshot is the approved golden response of a test case: the response
+// of the run it was promoted from.
+type Snapshot struct {
+	ID       int
+	PromptID int
+	Case     string
+	RunID    int
+	Version  int
+	Response string
+	Created  string
+	Updated  string
+}
+
+// SaveSnapshot makes a run the golden response of a case of a prompt,
+// replacing the case's previous golden.
+func SaveSnapshot(promptID int, caseName string, runID int) error {
+	_, err := DB.Exec(`
+		INSERT INTO snapshots (prompt_id, case_name, run_id) VALUES (?, ?, ?)
+		ON CONFLICT(prompt_id, case_name) DO UPDATE SET run_id = excluded.run_id, updated_at = CURRENT_TIMESTAMP
+	`, promptID, caseName, runID)
+	return err
+}
+
+// GetSnapshots returns the golden responses of a prompt's cases, keyed by
+// case name.
+func GetSnapshots(promptID int) (map[string]Snapshot, error) {
+	rows, err := DB.Query(`
+		SELECT s.id, s.prompt_id, s.case_name, s.run_id, pv.version, r.response, s.created_at, s.updated_at
+		FROM snapshots s
+		JOIN runs r ON s.run_id = r.id
+		JOIN prompt_versions pv ON r.prompt_version_id = pv.id
+		WHERE s.prompt_id = ?
+	`, promptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := make(map[string]Snapshot)
+	for rows.Next() {
+		var s Snapshot
+		if err := rows.Scan(&s.ID, &s.PromptID, &s.Case, &s.RunID, &s.Version, &s.Response, &s.Created, &s.Updated); err != nil {
+			return nil, err
+		}
+		snapshots[s.Case] = s
+	}
+	return snapshots, rows.Err()
+}
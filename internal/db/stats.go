@@ -0,0 +1,171 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Keys runs can be grouped by in GetRunStats.
+const (
+	GroupVault    = "vault"
+	GroupPrompt   = "prompt"
+	GroupVersion  = "version"
+	GroupProvider = "provider"
+	GroupAccount  = "account"
+	GroupModel    = "model"
+)
+
+// GroupKeys lists the keys runs can be grouped by.
+var GroupKeys = []string{GroupVault, GroupPrompt, GroupVersion, GroupProvider, GroupAccount, GroupModel}
+
+// accountSeparator is the position of the ":" in a provider stored as
+// "provider:account", or 0. Chains are named "chain:<name>" and have no
+// account.
+const accountSeparator = "CASE WHEN r.provider LIKE 'chain:%' THEN 0 ELSE instr(r.provider, ':') END"
+
+// groupColumns are the expressions of the group keys. Prompts are only
+// unique within their vault, so they include it. Providers are grouped
+// without their account, which is a key of its own.
+var groupColumns = map[string]string{
+	GroupVault:   "v.name",
+	GroupPrompt:  "v.name || '/' || p.name",
+	GroupVersion: "v.name || '/' || p.name || '@v' || pv.version",
+	GroupProvider: "CASE WHEN " + accountSeparator + " > 0 " +
+		"THEN substr(r.provider, 1, " + accountSeparator + " - 1) ELSE r.provider END",
+	GroupAccount: "COALESCE(NULLIF(r.account, ''), CASE WHEN " + accountSeparator + " > 0 " +
+		"THEN substr(r.provider, " + accountSeparator + " + 1) END, '')",
+	GroupModel: "COALESCE(r.model, '')",
+}
+
+// RunStats aggregates a group of runs.
+type RunStats struct {
+	// Keys holds the group's value of each key it was grouped by.
+	Keys []string
+	Runs int
+	// Failed counts failed and timed out runs.
+	Failed    int
+	Cancelled int
+	// P50Latency and P95Latency are over completed runs.
+	P50Latency       time.Duration
+	P95Latency       time.Duration
+	PromptTokens     int
+	CompletionTokens int
+	// Cost is in US dollars. Unpriced counts runs with token usage but no
+	// cost.
+	Cost     float64
+	Unpriced int
+
+	latencies []time.Duration
+}
+
+// FailureRate is the fraction of runs that failed or timed out.
+func (s *RunStats) FailureRate() float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return float64(s.Failed) / float64(s.Runs)
+}
+
+// GetRunStats aggregates the runs selected by filter, grouped by the given
+// keys, busiest group first.
+func GetRunStats(filter RunFilter, groupBy []string) ([]*RunStats, error) {
+	if len(groupBy) == 0 {
+		return nil, fmt.Errorf("at least one group key is required")
+	}
+	columns := make([]string, 0, len(groupBy))
+	for _, key := range groupBy {
+		column, ok := groupColumns[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown group key %q (supported: %s)", key, strings.Join(GroupKeys, ", "))
+		}
+		columns = append(columns, column)
+	}
+
+	where, args := filter.where()
+	query := `
+		SELECT ` + strings.Join(columns, ", ") + `, r.status, COALESCE(r.duration_ms, 0),
+		       COALESCE(r.prompt_tokens, 0), COALESCE(r.completion_tokens, 0), r.cost
+		FROM runs r
+		JOIN prompt_versions pv ON r.prompt_version_id = pv.id
+		JOIN prompts p ON pv.prompt_id = p.id
+		JOIN vaults v ON p.vault_id = v.id` + where
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make(map[string]*RunStats)
+	for rows.Next() {
+		keys := make([]string, len(groupBy))
+		var (
+			status                         string
+			durationMs                     int64
+			promptTokens, completionTokens int
+			cost                           *float64
+		)
+		dest := make([]any, 0, len(keys)+5)
+		for i := range keys {
+			dest = append(dest, &keys[i])
+		}
+		dest = append(dest, &status, &durationMs, &promptTokens, &completionTokens, &cost)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		id := strings.Join(keys, "\x00")
+		stats, ok := groups[id]
+		if !ok {
+			stats = &RunStats{Keys: keys}
+			groups[id] = stats
+		}
+		stats.Runs++
+		switch status {
+		case RunStatusFailed, RunStatusTimedOut:
+			stats.Failed++
+		case RunStatusCancelled:
+			stats.Cancelled++
+		case RunStatusCompleted:
+			if durationMs > 0 {
+				stats.latencies = append(stats.latencies, time.Duration(durationMs)*time.Millisecond)
+			}
+		}
+		stats.PromptTokens += promptTokens
+		stats.CompletionTokens += completionTokens
+		if cost != nil {
+			stats.Cost += *cost
+		} else if promptTokens > 0 || completionTokens > 0 {
+			stats.Unpriced++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stats := make([]*RunStats, 0, len(groups))
+	for _, group := range groups {
+		sort.Slice(group.latencies, func(i, j int) bool { return group.latencies[i] < group.latencies[j] })
+		group.P50Latency = percentile(group.latencies, 50)
+		group.P95Latency = percentile(group.latencies, 95)
+		stats = append(stats, group)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Runs != stats[j].Runs {
+			return stats[i].Runs > stats[j].Runs
+		}
+		return strings.Join(stats[i].Keys, "\x00") < strings.Join(stats[j].Keys, "\x00")
+	})
+	return stats, nil
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations, or
+// zero if there are none.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
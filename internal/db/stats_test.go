@@ -0,0 +1,167 @@
+package db
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	ms := func(values ...int) []time.Duration {
+		durations := make([]time.Duration, len(values))
+		for i, v := range values {
+			durations[i] = time.Duration(v) * time.Millisecond
+		}
+		return durations
+	}
+	hundred := make([]int, 100)
+	for i := range hundred {
+		hundred[i] = i + 1
+	}
+
+	for _, tt := range []struct {
+		name   string
+		sorted []time.Duration
+		p      int
+		want   time.Duration
+	}{
+		{"empty", nil, 50, 0},
+		{"one value p50", ms(7), 50, 7 * time.Millisecond},
+		{"one value p95", ms(7), 95, 7 * time.Millisecond},
+		{"two values p50", ms(1, 2), 50, time.Millisecond},
+		{"two values p95", ms(1, 2), 95, 2 * time.Millisecond},
+		{"odd count p50", ms(1, 2, 3, 4, 5), 50, 3 * time.Millisecond},
+		{"even count p50", ms(1, 2, 3, 4), 50, 2 * time.Millisecond},
+		{"p95 of 20", ms(hundred[:20]...), 95, 19 * time.Millisecond},
+		{"p95 of 100", ms(hundred...), 95, 95 * time.Millisecond},
+		{"p100", ms(1, 2, 3), 100, 3 * time.Millisecond},
+		{"p0", ms(1, 2, 3), 0, time.Millisecond},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentile(tt.sorted, tt.p); got != tt.want {
+				t.Errorf("percentile = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRunStats(t *testing.T) {
+	p, q := useTestDB(t)
+	cost := func(c float64) *float64 { return &c }
+	for _, run := range []Run{
+		{PromptVersionID: p, Provider: "openai", Model: "gpt-4o", Duration: 100 * time.Millisecond,
+			PromptTokens: 10, CompletionTokens: 5, Cost: cost(0.25)},
+		{PromptVersionID: p, Provider: "openai:team-a", Model: "gpt-4o", Duration: 300 * time.Millisecond,
+			PromptTokens: 20, CompletionTokens: 10, Cost: cost(0.5)},
+		{PromptVersionID: p, Provider: "openai", Account: "team-b", Model: "gpt-4o", Duration: 200 * time.Millisecond,
+			PromptTokens: 5, CompletionTokens: 5},
+		{PromptVersionID: p, Provider: "openai", Model: "gpt-4o", Status: RunStatusFailed},
+		{PromptVersionID: p, Provider: "chain:default", Model: "claude", Status: RunStatusTimedOut},
+		{PromptVersionID: q, Provider: "mock", Status: RunStatusCancelled},
+	} {
+		createRun(t, run, time.Time{})
+	}
+
+	for _, tt := range []struct {
+		name    string
+		groupBy []string
+		filter  RunFilter
+		want    []string
+	}{
+		{
+			"prompt",
+			[]string{GroupPrompt},
+			RunFilter{},
+			[]string{
+				"v/p runs=5 failed=2 cancelled=0 p50=200ms p95=300ms tokens=35/20 cost=0.75 unpriced=1",
+				"v/q runs=1 failed=0 cancelled=1 p50=0s p95=0s tokens=0/0 cost=0 unpriced=0",
+			},
+		},
+		{
+			"provider without account",
+			[]string{GroupProvider},
+			RunFilter{},
+			[]string{
+				"openai runs=4 failed=1 cancelled=0 p50=200ms p95=300ms tokens=35/20 cost=0.75 unpriced=1",
+				"chain:default runs=1 failed=1 cancelled=0 p50=0s p95=0s tokens=0/0 cost=0 unpriced=0",
+				"mock runs=1 failed=0 cancelled=1 p50=0s p95=0s tokens=0/0 cost=0 unpriced=0",
+			},
+		},
+		{
+			"provider and account",
+			[]string{GroupProvider, GroupAccount},
+			RunFilter{Prompt: "p"},
+			[]string{
+				"openai| runs=2 failed=1 cancelled=0 p50=100ms p95=100ms tokens=10/5 cost=0.25 unpriced=0",
+				"chain:default| runs=1 failed=1 cancelled=0 p50=0s p95=0s tokens=0/0 cost=0 unpriced=0",
+				"openai|team-a runs=1 failed=0 cancelled=0 p50=300ms p95=300ms tokens=20/10 cost=0.5 unpriced=0",
+				"openai|team-b runs=1 failed=0 cancelled=0 p50=200ms p95=200ms tokens=5/5 cost=0 unpriced=1",
+			},
+		},
+		{
+			"version and model",
+			[]string{GroupVersion, GroupModel},
+			RunFilter{},
+			[]string{
+				"v/p@v1|gpt-4o runs=4 failed=1 cancelled=0 p50=200ms p95=300ms tokens=35/20 cost=0.75 unpriced=1",
+				"v/p@v1|claude runs=1 failed=1 cancelled=0 p50=0s p95=0s tokens=0/0 cost=0 unpriced=0",
+				"v/q@v1| runs=1 failed=0 cancelled=1 p50=0s p95=0s tokens=0/0 cost=0 unpriced=0",
+			},
+		},
+		{
+			"group of one run",
+			[]string{GroupVault},
+			RunFilter{Provider: "mock"},
+			[]string{"v runs=1 failed=0 cancelled=1 p50=0s p95=0s tokens=0/0 cost=0 unpriced=0"},
+		},
+		{"no runs", []string{GroupVault}, RunFilter{Provider: "google"}, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := GetRunStats(tt.filter, tt.groupBy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, s := range stats {
+				got = append(got, formatStats(s))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("stats =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+
+	if _, err := GetRunStats(RunFilter{}, nil); err == nil {
+		t.Error("GetRunStats accepted no group keys")
+	}
+	if _, err := GetRunStats(RunFilter{}, []string{"day"}); err == nil {
+		t.Error("GetRunStats accepted an unknown group key")
+	}
+}
+
+func TestRunStatsFailureRate(t *testing.T) {
+	for _, tt := range []struct {
+		stats RunStats
+		want  float64
+	}{
+		{RunStats{}, 0},
+		{RunStats{Runs: 1}, 0},
+		{RunStats{Runs: 1, Failed: 1}, 1},
+		{RunStats{Runs: 4, Failed: 1, Cancelled: 2}, 0.25},
+	} {
+		if got := tt.stats.FailureRate(); got != tt.want {
+			t.Errorf("FailureRate(%+v) = %g, want %g", tt.stats, got, tt.want)
+		}
+	}
+}
+
+func formatStats(s *RunStats) string {
+	return strings.Join(s.Keys, "|") + " " + strings.Join([]string{
+		"runs=" + strconv.Itoa(s.Runs), "failed=" + strconv.Itoa(s.Failed), "cancelled=" + strconv.Itoa(s.Cancelled),
+		"p50=" + s.P50Latency.String(), "p95=" + s.P95Latency.String(),
+		"tokens=" + strconv.Itoa(s.PromptTokens) + "/" + strconv.Itoa(s.CompletionTokens),
+		"cost=" + strconv.FormatFloat(s.Cost, 'g', -1, 64), "unpriced=" + strconv.Itoa(s.Unpriced),
+	}, " ")
+}
@@ -0,0 +1,347 @@
+// Package eval checks responses against the assertions of evaluation
+// suites.
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Assertion types.
+const (
+	AssertContains    = "contains"
+	AssertNotContains = "not-contains"
+	AssertRegex       = "regex"
+	AssertJSON        = "json"
+	AssertJSONSchema  = "json-schema"
+	AssertMaxLength   = "max-length"
+	AssertRange       = "range"
+	AssertJudge       = "judge"
+)
+
+// AssertionTypes lists the assertion types.
+var AssertionTypes = []string{
+	AssertContains, AssertNotContains, AssertRegex, AssertJSON, AssertJSONSchema, AssertMaxLength, AssertRange, AssertJudge,
+}
+
+// Assertion is a check of a response. Which fields are used depends on its
+// type: Value for contains, not-contains and regex, Schema for
+// json-schema, Max for max-length, Min and Max for range, and Grader and
+// Min, the passing score, for judge.
+type Assertion struct {
+	Type   string          `json:"type"`
+	Value  string          `json:"value,omitempty"`
+	Schema json.RawMessage `json:"schema,omitempty"`
+	Min    *float64        `json:"min,omitempty"`
+	Max    *float64        `json:"max,omitempty"`
+	// Grader is the prompt grading the response of a judge assertion, as
+	// <vault>/<name>[@<version>]. Criteria is passed to it, and Provider
+	// and Model, when set, are what it runs with.
+	Grader   string `json:"grader,omitempty"`
+	Criteria string `json:"criteria,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+}
+
+// ParseAssertion parses an assertion written as type=value: contains=text,
+// not-contains=text, regex=pattern, json, json-schema={...} or
+// json-schema=@file, max-length=n, range=min..max, where either bound of
+// a range may be left out, or judge=vault/grader,min=score followed by
+// optional provider=, model= and, last as it may hold commas, criteria=.
+func ParseAssertion(spec string) (Assertion, error) {
+	typ, value, hasValue := strings.Cut(spec, "=")
+	a := Assertion{Type: strings.TrimSpace(typ)}
+	switch a.Type {
+	case AssertContains, AssertNotContains, AssertRegex:
+		a.Value = value
+	case AssertJSON:
+		if hasValue {
+			return a, fmt.Errorf("invalid assertion %q: json takes no value", spec)
+		}
+	case AssertJSONSchema:
+		// A schema may be read from a file named with @.
+		if path, ok := strings.CutPrefix(value, "@"); ok {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return a, fmt.Errorf("invalid assertion %q: %w", spec, err)
+			}
+			value = string(data)
+		}
+		a.Schema = json.RawMessage(value)
+	case AssertMaxLength:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return a, fmt.Errorf("invalid assertion %q: max-length takes a number of characters", spec)
+		}
+		limit := float64(n)
+		a.Max = &limit
+	case AssertRange:
+		low, high, ok := strings.Cut(value, "..")
+		if !ok {
+			return a, fmt.Errorf("invalid assertion %q: use range=min..max", spec)
+		}
+		for _, bound := range []struct {
+			text string
+			dst  **float64
+		}{{low, &a.Min}, {high, &a.Max}} {
+			if bound.text == "" {
+				continue
+			}
+			n, err := strconv.ParseFloat(bound.text, 64)
+			if err != nil {
+				return a, fmt.Errorf("invalid assertion %q: %q is not a number", spec, bound.text)
+			}
+			*bound.dst = &n
+		}
+	case AssertJudge:
+		options := strings.Split(value, ",")
+		a.Grader = options[0]
+		for i := 1; i < len(options); i++ {
+			key, optionValue, _ := strings.Cut(options[i], "=")
+			switch key {
+			case "min":
+				n, err := strconv.ParseFloat(optionValue, 64)
+				if err != nil {
+					return a, fmt.Errorf("invalid assertion %q: %q is not a number", spec, optionValue)
+				}
+				a.Min = &n
+			case "provider":
+				a.Provider = optionValue
+			case "model":
+				a.Model = optionValue
+			case "criteria":
+				a.Criteria = strings.Join(append([]string{optionValue}, options[i+1:]...), ",")
+				i = len(options)
+			default:
+				return a, fmt.Errorf("invalid assertion %q: unknown option %q (supported: min, provider, model, criteria)", spec, key)
+			}
+		}
+	default:
+		return a, fmt.Errorf("unknown assertion type %q (supported: %s)", a.Type, strings.Join(AssertionTypes, ", "))
+	}
+	return a, a.Validate()
+}
+
+// Validate checks that the assertion is complete.
+func (a Assertion) Validate() error {
+	switch a.Type {
+	case AssertContains, AssertNotContains:
+		if a.Value == "" {
+			return fmt.Errorf("%s assertion has no value", a.Type)
+		}
+	case AssertRegex:
+		if _, err := regexp.Compile(a.Value); err != nil {
+			return fmt.Errorf("regex assertion: %w", err)
+		}
+	case AssertJSON:
+	case AssertJSONSchema:
+		var schema map[string]any
+		if err := json.Unmarshal(a.Schema, &schema); err != nil {
+			return fmt.Errorf("json-schema assertion: schema must be a JSON object: %w", err)
+		}
+		if err := checkSchema(schema, "schema"); err != nil {
+			return fmt.Errorf("json-schema assertion: %w", err)
+		}
+	case AssertMaxLength:
+		if a.Max == nil || *a.Max < 0 {
+			return fmt.Errorf("max-length assertion needs a maximum of at least 0")
+		}
+	case AssertRange:
+		if a.Min == nil && a.Max == nil {
+			return fmt.Errorf("range assertion needs a minimum or a maximum")
+		}
+		if a.Min != nil && a.Max != nil && *a.Min > *a.Max {
+			return fmt.Errorf("range assertion has a minimum above its maximum")
+		}
+	case AssertJudge:
+		if vault, name, _ := strings.Cut(strings.Split(a.Grader, "@")[0], "/"); vault == "" || name == "" {
+			return fmt.Errorf("judge assertion needs a grader prompt as <vault>/<name>")
+		}
+		if a.Min == nil {
+			return fmt.Errorf("judge assertion needs a minimum passing score")
+		}
+	default:
+		return fmt.Errorf("unknown assertion type %q (supported: %s)", a.Type, strings.Join(AssertionTypes, ", "))
+	}
+	return nil
+}
+
+// String describes the assertion.
+func (a Assertion) String() string {
+	switch a.Type {
+	case AssertContains, AssertNotContains, AssertRegex:
+		return fmt.Sprintf("%s %q", a.Type, a.Value)
+	case AssertMaxLength:
+		return fmt.Sprintf("%s %g", a.Type, *a.Max)
+	case AssertRange:
+		low, high := "", ""
+		if a.Min != nil {
+			low = strconv.FormatFloat(*a.Min, 'g', -1, 64)
+		}
+		if a.Max != nil {
+			high = strconv.FormatFloat(*a.Max, 'g', -1, 64)
+		}
+		return fmt.Sprintf("%s %s..%s", a.Type, low, high)
+	case AssertJudge:
+		if a.Criteria != "" {
+			return fmt.Sprintf("%s %s %q >= %g", a.Type, a.Grader, a.Criteria, *a.Min)
+		}
+		return fmt.Sprintf("%s %s >= %g", a.Type, a.Grader, *a.Min)
+	}
+	return a.Type
+}
+
+// Check returns nil if response satisfies the assertion, or why not.
+func (a Assertion) Check(response string) error {
+	switch a.Type {
+	case AssertContains:
+		if !strings.Contains(response, a.Value) {
+			return fmt.Errorf("response does not contain %q", a.Value)
+		}
+	case AssertNotContains:
+		if strings.Contains(response, a.Value) {
+			return fmt.Errorf("response contains %q", a.Value)
+		}
+	case AssertRegex:
+		re, err := regexp.Compile(a.Value)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(response) {
+			return fmt.Errorf("response does not match %s", a.Value)
+		}
+	case AssertJSON:
+		if !json.Valid([]byte(response)) {
+			var v any
+			return fmt.Errorf("response is not valid JSON: %v", json.Unmarshal([]byte(response), &v))
+		}
+	case AssertJSONSchema:
+		var schema map[string]any
+		if err := json.Unmarshal(a.Schema, &schema); err != nil {
+			return fmt.Errorf("invalid schema: %w", err)
+		}
+		if err := checkSchema(schema, "schema"); err != nil {
+			return fmt.Errorf("invalid schema: %w", err)
+		}
+		var value any
+		if err := json.Unmarshal([]byte(response), &value); err != nil {
+			return fmt.Errorf("response is not valid JSON: %v", err)
+		}
+		return validateSchema(schema, value, "$")
+	case AssertMaxLength:
+		if n := utf8.RuneCountInString(response); float64(n) > *a.Max {
+			return fmt.Errorf("response is %d characters long, over %g", n, *a.Max)
+		}
+	case AssertRange:
+		n, err := strconv.ParseFloat(strings.TrimSpace(response), 64)
+		if err != nil {
+			return fmt.Errorf("response is not a number")
+		}
+		if a.Min != nil && n < *a.Min {
+			return fmt.Errorf("response %g is below %g", n, *a.Min)
+		}
+		if a.Max != nil && n > *a.Max {
+			return fmt.Errorf("response %g is above %g", n, *a.Max)
+		}
+	case AssertJudge:
+		return fmt.Errorf("judge assertions are checked by their grader")
+	default:
+		return fmt.Errorf("unknown assertion type %q", a.Type)
+	}
+	return nil
+}
+
+// Result is the outcome of an assertion, as stored with an evaluated run.
+// Judge assertions also record the grade and the grader's run.
+type Result struct {
+	Assertion   string   `json:"assertion"`
+	Passed      bool     `json:"passed"`
+	Message     string   `json:"message,omitempty"`
+	Score       *float64 `json:"score,omitempty"`
+	Rationale   string   `json:"rationale,omitempty"`
+	GraderRunID int      `json:"grader_run,omitempty"`
+}
+
+// Check checks response against every assertion. judge returns the outcome
+// of the judge assertion at an index; without it they fail.
+func Check(assertions []Assertion, response string, judge func(i int) Result) []Result {
+	results := make([]Result, 0, len(assertions))
+	for i, a := range assertions {
+		if a.Type == AssertJudge {
+			if judge == nil {
+				results = append(results, Result{Assertion: a.String(), Message: "not graded"})
+			} else {
+				results = append(results, judge(i))
+			}
+			continue
+		}
+		result := Result{Assertion: a.String(), Passed: true}
+		if err := a.Check(response); err != nil {
+			result.Passed = false
+			result.Message = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Case is a test case of a suite as written in suite files.
+type Case struct {
+	Name   string         `json:"name"`
+	Vars   map[string]any `json:"vars,omitempty"`
+	Assert []Assertion    `json:"assert"`
+}
+
+// Validate checks that the case is named and its assertions complete.
+func (c Case) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("case has no name")
+	}
+	for _, a := range c.Assert {
+		if err := a.Validate(); err != nil {
+			return fmt.Errorf("case %s: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// ReadSuite reads cases from a .json file holding a list of them or a
+// .jsonl file holding one per line.
+func ReadSuite(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.Unmarshal(data, &cases); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".jsonl":
+		for i, line := range strings.Split(string(data), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			var c Case
+			if err := json.Unmarshal([]byte(line), &c); err != nil {
+				return nil, fmt.Errorf("%s: line %d: %w", path, i+1, err)
+			}
+			cases = append(cases, c)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported suite %s (expected a .json or .jsonl file)", path)
+	}
+	for _, c := range cases {
+		if err := c.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return cases, nil
+}
@@ -0,0 +1,100 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Grade is a grader's verdict on a response: a score and why it was given.
+type Grade struct {
+	Score     *float64 `json:"score"`
+	Rationale string   `json:"rationale"`
+}
+
+// ParseGrade reads the grade a grader responded with: a JSON object with a
+// score and a rationale, possibly wrapped in a code block or other text.
+func ParseGrade(response string) (Grade, error) {
+	var grade Grade
+	start, end := strings.Index(response, "{"), strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return grade, fmt.Errorf("grader responded without a JSON object")
+	}
+	if err := json.Unmarshal([]byte(response[start:end+1]), &grade); err != nil {
+		return grade, fmt.Errorf("grader responded with an invalid grade: %v", err)
+	}
+	if grade.Score == nil {
+		return grade, fmt.Errorf("grader responded without a score")
+	}
+	return grade, nil
+}
+
+// Judge returns the outcome of a judge assertion whose response was given
+// grade.
+func (a Assertion) Judge(grade Grade) Result {
+	result := Result{
+		Assertion: a.String(),
+		Passed:    *grade.Score >= *a.Min,
+		Score:     grade.Score,
+		Rationale: grade.Rationale,
+	}
+	if !result.Passed {
+		result.Message = fmt.Sprintf("score %g is below %g", *grade.Score, *a.Min)
+	}
+	return result
+}
+
+// GraderVars returns the variables a judge assertion's grader prompt is
+// rendered with: the response graded, the input it answered, the
+// assertion's criteria and the variables of the case.
+func (a Assertion) GraderVars(input, response string, vars map[string]any) map[string]any {
+	return map[string]any{
+		"response": response,
+		"input":    input,
+		"criteria": a.Criteria,
+		"vars":     vars,
+	}
+}
+
+// Score aggregates the grades a judge assertion gave across a suite.
+type Score struct {
+	Assertion string  `json:"assertion"`
+	Cases     int     `json:"cases"`
+	Passed    int     `json:"passed"`
+	Mean      float64 `json:"mean"`
+	Lowest    float64 `json:"lowest"`
+	Highest   float64 `json:"highest"`
+}
+
+// Scores aggregates the graded results of the cases of a suite, one score
+// per judge assertion in the order they first appear.
+func Scores(cases [][]Result) []Score {
+	var scores []Score
+	index := map[string]int{}
+	for _, results := range cases {
+		for _, result := range results {
+			if result.Score == nil {
+				continue
+			}
+			i, ok := index[result.Assertion]
+			if !ok {
+				i = len(scores)
+				index[result.Assertion] = i
+				scores = append(scores, Score{Assertion: result.Assertion, Lowest: math.Inf(1), Highest: math.Inf(-1)})
+			}
+			s := &scores[i]
+			s.Cases++
+			if result.Passed {
+				s.Passed++
+			}
+			s.Mean += *result.Score
+			s.Lowest = min(s.Lowest, *result.Score)
+			s.Highest = max(s.Highest, *result.Score)
+		}
+	}
+	for i := range scores {
+		scores[i].Mean /= float64(scores[i].Cases)
+	}
+	return scores
+}
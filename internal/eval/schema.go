@@ -0,0 +1,330 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// schemaKeywords are the JSON Schema keywords validateSchema supports: those
+// used to describe structured output.
+var schemaKeywords = []string{
+	"type", "enum", "const", "properties", "required", "additionalProperties", "items", "minItems", "maxItems",
+	"minLength", "maxLength", "pattern", "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum",
+	"allOf", "anyOf", "oneOf",
+}
+
+// schemaAnnotations are keywords that document a schema without
+// constraining values.
+var schemaAnnotations = []string{"$schema", "$id", "$comment", "title", "description", "default", "examples"}
+
+// schemaTypes are the names the type keyword accepts.
+var schemaTypes = []string{"null", "boolean", "object", "array", "number", "integer", "string"}
+
+// checkSchema reports the first keyword of schema, or of one of its
+// subschemas, that validateSchema does not support or whose value is
+// malformed, so that a schema is never silently checked only in part. path
+// locates schema for errors.
+func checkSchema(schema map[string]any, path string) error {
+	keywords := make([]string, 0, len(schema))
+	for keyword := range schema {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+
+	for _, keyword := range keywords {
+		value := schema[keyword]
+		at := path + "." + keyword
+		switch keyword {
+		case "type":
+			names, ok := value.([]any)
+			if !ok {
+				names = []any{value}
+			}
+			for _, name := range names {
+				if s, ok := name.(string); !ok || !slices.Contains(schemaTypes, s) {
+					return fmt.Errorf("%s: unknown type %s", at, compact(name))
+				}
+			}
+		case "enum":
+			if _, ok := value.([]any); !ok {
+				return fmt.Errorf("%s: must be an array", at)
+			}
+		case "required":
+			names, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("%s: must be an array of property names", at)
+			}
+			for _, name := range names {
+				if _, ok := name.(string); !ok {
+					return fmt.Errorf("%s: must be an array of property names", at)
+				}
+			}
+		case "properties":
+			properties, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: must be an object of schemas", at)
+			}
+			names := make([]string, 0, len(properties))
+			for name := range properties {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if err := checkSubschema(properties[name], at+"."+name); err != nil {
+					return err
+				}
+			}
+		case "additionalProperties":
+			if _, ok := value.(bool); !ok {
+				if err := checkSubschema(value, at); err != nil {
+					return err
+				}
+			}
+		case "items":
+			if err := checkSubschema(value, at); err != nil {
+				return err
+			}
+		case "allOf", "anyOf", "oneOf":
+			subs, ok := value.([]any)
+			if !ok || len(subs) == 0 {
+				return fmt.Errorf("%s: must be a non-empty array of schemas", at)
+			}
+			for i, sub := range subs {
+				if err := checkSubschema(sub, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+					return err
+				}
+			}
+		case "minItems", "maxItems", "minLength", "maxLength", "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			if _, ok := number(value); !ok {
+				return fmt.Errorf("%s: must be a number", at)
+			}
+		case "pattern":
+			pattern, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s: must be a string", at)
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("%s: %w", at, err)
+			}
+		case "const":
+		default:
+			if !slices.Contains(schemaAnnotations, keyword) {
+				return fmt.Errorf("%s: unsupported keyword (supported: %s)", at, strings.Join(schemaKeywords, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+func checkSubschema(value any, path string) error {
+	schema, ok := value.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s: must be a schema object", path)
+	}
+	return checkSchema(schema, path)
+}
+
+// validateSchema checks value, decoded from JSON, against a JSON Schema
+// accepted by checkSchema. path locates value in the response for errors.
+func validateSchema(schema map[string]any, value any, path string) error {
+	if types, ok := schema["type"]; ok {
+		var names []string
+		switch t := types.(type) {
+		case string:
+			names = []string{t}
+		case []any:
+			for _, name := range t {
+				if s, ok := name.(string); ok {
+					names = append(names, s)
+				}
+			}
+		}
+		if !slices.ContainsFunc(names, func(name string) bool { return hasType(value, name) }) {
+			return fmt.Errorf("%s: expected %s, got %s", path, joinTypes(names), typeOf(value))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		if !slices.ContainsFunc(enum, func(v any) bool { return reflect.DeepEqual(v, value) }) {
+			return fmt.Errorf("%s: %s is not one of the allowed values", path, compact(value))
+		}
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, value) {
+		return fmt.Errorf("%s: expected %s", path, compact(c))
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		if err := validateObject(schema, v, path); err != nil {
+			return err
+		}
+	case []any:
+		if n, ok := number(schema["minItems"]); ok && float64(len(v)) < n {
+			return fmt.Errorf("%s: expected at least %g items, got %d", path, n, len(v))
+		}
+		if n, ok := number(schema["maxItems"]); ok && float64(len(v)) > n {
+			return fmt.Errorf("%s: expected at most %g items, got %d", path, n, len(v))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := number(schema["minLength"]); ok && length < n {
+			return fmt.Errorf("%s: expected at least %g characters, got %g", path, n, length)
+		}
+		if n, ok := number(schema["maxLength"]); ok && length > n {
+			return fmt.Errorf("%s: expected at most %g characters, got %g", path, n, length)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: invalid pattern in schema: %w", path, err)
+			}
+			if !re.MatchString(v) {
+				return fmt.Errorf("%s: %q does not match %s", path, v, pattern)
+			}
+		}
+	case float64:
+		if n, ok := number(schema["minimum"]); ok && v < n {
+			return fmt.Errorf("%s: %g is below the minimum %g", path, v, n)
+		}
+		if n, ok := number(schema["maximum"]); ok && v > n {
+			return fmt.Errorf("%s: %g is above the maximum %g", path, v, n)
+		}
+		if n, ok := number(schema["exclusiveMinimum"]); ok && v <= n {
+			return fmt.Errorf("%s: %g is not above %g", path, v, n)
+		}
+		if n, ok := number(schema["exclusiveMaximum"]); ok && v >= n {
+			return fmt.Errorf("%s: %g is not below %g", path, v, n)
+		}
+	}
+
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			if s, ok := sub.(map[string]any); ok {
+				if err := validateSchema(s, value, path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		subs, ok := schema[keyword].([]any)
+		if !ok {
+			continue
+		}
+		matches := 0
+		for _, sub := range subs {
+			if s, ok := sub.(map[string]any); ok && validateSchema(s, value, path) == nil {
+				matches++
+			}
+		}
+		if matches == 0 {
+			return fmt.Errorf("%s: matches none of the schemas of %s", path, keyword)
+		}
+		if keyword == "oneOf" && matches > 1 {
+			return fmt.Errorf("%s: matches %d schemas of oneOf, expected 1", path, matches)
+		}
+	}
+	return nil
+}
+
+func validateObject(schema map[string]any, object map[string]any, path string) error {
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if s, ok := name.(string); ok {
+				if _, ok := object[s]; !ok {
+					return fmt.Errorf("%s: missing required property %q", path, s)
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propertyPath := path + "." + name
+		if property, ok := properties[name].(map[string]any); ok {
+			if err := validateSchema(property, object[name], propertyPath); err != nil {
+				return err
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: property is not allowed", propertyPath)
+			}
+		case map[string]any:
+			if err := validateSchema(additional, object[name], propertyPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasType reports whether value, decoded from JSON, is of a JSON Schema
+// type.
+func hasType(value any, name string) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return typeOf(value) == name
+}
+
+func typeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func joinTypes(names []string) string {
+	if len(names) == 1 {
+		return names[0]
+	}
+	return fmt.Sprintf("one of %v", names)
+}
+
+func number(v any) (float64, bool) {
+	n, ok := v.(float64)
+	return n, ok
+}
+
+func compact(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
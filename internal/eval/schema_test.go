@@ -0,0 +1,248 @@
+package eval
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	for _, tt := range []struct {
+		keyword string
+		schema  string
+		valid   []string
+		invalid []string
+	}{
+		{
+			keyword: "type",
+			schema:  `{"type": "string"}`,
+			valid:   []string{`"a"`, `""`},
+			invalid: []string{`1`, `null`, `[]`, `{}`, `true`},
+		},
+		{
+			keyword: "type list",
+			schema:  `{"type": ["integer", "null"]}`,
+			valid:   []string{`1`, `-3`, `2.0`, `null`},
+			invalid: []string{`1.5`, `"1"`},
+		},
+		{
+			keyword: "type number",
+			schema:  `{"type": "number"}`,
+			valid:   []string{`1`, `1.5`},
+			invalid: []string{`"1"`, `false`},
+		},
+		{
+			keyword: "type object, array and boolean",
+			schema:  `{"anyOf": [{"type": "object"}, {"type": "array"}, {"type": "boolean"}]}`,
+			valid:   []string{`{}`, `[]`, `false`},
+			invalid: []string{`0`, `"x"`, `null`},
+		},
+		{
+			keyword: "enum",
+			schema:  `{"enum": ["red", 1, null, {"a": 1}]}`,
+			valid:   []string{`"red"`, `1`, `null`, `{"a": 1}`},
+			invalid: []string{`"blue"`, `2`, `{"a": 2}`},
+		},
+		{
+			keyword: "const",
+			schema:  `{"const": {"ok": true}}`,
+			valid:   []string{`{"ok": true}`},
+			invalid: []string{`{"ok": false}`, `{}`, `true`},
+		},
+		{
+			keyword: "properties",
+			schema:  `{"properties": {"name": {"type": "string"}, "age": {"type": "integer"}}}`,
+			valid:   []string{`{}`, `{"name": "a"}`, `{"name": "a", "age": 3, "other": []}`, `"not an object"`},
+			invalid: []string{`{"name": 1}`, `{"age": 1.5}`},
+		},
+		{
+			keyword: "required",
+			schema:  `{"required": ["name"]}`,
+			valid:   []string{`{"name": null}`, `[]`},
+			invalid: []string{`{}`, `{"other": 1}`},
+		},
+		{
+			keyword: "additionalProperties false",
+			schema:  `{"properties": {"name": {}}, "additionalProperties": false}`,
+			valid:   []string{`{}`, `{"name": 1}`},
+			invalid: []string{`{"other": 1}`},
+		},
+		{
+			keyword: "additionalProperties schema",
+			schema:  `{"properties": {"name": {}}, "additionalProperties": {"type": "number"}}`,
+			valid:   []string{`{"name": "a", "x": 1}`},
+			invalid: []string{`{"x": "1"}`},
+		},
+		{
+			keyword: "items",
+			schema:  `{"items": {"type": "string"}}`,
+			valid:   []string{`[]`, `["a", "b"]`, `{}`},
+			invalid: []string{`["a", 1]`},
+		},
+		{
+			keyword: "minItems",
+			schema:  `{"minItems": 2}`,
+			valid:   []string{`[1, 2]`, `[1, 2, 3]`, `"x"`},
+			invalid: []string{`[]`, `[1]`},
+		},
+		{
+			keyword: "maxItems",
+			schema:  `{"maxItems": 1}`,
+			valid:   []string{`[]`, `[1]`},
+			invalid: []string{`[1, 2]`},
+		},
+		{
+			keyword: "minLength",
+			schema:  `{"minLength": 2}`,
+			valid:   []string{`"ab"`, `"éé"`, `3`},
+			invalid: []string{`""`, `"a"`, `"é"`},
+		},
+		{
+			keyword: "maxLength",
+			schema:  `{"maxLength": 2}`,
+			valid:   []string{`""`, `"éé"`},
+			invalid: []string{`"abc"`},
+		},
+		{
+			keyword: "pattern",
+			schema:  `{"pattern": "^[a-z]+$"}`,
+			valid:   []string{`"abc"`, `1`},
+			invalid: []string{`"ABC"`, `""`},
+		},
+		{
+			keyword: "minimum",
+			schema:  `{"minimum": 1}`,
+			valid:   []string{`1`, `2.5`, `"0"`},
+			invalid: []string{`0`, `0.99`},
+		},
+		{
+			keyword: "maximum",
+			schema:  `{"maximum": 1}`,
+			valid:   []string{`1`, `-5`},
+			invalid: []string{`1.01`},
+		},
+		{
+			keyword: "exclusiveMinimum",
+			schema:  `{"exclusiveMinimum": 1}`,
+			valid:   []string{`1.01`},
+			invalid: []string{`1`, `0`},
+		},
+		{
+			keyword: "exclusiveMaximum",
+			schema:  `{"exclusiveMaximum": 1}`,
+			valid:   []string{`0.99`},
+			invalid: []string{`1`, `2`},
+		},
+		{
+			keyword: "allOf",
+			schema:  `{"allOf": [{"type": "integer"}, {"minimum": 2}]}`,
+			valid:   []string{`2`, `10`},
+			invalid: []string{`1`, `2.5`},
+		},
+		{
+			keyword: "anyOf",
+			schema:  `{"anyOf": [{"type": "string"}, {"minimum": 2}]}`,
+			valid:   []string{`"a"`, `3`},
+			invalid: []string{`1`},
+		},
+		{
+			keyword: "oneOf",
+			schema:  `{"oneOf": [{"type": "integer"}, {"minimum": 2}]}`,
+			valid:   []string{`1`, `2.5`},
+			invalid: []string{`3`, `0.5`},
+		},
+		{
+			keyword: "nested",
+			schema: `{"type": "object", "required": ["items"], "properties": {"items": {"type": "array",
+				"items": {"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}}}}}}`,
+			valid:   []string{`{"items": []}`, `{"items": [{"id": 1}, {"id": 2}]}`},
+			invalid: []string{`{"items": [{"id": 1}, {}]}`, `{"items": [{"id": "1"}]}`},
+		},
+		{
+			keyword: "annotations",
+			schema:  `{"$schema": "https://json-schema.org/draft/2020-12/schema", "title": "t", "description": "d", "type": "string"}`,
+			valid:   []string{`"a"`},
+			invalid: []string{`1`},
+		},
+	} {
+		t.Run(tt.keyword, func(t *testing.T) {
+			var schema map[string]any
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			if err := checkSchema(schema, "schema"); err != nil {
+				t.Fatalf("checkSchema: %v", err)
+			}
+			for _, value := range tt.valid {
+				if err := validateSchema(schema, decode(t, value), "$"); err != nil {
+					t.Errorf("%s: %v", value, err)
+				}
+			}
+			for _, value := range tt.invalid {
+				if err := validateSchema(schema, decode(t, value), "$"); err == nil {
+					t.Errorf("%s: passed, want an error", value)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{"ref", `{"$ref": "#/$defs/item"}`, "schema.$ref: unsupported keyword"},
+		{"defs", `{"$defs": {"item": {}}}`, "schema.$defs: unsupported keyword"},
+		{"not", `{"not": {"type": "null"}}`, "schema.not: unsupported keyword"},
+		{"if", `{"if": {}, "then": {}, "else": {}}`, "schema.else: unsupported keyword"},
+		{"patternProperties", `{"patternProperties": {"^x": {}}}`, "schema.patternProperties: unsupported keyword"},
+		{"prefixItems", `{"prefixItems": [{}]}`, "schema.prefixItems: unsupported keyword"},
+		{"format", `{"type": "string", "format": "email"}`, "schema.format: unsupported keyword"},
+		{"nested in properties", `{"properties": {"a": {"not": {}}}}`, "schema.properties.a.not: unsupported keyword"},
+		{"nested in items", `{"items": {"uniqueItems": true}}`, "schema.items.uniqueItems: unsupported keyword"},
+		{"nested in anyOf", `{"anyOf": [{}, {"dependentRequired": {}}]}`, "schema.anyOf[1].dependentRequired: unsupported keyword"},
+		{
+			"nested in additionalProperties",
+			`{"additionalProperties": {"propertyNames": {}}}`,
+			"schema.additionalProperties.propertyNames: unsupported keyword",
+		},
+		{"unknown type", `{"type": "int"}`, `schema.type: unknown type "int"`},
+		{"tuple items", `{"items": [{}]}`, "schema.items: must be a schema object"},
+		{"empty anyOf", `{"anyOf": []}`, "schema.anyOf: must be a non-empty array of schemas"},
+		{"required not a list", `{"required": "name"}`, "schema.required: must be an array of property names"},
+		{"enum not a list", `{"enum": "a"}`, "schema.enum: must be an array"},
+		{"bound not a number", `{"minimum": "1"}`, "schema.minimum: must be a number"},
+		{"bad pattern", `{"pattern": "("}`, "schema.pattern: error parsing regexp"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema map[string]any
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			err := checkSchema(schema, "schema")
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("checkSchema = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAssertionRejectsUnsupportedSchema(t *testing.T) {
+	if _, err := ParseAssertion(`json-schema={"type": "object", "$ref": "#/$defs/x"}`); err == nil {
+		t.Error("ParseAssertion accepted a schema with $ref")
+	}
+	if _, err := ParseAssertion(`json-schema={"type": "object", "required": ["a"]}`); err != nil {
+		t.Errorf("ParseAssertion: %v", err)
+	}
+}
+
+func decode(t *testing.T, value string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
@@ -0,0 +1,224 @@
+// Package pricing computes what runs cost from a local table of token
+// prices, kept in ~/.promptctl/pricing.json.
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Price is what a model charges, in US dollars per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Table holds prices by provider and model. The model "*" prices every
+// model of a provider without an entry of its own.
+type Table map[string]map[string]Price
+
+// Default is the table used until pricing.json is written: list prices at
+// the time of writing. Edit pricing.json to match what you pay.
+var Default = Table{
+	"openai": {
+		"gpt-5":        {Input: 1.25, Output: 10},
+		"gpt-5-mini":   {Input: 0.25, Output: 2},
+		"gpt-4.1":      {Input: 2, Output: 8},
+		"gpt-4.1-mini": {Input: 0.4, Output: 1.6},
+		"gpt-4.1-nano": {Input: 0.1, Output: 0.4},
+		"gpt-4o":       {Input: 2.5, Output: 10},
+		"gpt-4o-mini":  {Input: 0.15, Output: 0.6},
+		"o3":           {Input: 2, Output: 8},
+		"o4-mini":      {Input: 1.1, Output: 4.4},
+	},
+	"anthropic": {
+		"claude-opus-4":     {Input: 15, Output: 75},
+		"claude-opus-4-1":   {Input: 15, Output: 75},
+		"claude-sonnet-4":   {Input: 3, Output: 15},
+		"claude-sonnet-4-5": {Input: 3, Output: 15},
+		"claude-3-7-sonnet": {Input: 3, Output: 15},
+		"claude-haiku-4-5":  {Input: 1, Output: 5},
+		"claude-3-5-haiku":  {Input: 0.8, Output: 4},
+	},
+	"google": {
+		"gemini-2.5-pro":        {Input: 1.25, Output: 10},
+		"gemini-2.5-flash":      {Input: 0.3, Output: 2.5},
+		"gemini-2.5-flash-lite": {Input: 0.1, Output: 0.4},
+		"gemini-2.0-flash":      {Input: 0.1, Output: 0.4},
+	},
+	"mock": {
+		"*": {},
+	},
+}
+
+// Path returns the path of pricing.json.
+func Path() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".promptctl", "pricing.json"), nil
+}
+
+// Load reads pricing.json, or returns a copy of Default if it does not
+// exist yet.
+func Load() (Table, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Default.clone(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var table Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if table == nil {
+		table = Table{}
+	}
+	return table, nil
+}
+
+// Save writes table to pricing.json.
+func Save(table Table) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(table, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func (t Table) clone() Table {
+	clone := make(Table, len(t))
+	for provider, models := range t {
+		clone[provider] = make(map[string]Price, len(models))
+		for model, price := range models {
+			clone[provider][model] = price
+		}
+	}
+	return clone
+}
+
+// Set prices model of provider.
+func (t Table) Set(provider, model string, price Price) {
+	if t[provider] == nil {
+		t[provider] = make(map[string]Price)
+	}
+	t[provider][model] = price
+}
+
+// Unset removes the price of model of provider, reporting whether there was
+// one.
+func (t Table) Unset(provider, model string) bool {
+	if _, ok := t[provider][model]; !ok {
+		return false
+	}
+	delete(t[provider], model)
+	if len(t[provider]) == 0 {
+		delete(t, provider)
+	}
+	return true
+}
+
+// versionSuffix matches what providers append to a model name to report
+// the version that answered: a date, as in gpt-4o-2024-08-06 or
+// claude-sonnet-4-20250514, "-latest", or an "@" version as on Vertex AI.
+var versionSuffix = regexp.MustCompile(`^(-\d{4}-\d{2}-\d{2}|-\d{8}|-latest|@.+)$`)
+
+// Lookup returns the price of model of provider. Providers report dated
+// model versions, so a model without an exact entry takes the price of the
+// entry it extends with a version suffix, then the provider's "*" entry.
+// Other models, such as o3-mini next to o3, are not priced by a shorter
+// name. An account suffix on the provider, as in "openai:team-a", is
+// ignored.
+func (t Table) Lookup(provider, model string) (Price, bool) {
+	provider, _, _ = strings.Cut(provider, ":")
+	models := t[provider]
+	if price, ok := models[model]; ok {
+		return price, true
+	}
+
+	best := ""
+	for name := range models {
+		if len(name) > len(best) && strings.HasPrefix(model, name) && versionSuffix.MatchString(model[len(name):]) {
+			best = name
+		}
+	}
+	if best != "" {
+		return models[best], true
+	}
+
+	price, ok := models["*"]
+	return price, ok
+}
+
+// Prompt tokens read from or written to a provider's prompt cache are
+// charged these fractions of the input price, as Anthropic does for its
+// default five-minute cache.
+const (
+	CacheReadRate  = 0.1
+	CacheWriteRate = 1.25
+)
+
+// Tokens is what a run used. CacheRead and CacheWrite are the part of
+// Prompt read from and written to the provider's prompt cache.
+type Tokens struct {
+	Prompt     int
+	CacheRead  int
+	CacheWrite int
+	Completion int
+}
+
+// Cost returns what a run of model on provider that used tokens cost, and
+// whether the model has a price.
+func (t Table) Cost(provider, model string, tokens Tokens) (float64, bool) {
+	price, ok := t.Lookup(provider, model)
+	if !ok {
+		return 0, false
+	}
+	uncached := tokens.Prompt - tokens.CacheRead - tokens.CacheWrite
+	input := float64(uncached) + CacheReadRate*float64(tokens.CacheRead) + CacheWriteRate*float64(tokens.CacheWrite)
+	return (input*price.Input + float64(tokens.Completion)*price.Output) / 1e6, true
+}
+
+// Entry is one price of a table.
+type Entry struct {
+	Provider string
+	Model    string
+	Price
+}
+
+// Entries returns the table's prices sorted by provider and model.
+func (t Table) Entries() []Entry {
+	var entries []Entry
+	for provider, models := range t {
+		for model, price := range models {
+			entries = append(entries, Entry{Provider: provider, Model: model, Price: price})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Provider != entries[j].Provider {
+			return entries[i].Provider < entries[j].Provider
+		}
+		return entries[i].Model < entries[j].Model
+	})
+	return entries
+}
@@ -0,0 +1,70 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCost(t *testing.T) {
+	table := Table{"anthropic": {"claude-sonnet-4": {Input: 3, Output: 15}}}
+
+	for _, tt := range []struct {
+		name   string
+		tokens Tokens
+		want   float64
+	}{
+		{"uncached", Tokens{Prompt: 1e6, Completion: 1e6}, 18},
+		{"cache read", Tokens{Prompt: 1e6, CacheRead: 1e6}, 0.3},
+		{"cache write", Tokens{Prompt: 1e6, CacheWrite: 1e6}, 3.75},
+		{"mixed", Tokens{Prompt: 3e6, CacheRead: 1e6, CacheWrite: 1e6, Completion: 1e6}, 3 + 0.3 + 3.75 + 15},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, ok := table.Cost("anthropic", "claude-sonnet-4-20250514", tt.tokens)
+			if !ok {
+				t.Fatal("model has no price")
+			}
+			if math.Abs(cost-tt.want) > 1e-9 {
+				t.Errorf("cost = %g, want %g", cost, tt.want)
+			}
+		})
+	}
+
+	if _, ok := table.Cost("openai", "gpt-4o", Tokens{Prompt: 1}); ok {
+		t.Error("unpriced model has a cost")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, tt := range []struct {
+		provider, model string
+		want            float64
+		ok              bool
+	}{
+		{"openai", "gpt-4o", 2.5, true},
+		{"openai", "gpt-4o-2024-08-06", 2.5, true},
+		{"openai", "gpt-4o-mini", 0.15, true},
+		{"openai", "gpt-4o-mini-2024-07-18", 0.15, true},
+		{"openai", "gpt-4o-audio-preview", 0, false},
+		{"openai", "o3-2025-04-16", 2, true},
+		{"openai", "o3-mini", 0, false},
+		{"openai", "o3-pro", 0, false},
+		{"openai:team-a", "gpt-4o", 2.5, true},
+		{"anthropic", "claude-sonnet-4-20250514", 3, true},
+		{"anthropic", "claude-3-7-sonnet-latest", 3, true},
+		{"anthropic", "claude-opus-4@20250514", 15, true},
+		{"anthropic", "claude-opus-4-5", 0, false},
+		{"anthropic", "claude-opus-4-5-20251101", 0, false},
+		{"anthropic", "claude-opus-4-1-20250805", 15, true},
+		{"google", "gemini-2.5-flash-lite", 0.1, true},
+		{"google", "gemini-2.5-flash-preview-05-20", 0, false},
+		{"mock", "anything", 0, true},
+		{"unknown", "gpt-4o", 0, false},
+	} {
+		t.Run(tt.provider+"/"+tt.model, func(t *testing.T) {
+			price, ok := Default.Lookup(tt.provider, tt.model)
+			if ok != tt.ok || price.Input != tt.want {
+				t.Errorf("Lookup = %+v, %t, want input %g, %t", price, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
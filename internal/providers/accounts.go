@@ -0,0 +1,376 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAccount names a provider's own credentials, as opposed to one of
+// its named accounts.
+const DefaultAccount = "default"
+
+// Account rotation policies. With no policy the default account, or the
+// first named account when there is none, serves every request.
+const (
+	RotationNone = ""
+	// RotationRoundRobin uses the least recently used account first.
+	RotationRoundRobin = "round-robin"
+	// RotationLeastRateLimited uses the account that was least recently
+	// rate limited first.
+	RotationLeastRateLimited = "least-recently-rate-limited"
+)
+
+// Rotations lists the supported rotation policies.
+var Rotations = []string{RotationRoundRobin, RotationLeastRateLimited}
+
+// AccountPool holds named credentials for a provider in addition to its
+// default ones. Account "team-a" of provider "openai" is addressed as
+// "openai:team-a", which is also the name its key is stored under and the
+// base of its environment variable, OPENAI_TEAM_A_API_KEY.
+type AccountPool struct {
+	Accounts map[string]*Credentials `json:"accounts,omitempty"`
+	// Rotation is the policy for cycling accounts when a request is rate
+	// limited.
+	Rotation string `json:"rotation,omitempty"`
+}
+
+// AccountName returns the name an account of provider is addressed by.
+func AccountName(provider, account string) string {
+	return provider + ":" + account
+}
+
+// SplitAccountName splits "provider:account" into its parts. The account is
+// empty for a plain provider name.
+func SplitAccountName(name string) (provider, account string) {
+	provider, account, _ = strings.Cut(name, ":")
+	return provider, account
+}
+
+// IsValidRotation reports whether rotation is a supported policy.
+func IsValidRotation(rotation string) bool {
+	if rotation == RotationNone {
+		return true
+	}
+	for _, r := range Rotations {
+		if rotation == r {
+			return true
+		}
+	}
+	return false
+}
+
+// AccountNames returns the pool's account names in sorted order.
+func (p *AccountPool) AccountNames() []string {
+	names := make([]string, 0, len(p.Accounts))
+	for name := range p.Accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Pool returns the account pool of a built-in or custom provider, or nil
+// if there is no such provider.
+func (c *Config) Pool(provider string) *AccountPool {
+	switch provider {
+	case "openai":
+		return &c.OpenAI.AccountPool
+	case "anthropic":
+		return &c.Anthropic.AccountPool
+	case "google":
+		return &c.Google.AccountPool
+	}
+	if custom, ok := c.Custom[provider]; ok {
+		return &custom.AccountPool
+	}
+	return nil
+}
+
+type poolMember struct {
+	account string
+	llm     LLM
+}
+
+// accountPool is an LLM that sends requests through one of several accounts
+// of the same provider, moving on to the next account when one is rate
+// limited if a rotation policy is set.
+type accountPool struct {
+	name string
+	// stateKey identifies the pool in the account state, which is shared
+	// by all profiles.
+	stateKey string
+	rotation string
+	members  []poolMember
+}
+
+func (p *accountPool) Name() string {
+	return p.name
+}
+
+func (p *accountPool) Chat(ctx context.Context, messages []Message, opts Options) (*Response, error) {
+	return p.do(func(llm LLM) (*Response, bool, error) {
+		response, err := llm.Chat(ctx, messages, opts)
+		return response, true, err
+	})
+}
+
+func (p *accountPool) Stream(
+	ctx context.Context,
+	messages []Message,
+	opts Options,
+	onDelta func(string),
+) (*Response, error) {
+	return p.do(func(llm LLM) (*Response, bool, error) {
+		emitted := false
+		response, err := llm.Stream(ctx, messages, opts, func(delta string) {
+			emitted = true
+			onDelta(delta)
+		})
+		// Once text has been printed, retrying on another account would
+		// repeat it.
+		return response, !emitted, err
+	})
+}
+
+// do calls attempt with each account in the order given by the rotation
+// policy until one is not rate limited. attempt reports whether the request
+// may be retried on another account.
+func (p *accountPool) do(attempt func(LLM) (*Response, bool, error)) (*Response, error) {
+	if p.rotation == RotationNone {
+		member := p.members[0]
+		response, _, err := attempt(member.llm)
+		if response != nil {
+			response.Account = member.account
+		}
+		return response, err
+	}
+
+	state := sharedAccountState()
+	members := state.order(p)
+
+	var response *Response
+	var err error
+	for i, member := range members {
+		if i > 0 {
+			state.update(p.stateKey, member.account, func(usage *accountUsage) { usage.LastUsed = time.Now() })
+		}
+		var retryable bool
+		response, retryable, err = attempt(member.llm)
+		if response != nil {
+			response.Account = member.account
+		}
+
+		rateLimited := IsRateLimited(err)
+		if rateLimited {
+			state.update(p.stateKey, member.account, func(usage *accountUsage) { usage.RateLimited = time.Now() })
+		}
+		if !rateLimited || !retryable || i == len(members)-1 {
+			break
+		}
+	}
+	state.save()
+	return response, err
+}
+
+// accountUsage is what the rotation policies know about an account.
+type accountUsage struct {
+	LastUsed    time.Time `json:"last_used"`
+	RateLimited time.Time `json:"rate_limited,omitzero"`
+}
+
+// accountState is the account usage of every pool, kept in
+// ~/.promptctl/accounts.json so rotation carries over between runs. One
+// state is shared by every pool of the process.
+type accountState struct {
+	mu    sync.Mutex
+	path  string
+	pools map[string]map[string]accountUsage
+}
+
+var (
+	accountStateOnce sync.Once
+	accountStateData *accountState
+)
+
+// sharedAccountState returns the state of the process, read from
+// accounts.json on first use. A missing or unreadable file gives an empty
+// state; rotation then starts over from the first account.
+func sharedAccountState() *accountState {
+	accountStateOnce.Do(func() {
+		accountStateData = &accountState{pools: make(map[string]map[string]accountUsage)}
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return
+		}
+		accountStateData.path = filepath.Join(homeDir, ".promptctl", "accounts.json")
+		accountStateData.pools = readAccountState(accountStateData.path)
+	})
+	return accountStateData
+}
+
+func readAccountState(path string) map[string]map[string]accountUsage {
+	pools := make(map[string]map[string]accountUsage)
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &pools)
+	}
+	return pools
+}
+
+// order returns the members of pool in the order they should be tried and
+// marks the first as used, so that concurrent requests rotate too.
+func (s *accountState) order(pool *accountPool) []poolMember {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := s.pools[pool.stateKey]
+	members := append([]poolMember(nil), pool.members...)
+	switch pool.rotation {
+	case RotationRoundRobin:
+		sort.SliceStable(members, func(i, j int) bool {
+			return usage[members[i].account].LastUsed.Before(usage[members[j].account].LastUsed)
+		})
+	case RotationLeastRateLimited:
+		sort.SliceStable(members, func(i, j int) bool {
+			return usage[members[i].account].RateLimited.Before(usage[members[j].account].RateLimited)
+		})
+	}
+	s.updateLocked(pool.stateKey, members[0].account, func(usage *accountUsage) { usage.LastUsed = time.Now() })
+	return members
+}
+
+// update changes the usage of an account of pool with change.
+func (s *accountState) update(pool, account string, change func(*accountUsage)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updateLocked(pool, account, change)
+}
+
+func (s *accountState) updateLocked(pool, account string, change func(*accountUsage)) {
+	if s.pools[pool] == nil {
+		s.pools[pool] = make(map[string]accountUsage)
+	}
+	usage := s.pools[pool][account]
+	change(&usage)
+	s.pools[pool][account] = usage
+}
+
+// save writes the state to accounts.json, keeping the later times of any
+// account another process used meanwhile. The file is replaced by a rename
+// so that a concurrent reader never sees it half written.
+func (s *accountState) save() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.path == "" || len(s.pools) == 0 {
+		return
+	}
+	for pool, accounts := range readAccountState(s.path) {
+		for account, theirs := range accounts {
+			s.updateLocked(pool, account, func(usage *accountUsage) {
+				if theirs.LastUsed.After(usage.LastUsed) {
+					usage.LastUsed = theirs.LastUsed
+				}
+				if theirs.RateLimited.After(usage.RateLimited) {
+					usage.RateLimited = theirs.RateLimited
+				}
+			})
+		}
+	}
+	data, err := json.MarshalIndent(s.pools, "", "  ")
+	if err != nil {
+		return
+	}
+	writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic writes data to path with mode 0600 through a temporary
+// file in the same directory, so readers see the old file or the new one
+// and never a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// registerPool registers provider, built with build from its API key, and
+// each of its accounts, behind the provider's retry and rate limit
+// middleware. The provider itself is served by its default credentials and
+// its accounts according to its rotation policy. Unless keyOptional, the
+// default credentials are only used when a key is available, and a
+// provider with neither fails when first used.
+func (c *Config) registerPool(router *Router, provider string, keyOptional bool, build func(apiKey string) (LLM, error)) error {
+	pool := c.Pool(provider)
+	if !IsValidRotation(pool.Rotation) {
+		return fmt.Errorf("provider %s: unsupported rotation %q", provider, pool.Rotation)
+	}
+	limits := c.Settings(provider).Limits
+	policy, err := limits.policy()
+	if err != nil {
+		return fmt.Errorf("provider %s: %w", provider, err)
+	}
+	// Accounts share the provider's rate limit.
+	limiter := newRateLimiter(limits)
+
+	lazy := func(name string) LLM {
+		return newLazyLLM(name, func() (LLM, error) {
+			apiKey, err := c.ResolveAPIKey(name)
+			if err != nil {
+				return nil, err
+			}
+			return build(apiKey)
+		})
+	}
+
+	var members []poolMember
+	if keyOptional || c.KeySource(provider) != "" {
+		members = append(members, poolMember{account: DefaultAccount, llm: lazy(provider)})
+	}
+	for _, account := range pool.AccountNames() {
+		name := AccountName(provider, account)
+		member := poolMember{account: account, llm: lazy(name)}
+		members = append(members, member)
+		router.Register(withLimits(
+			&accountPool{name: name, stateKey: c.storeName(name), members: []poolMember{member}},
+			policy,
+			limiter,
+		))
+	}
+
+	if len(members) == 0 {
+		// Without credentials the provider is still registered, so using it
+		// says how to add a key rather than that it does not exist.
+		router.Register(newLazyLLM(provider, func() (LLM, error) {
+			return nil, fmt.Errorf("provider %s has no API key: set %s or run 'promptctl provider add %s'",
+				provider, strings.Join(KeyEnvVars(provider), " or "), provider)
+		}))
+		return nil
+	}
+	router.Register(withLimits(
+		&accountPool{
+			name:     provider,
+			stateKey: c.storeName(provider),
+			rotation: pool.Rotation,
+			members:  members,
+		},
+		policy,
+		limiter,
+	))
+	return nil
+}
@@ -0,0 +1,130 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// useFreshAccountState points the account state at an empty home
+// directory and returns the path of its accounts.json.
+func useFreshAccountState(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".promptctl"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	accountStateOnce = sync.Once{}
+	t.Cleanup(func() { accountStateOnce = sync.Once{} })
+	return filepath.Join(home, ".promptctl", "accounts.json")
+}
+
+// countingLLM answers every request and counts them.
+type countingLLM struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *countingLLM) Name() string {
+	return "counting"
+}
+
+func (c *countingLLM) Chat(ctx context.Context, messages []Message, opts Options) (*Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return &Response{Content: "ok"}, nil
+}
+
+func (c *countingLLM) Stream(ctx context.Context, messages []Message, opts Options, onDelta func(string)) (*Response, error) {
+	return c.Chat(ctx, messages, opts)
+}
+
+func TestAccountPoolRoundRobinConcurrent(t *testing.T) {
+	path := useFreshAccountState(t)
+
+	accounts := []string{"a", "b", "c"}
+	llms := make(map[string]*countingLLM)
+	pool := &accountPool{name: "openai", stateKey: "openai", rotation: RotationRoundRobin}
+	for _, account := range accounts {
+		llms[account] = &countingLLM{}
+		pool.members = append(pool.members, poolMember{account: account, llm: llms[account]})
+	}
+
+	const requests = 30
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.Chat(context.Background(), nil, Options{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every request takes the least recently used account, so concurrent
+	// requests are spread over all of them.
+	for _, account := range accounts {
+		if calls := llms[account].calls; calls != requests/len(accounts) {
+			t.Errorf("account %s served %d requests, want %d", account, calls, requests/len(accounts))
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]map[string]accountUsage
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("accounts.json: %v", err)
+	}
+	if len(saved["openai"]) != len(accounts) {
+		t.Errorf("accounts.json has %d accounts, want %d", len(saved["openai"]), len(accounts))
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("left %d files behind, want only accounts.json", len(entries))
+	}
+}
+
+func TestAccountStateSaveKeepsOtherProcesses(t *testing.T) {
+	path := useFreshAccountState(t)
+
+	pool := &accountPool{
+		name:     "openai",
+		stateKey: "openai",
+		rotation: RotationRoundRobin,
+		members:  []poolMember{{account: "a", llm: &countingLLM{}}},
+	}
+	if _, err := pool.Chat(context.Background(), nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process writes a pool of its own before this one saves again.
+	other := readAccountState(path)
+	other["profile/work/openai"] = map[string]accountUsage{"x": {}}
+	data, _ := json.Marshal(other)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Chat(context.Background(), nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := readAccountState(path)
+	if _, ok := saved["profile/work/openai"]["x"]; !ok {
+		t.Errorf("save dropped the other process's pool: %v", saved)
+	}
+	if _, ok := saved["openai"]["a"]; !ok {
+		t.Errorf("save dropped this process's pool: %v", saved)
+	}
+}
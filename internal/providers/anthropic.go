@@ -0,0 +1,165 @@
+package providers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+const (
+	defaultAnthropicModel     = anthropic.ModelClaudeSonnet4_20250514
+	defaultAnthropicMaxTokens = 1024
+)
+
+type AnthropicClient struct {
+	client anthropic.Client
+}
+
+func NewAnthropicClient(apiKey string, settings Settings) (*AnthropicClient, error) {
+	// Retries are left to the provider middleware.
+	opts := []option.RequestOption{option.WithAPIKey(apiKey), option.WithMaxRetries(0)}
+	if settings.BaseURL != "" {
+		opts = append(opts, option.WithBaseURL(settings.BaseURL))
+	}
+	for name, value := range settings.Headers {
+		opts = append(opts, option.WithHeader(name, value))
+	}
+
+	httpClient, err := settings.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		opts = append(opts, option.WithHTTPClient(httpClient))
+	}
+	return &AnthropicClient{client: anthropic.NewClient(opts...)}, nil
+}
+
+func (c *AnthropicClient) Name() string {
+	return "anthropic"
+}
+
+func (c *AnthropicClient) Chat(ctx context.Context, messages []Message, opts Options) (*Response, error) {
+	params, reported, err := c.params(messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := c.client.Messages.New(ctx, params)
+	if err != nil {
+		return nil, apiError(c.Name(), err)
+	}
+
+	var text strings.Builder
+	for _, block := range message.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+
+	reported.Model = string(message.Model)
+	return &Response{
+		Content:      text.String(),
+		Options:      reported,
+		FinishReason: string(message.StopReason),
+		Usage:        anthropicUsage(message.Usage),
+	}, nil
+}
+
+func (c *AnthropicClient) Stream(
+	ctx context.Context,
+	messages []Message,
+	opts Options,
+	onDelta func(string),
+) (*Response, error) {
+	params, reported, err := c.params(messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	message := anthropic.Message{}
+
+	stream := c.client.Messages.NewStreaming(ctx, params)
+	defer stream.Close()
+	for stream.Next() {
+		event := stream.Current()
+		if err = message.Accumulate(event); err != nil {
+			break
+		}
+		if event.Type == "content_block_delta" && event.Delta.Type == "text_delta" {
+			text.WriteString(event.Delta.Text)
+			onDelta(event.Delta.Text)
+		}
+	}
+
+	if err == nil {
+		err = stream.Err()
+	}
+	if message.Model != "" {
+		reported.Model = string(message.Model)
+	}
+	return &Response{
+		Content:      text.String(),
+		Options:      reported,
+		FinishReason: string(message.StopReason),
+		Usage:        anthropicUsage(message.Usage),
+	}, apiError(c.Name(), err)
+}
+
+// anthropicUsage counts cached prompt tokens as prompt tokens, keeping
+// apart those read from and written to the cache.
+func anthropicUsage(usage anthropic.Usage) Usage {
+	return Usage{
+		PromptTokens:     int(usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens),
+		CompletionTokens: int(usage.OutputTokens),
+		CacheReadTokens:  int(usage.CacheReadInputTokens),
+		CacheWriteTokens: int(usage.CacheCreationInputTokens),
+	}
+}
+
+// params builds the request along with the options as they will be applied:
+// the Messages API requires max_tokens and has no seed parameter.
+func (c *AnthropicClient) params(
+	messages []Message,
+	opts Options,
+) (anthropic.MessageNewParams, Options, error) {
+	system, conversation := splitSystem(messages)
+
+	reported := opts
+	reported.Seed = nil
+	if reported.MaxTokens == nil {
+		maxTokens := defaultAnthropicMaxTokens
+		reported.MaxTokens = &maxTokens
+	}
+
+	params := anthropic.MessageNewParams{
+		MaxTokens:     int64(*reported.MaxTokens),
+		Model:         anthropic.Model(opts.modelOr(string(defaultAnthropicModel))),
+		StopSequences: opts.Stop,
+	}
+	for _, text := range system {
+		params.System = append(params.System, anthropic.TextBlockParam{Text: text})
+	}
+	for _, msg := range conversation {
+		switch msg.Role {
+		case RoleUser:
+			params.Messages = append(params.Messages,
+				anthropic.NewUserMessage(anthropic.NewTextBlock(msg.Content)))
+		case RoleAssistant:
+			params.Messages = append(params.Messages,
+				anthropic.NewAssistantMessage(anthropic.NewTextBlock(msg.Content)))
+		default:
+			return params, reported, unsupportedRole(c.Name(), msg.Role)
+		}
+	}
+	if opts.Temperature != nil {
+		params.Temperature = anthropic.Float(*opts.Temperature)
+	}
+	if opts.TopP != nil {
+		params.TopP = anthropic.Float(*opts.TopP)
+	}
+	return params, reported, nil
+}
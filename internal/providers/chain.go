@@ -0,0 +1,227 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ChainPrefix marks a provider name that refers to a fallback chain:
+// "chain:default" is the chain named "default" in the profile.
+const ChainPrefix = "chain:"
+
+// PromptChain is the provider name of the fallback chain stored with the
+// prompt being run.
+const PromptChain = "chain"
+
+// Chain is an ordered list of providers to fall back through. Each hop is
+// tried in turn until one answers; a hop is skipped when it fails or times
+// out.
+type Chain struct {
+	// Hops are written "provider/model", for example
+	// "anthropic/claude-sonnet-4-5". The provider may name an account, as in
+	// "openai:team-a/gpt-4o", and the model may be left out to use the one
+	// the run was given.
+	Hops []string `json:"hops"`
+	// Timeout limits each hop, as a Go duration such as "30s", before the
+	// next one is tried. Without it a hop only ends when its provider's own
+	// timeout expires.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ChainHop is a parsed hop of a Chain.
+type ChainHop struct {
+	Provider string
+	Model    string
+}
+
+func (h ChainHop) String() string {
+	if h.Model == "" {
+		return h.Provider
+	}
+	return h.Provider + "/" + h.Model
+}
+
+// ParseChainHop parses a hop written "provider[/model]". Only the first "/"
+// separates the two, so model names may contain slashes.
+func ParseChainHop(hop string) (ChainHop, error) {
+	provider, model, _ := strings.Cut(strings.TrimSpace(hop), "/")
+	if provider == "" {
+		return ChainHop{}, fmt.Errorf("invalid hop %q (use provider/model)", hop)
+	}
+	if strings.HasPrefix(provider, ChainPrefix) {
+		return ChainHop{}, fmt.Errorf("invalid hop %q: chains cannot include other chains", hop)
+	}
+	return ChainHop{Provider: provider, Model: model}, nil
+}
+
+// Parse returns the chain's hops and timeout.
+func (c *Chain) Parse() ([]ChainHop, time.Duration, error) {
+	if len(c.Hops) == 0 {
+		return nil, 0, fmt.Errorf("no hops")
+	}
+	hops := make([]ChainHop, 0, len(c.Hops))
+	for _, hop := range c.Hops {
+		parsed, err := ParseChainHop(hop)
+		if err != nil {
+			return nil, 0, err
+		}
+		hops = append(hops, parsed)
+	}
+
+	var timeout time.Duration
+	if c.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(c.Timeout); err != nil || timeout <= 0 {
+			return nil, 0, fmt.Errorf("invalid timeout: %s (use a duration such as 30s)", c.Timeout)
+		}
+	}
+	return hops, timeout, nil
+}
+
+// IsChain reports whether provider refers to a chain of the profile,
+// returning the chain's name.
+func IsChain(provider string) (string, bool) {
+	return strings.CutPrefix(provider, ChainPrefix)
+}
+
+// Hop records what happened to one hop of a chain during a request.
+type Hop struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"`
+	// Error is why the hop was skipped; it is empty for the hop that
+	// answered.
+	Error string `json:"error,omitempty"`
+}
+
+type chainMember struct {
+	hop ChainHop
+	llm LLM
+}
+
+// chainLLM is an LLM that tries the hops of a chain in order.
+type chainLLM struct {
+	name    string
+	timeout time.Duration
+	members []chainMember
+}
+
+// Chain builds an LLM for chain, named name, from the router's providers. It
+// fails if a hop names a provider the router does not have.
+func (r *Router) Chain(name string, chain *Chain) (LLM, error) {
+	hops, timeout, err := chain.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	members := make([]chainMember, 0, len(hops))
+	for _, hop := range hops {
+		llm, ok := r.Get(hop.Provider)
+		if !ok {
+			return nil, fmt.Errorf("%s: provider not found: %s", name, hop.Provider)
+		}
+		members = append(members, chainMember{hop: hop, llm: llm})
+	}
+	return &chainLLM{name: name, timeout: timeout, members: members}, nil
+}
+
+func (c *chainLLM) Name() string {
+	return c.name
+}
+
+func (c *chainLLM) Chat(ctx context.Context, messages []Message, opts Options) (*Response, error) {
+	return c.do(ctx, opts, func(ctx context.Context, llm LLM, opts Options) (*Response, bool, error) {
+		response, err := llm.Chat(ctx, messages, opts)
+		return response, true, err
+	})
+}
+
+func (c *chainLLM) Stream(
+	ctx context.Context,
+	messages []Message,
+	opts Options,
+	onDelta func(string),
+) (*Response, error) {
+	return c.do(ctx, opts, func(ctx context.Context, llm LLM, opts Options) (*Response, bool, error) {
+		emitted := false
+		response, err := llm.Stream(ctx, messages, opts, func(delta string) {
+			emitted = true
+			onDelta(delta)
+		})
+		// Once text has been printed, falling back would mix two answers.
+		return response, !emitted, err
+	})
+}
+
+// do calls attempt with each hop in turn until one succeeds. Hops with their
+// own model override opts.Model. The response records every hop tried in
+// Hops and the provider that answered in Provider.
+func (c *chainLLM) do(
+	ctx context.Context,
+	opts Options,
+	attempt func(context.Context, LLM, Options) (*Response, bool, error),
+) (*Response, error) {
+	var hops []Hop
+	for i, member := range c.members {
+		hopOpts := opts
+		if member.hop.Model != "" {
+			hopOpts.Model = member.hop.Model
+		}
+		hop := Hop{Provider: member.hop.Provider, Model: hopOpts.Model}
+
+		var response *Response
+		var retryable bool
+		var err error
+		if hopOpts.Model == "" {
+			retryable, err = true, fmt.Errorf("no model (add one to the hop or use --model)")
+		} else {
+			hopCtx, cancel := ctx, context.CancelFunc(func() {})
+			if c.timeout > 0 {
+				hopCtx, cancel = context.WithTimeout(ctx, c.timeout)
+			}
+			response, retryable, err = attempt(hopCtx, member.llm, hopOpts)
+			if err != nil && ctx.Err() == nil && hopCtx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("timed out after %s: %w", c.timeout, err)
+			}
+			cancel()
+		}
+
+		if err == nil || ctx.Err() != nil || !retryable || i == len(c.members)-1 {
+			if err != nil {
+				hop.Error = err.Error()
+			}
+			hops = append(hops, hop)
+			if response != nil {
+				response.Provider = member.hop.Provider
+				response.Hops = hops
+			}
+			if err != nil && len(c.members) > 1 && ctx.Err() == nil && retryable {
+				err = &ChainError{Chain: c.name, Hops: hops, Err: err}
+			}
+			return response, err
+		}
+
+		hop.Error = err.Error()
+		hops = append(hops, hop)
+		log.Warnf("%s: %s failed: %v; falling back to %s", c.name, member.hop, err, c.members[i+1].hop)
+	}
+	return nil, errors.New("empty chain")
+}
+
+// ChainError is returned when every hop of a chain failed.
+type ChainError struct {
+	Chain string
+	Hops  []Hop
+	Err   error
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("%s: all %d hops failed, last: %v", e.Chain, len(e.Hops), e.Err)
+}
+
+func (e *ChainError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,292 @@
+package providers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/farbodsalimi/promptctl/internal/credstore"
+)
+
+// Credentials says where a provider's API key comes from. Sources are tried
+// in order: the provider's environment variables, KeyFile, KeyCommand and
+// finally the encrypted credential store.
+type Credentials struct {
+	// APIKey is a key to be moved into the credential store on the next
+	// SaveConfig. Keys left in older config files are only used until the
+	// store is created, after which 'provider lock' moves them.
+	APIKey string `json:"api_key,omitempty"`
+	// KeyFile is a file whose contents are the key.
+	KeyFile string `json:"key_file,omitempty"`
+	// KeyCommand is a shell command whose standard output is the key, for
+	// use with password managers and credential helpers.
+	KeyCommand string `json:"key_command,omitempty"`
+}
+
+// Key sources reported by KeySource.
+const (
+	SourceEnv        = "env"
+	SourceKeyFile    = "key_file"
+	SourceKeyCommand = "key_command"
+	SourceStore      = "encrypted store"
+	SourcePlaintext  = "plaintext config (run 'promptctl provider lock')"
+)
+
+// KeyEnvVars returns the environment variables checked for a provider's
+// key. Custom providers and accounts use their name, upper-cased, followed
+// by _API_KEY.
+func KeyEnvVars(name string) []string {
+	switch name {
+	case "openai":
+		return []string{"OPENAI_API_KEY"}
+	case "anthropic":
+		return []string{"ANTHROPIC_API_KEY"}
+	case "google":
+		return []string{"GOOGLE_API_KEY", "GEMINI_API_KEY"}
+	}
+
+	envName := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return '_'
+		}
+		return unicode.ToUpper(r)
+	}, name)
+	return []string{envName + "_API_KEY"}
+}
+
+// KeySource describes which source ResolveAPIKey would use for a provider,
+// without reading the key, running any command or unlocking the store. It
+// returns an empty string when no key is available.
+func (c *Config) KeySource(name string) string {
+	for _, envVar := range KeyEnvVars(name) {
+		if os.Getenv(envVar) != "" {
+			return SourceEnv + " " + envVar
+		}
+	}
+
+	creds, ok := c.credentials()[name]
+	if !ok {
+		return ""
+	}
+	switch {
+	case creds.KeyFile != "":
+		return SourceKeyFile + " " + creds.KeyFile
+	case creds.KeyCommand != "":
+		return SourceKeyCommand
+	case c.store.Has(c.storeName(name)):
+		return SourceStore
+	case creds.APIKey != "" && !c.store.Exists():
+		return SourcePlaintext
+	}
+	return ""
+}
+
+// ResolveAPIKey returns a provider's API key from the first available
+// source, or an empty string when none is configured. Reading from the
+// credential store unlocks it if needed.
+func (c *Config) ResolveAPIKey(name string) (string, error) {
+	for _, envVar := range KeyEnvVars(name) {
+		if key := os.Getenv(envVar); key != "" {
+			return key, nil
+		}
+	}
+
+	creds, ok := c.credentials()[name]
+	if !ok {
+		return "", nil
+	}
+
+	if creds.KeyFile != "" {
+		data, err := os.ReadFile(expandHome(creds.KeyFile))
+		if err != nil {
+			return "", fmt.Errorf("provider %s: failed to read key file: %w", name, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	if creds.KeyCommand != "" {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", creds.KeyCommand)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf(
+				"provider %s: key command failed: %w: %s",
+				name,
+				err,
+				strings.TrimSpace(stderr.String()),
+			)
+		}
+		return strings.TrimSpace(stdout.String()), nil
+	}
+
+	if c.store.Has(c.storeName(name)) {
+		if err := c.store.UnlockAuto(); err != nil {
+			return "", fmt.Errorf("provider %s: %w", name, err)
+		}
+		return c.store.Get(c.storeName(name))
+	}
+
+	if c.store.Exists() {
+		return "", nil
+	}
+	return creds.APIKey, nil
+}
+
+// ForgetAPIKey removes a provider's key from the credential store on the
+// next SaveConfig.
+func (c *Config) ForgetAPIKey(name string) {
+	c.forgetNames = append(c.forgetNames, name)
+}
+
+// Store returns the encrypted credential store backing the config.
+func (c *Config) Store() *credstore.Store {
+	return c.store
+}
+
+// storeKeys moves API keys set on the config into the credential store,
+// creating the store if it does not exist yet, and applies ForgetAPIKey.
+// Secret headers are moved too once the store exists, and the stored
+// values of headers that were removed are deleted.
+func (c *Config) storeKeys() error {
+	pending := make(map[string]string)
+	for name, creds := range c.credentials() {
+		if creds.APIKey != "" {
+			pending[c.storeName(name)] = creds.APIKey
+		}
+	}
+	moveHeaders := c.store.Exists() || len(pending) > 0
+	if moveHeaders {
+		for provider, settings := range c.allSettings() {
+			for name, value := range settings.Headers {
+				if IsSecretHeader(name) {
+					pending[c.headerStoreName(provider, name)] = value
+				}
+			}
+		}
+	}
+	var forget []string
+	for _, name := range c.forgetNames {
+		if c.store.Has(c.storeName(name)) {
+			forget = append(forget, c.storeName(name))
+		}
+	}
+	forget = append(forget, c.staleHeaders(pending)...)
+	if len(pending) == 0 && len(forget) == 0 {
+		return nil
+	}
+
+	if err := c.UnlockStore(); err != nil {
+		return err
+	}
+	for name, key := range pending {
+		if err := c.store.Set(name, key); err != nil {
+			return err
+		}
+	}
+	for _, name := range forget {
+		if err := c.store.Delete(name); err != nil {
+			return err
+		}
+	}
+	if err := c.store.Save(); err != nil {
+		return err
+	}
+
+	for _, creds := range c.credentials() {
+		creds.APIKey = ""
+	}
+	if moveHeaders {
+		for _, settings := range c.allSettings() {
+			for name := range settings.Headers {
+				if IsSecretHeader(name) {
+					delete(settings.Headers, name)
+					settings.StoredHeaders = append(settings.StoredHeaders, name)
+				}
+			}
+			slices.Sort(settings.StoredHeaders)
+			settings.StoredHeaders = slices.Compact(settings.StoredHeaders)
+		}
+	}
+	c.forgetNames = nil
+	return nil
+}
+
+// staleHeaders returns the store names of the profile's headers that are
+// in the credential store but no longer in use: their header was removed or
+// replaced, or their provider deleted. Names about to be stored again are
+// in use.
+func (c *Config) staleHeaders(pending map[string]string) []string {
+	inUse := make(map[string]bool)
+	for provider, settings := range c.allSettings() {
+		for _, name := range settings.StoredHeaders {
+			inUse[c.headerStoreName(provider, name)] = true
+		}
+	}
+	prefix := c.storeName("")
+	var stale []string
+	for _, name := range c.store.Names() {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok || !strings.Contains(rest, headerStoreMark) || strings.Contains(rest, "/") {
+			continue
+		}
+		if _, ok := pending[name]; !ok && !inUse[name] {
+			stale = append(stale, name)
+		}
+	}
+	return stale
+}
+
+// UnlockStore unlocks the credential store, creating it with a new
+// passphrase if it does not exist yet.
+func (c *Config) UnlockStore() error {
+	if c.store.Exists() {
+		return c.store.UnlockAuto()
+	}
+
+	fmt.Fprintf(os.Stderr, "Creating encrypted credential store at %s\n", c.store.Path())
+	passphrase, err := credstore.NewPassphrase(credstore.PassphraseEnv, "New credential store passphrase: ")
+	if err != nil {
+		return err
+	}
+	return c.store.Init(passphrase)
+}
+
+// credentials returns the credentials of every built-in and custom
+// provider, keyed by provider name, and of their accounts, keyed by
+// "provider:account".
+func (c *Config) credentials() map[string]*Credentials {
+	all := map[string]*Credentials{
+		"openai":    &c.OpenAI.Credentials,
+		"anthropic": &c.Anthropic.Credentials,
+		"google":    &c.Google.Credentials,
+	}
+	for name, custom := range c.Custom {
+		all[name] = &custom.Credentials
+	}
+	accounts := make(map[string]*Credentials)
+	for name := range all {
+		for account, creds := range c.Pool(name).Accounts {
+			accounts[AccountName(name, account)] = creds
+		}
+	}
+	for name, creds := range accounts {
+		all[name] = creds
+	}
+	return all
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return homeDir + path[1:]
+}
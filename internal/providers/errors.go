@@ -0,0 +1,144 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/openai/openai-go"
+	"google.golang.org/genai"
+)
+
+// APIError is an error response from a provider's API.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+	// RetryAfter is how long the provider asked clients to wait before
+	// retrying, if it said.
+	RetryAfter time.Duration
+	// Err is the underlying SDK error, if any.
+	Err error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %d %s: %s", e.Provider, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// IsRateLimited reports whether err is a provider's 429 response.
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// Error classes group failed requests by cause.
+const (
+	ErrorClassRateLimited    = "rate_limited"
+	ErrorClassAuth           = "auth"
+	ErrorClassInvalidRequest = "invalid_request"
+	ErrorClassServer         = "server"
+	ErrorClassTimeout        = "timeout"
+	ErrorClassCancelled      = "cancelled"
+	ErrorClassNetwork        = "network"
+	ErrorClassOther          = "other"
+)
+
+// ErrorClass returns the class of a failed request's error. For a chain
+// whose hops all failed it is the class of the last hop's error.
+func ErrorClass(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch code := apiErr.StatusCode; {
+		case code == http.StatusTooManyRequests:
+			return ErrorClassRateLimited
+		case code == http.StatusUnauthorized, code == http.StatusForbidden:
+			return ErrorClassAuth
+		case code == http.StatusRequestTimeout, code == http.StatusGatewayTimeout:
+			return ErrorClassTimeout
+		case code >= 500:
+			return ErrorClassServer
+		case code >= 400:
+			return ErrorClassInvalidRequest
+		}
+		return ErrorClassOther
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorClassCancelled
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorClassTimeout
+		}
+		return ErrorClassNetwork
+	}
+	return ErrorClassOther
+}
+
+// apiError converts the error types of the provider SDKs into *APIError so
+// failures can be inspected the same way for every provider. Other errors
+// are returned unchanged.
+func apiError(provider string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		return &APIError{
+			Provider:   provider,
+			StatusCode: openaiErr.StatusCode,
+			Message:    openaiErr.Message,
+			RetryAfter: retryAfter(openaiErr.Response),
+			Err:        err,
+		}
+	}
+
+	var anthropicErr *anthropic.Error
+	if errors.As(err, &anthropicErr) {
+		return &APIError{
+			Provider:   provider,
+			StatusCode: anthropicErr.StatusCode,
+			Message:    anthropicMessage(anthropicErr),
+			RetryAfter: retryAfter(anthropicErr.Response),
+			Err:        err,
+		}
+	}
+
+	var googleErr genai.APIError
+	if errors.As(err, &googleErr) {
+		return &APIError{
+			Provider:   provider,
+			StatusCode: googleErr.Code,
+			Message:    googleErr.Message,
+			Err:        err,
+		}
+	}
+
+	return err
+}
+
+func retryAfter(response *http.Response) time.Duration {
+	if response == nil {
+		return 0
+	}
+	return parseRetryAfter(response.Header)
+}
+
+func anthropicMessage(err *anthropic.Error) string {
+	if raw := err.RawJSON(); raw != "" {
+		return raw
+	}
+	return http.StatusText(err.StatusCode)
+}
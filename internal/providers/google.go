@@ -0,0 +1,152 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+const defaultGoogleModel = "gemini-2.0-flash"
+
+type GoogleClient struct {
+	client *genai.Client
+}
+
+func NewGoogleClient(ctx context.Context, apiKey string, settings Settings) (*GoogleClient, error) {
+	httpClient, err := settings.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &genai.ClientConfig{
+		APIKey:     apiKey,
+		Backend:    genai.BackendGeminiAPI,
+		HTTPClient: httpClient,
+		HTTPOptions: genai.HTTPOptions{
+			BaseURL: settings.BaseURL,
+		},
+	}
+	if len(settings.Headers) > 0 {
+		config.HTTPOptions.Headers = make(http.Header)
+		for name, value := range settings.Headers {
+			config.HTTPOptions.Headers.Set(name, value)
+		}
+	}
+
+	client, err := genai.NewClient(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return &GoogleClient{client: client}, nil
+}
+
+func (c *GoogleClient) Name() string {
+	return "google"
+}
+
+func (c *GoogleClient) Chat(ctx context.Context, messages []Message, opts Options) (*Response, error) {
+	contents, config, err := c.params(messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	model := opts.modelOr(defaultGoogleModel)
+	result, err := c.client.Models.GenerateContent(ctx, model, contents, config)
+	if err != nil {
+		return nil, apiError(c.Name(), err)
+	}
+
+	response := &Response{Content: result.Text(), Options: opts}
+	response.Options.Model = model
+	c.applyMetadata(response, result)
+	return response, nil
+}
+
+func (c *GoogleClient) Stream(
+	ctx context.Context,
+	messages []Message,
+	opts Options,
+	onDelta func(string),
+) (*Response, error) {
+	contents, config, err := c.params(messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	model := opts.modelOr(defaultGoogleModel)
+	response := &Response{Options: opts}
+	response.Options.Model = model
+
+	var text strings.Builder
+	for result, err := range c.client.Models.GenerateContentStream(ctx, model, contents, config) {
+		if err != nil {
+			response.Content = text.String()
+			return response, apiError(c.Name(), err)
+		}
+		if delta := result.Text(); delta != "" {
+			text.WriteString(delta)
+			onDelta(delta)
+		}
+		c.applyMetadata(response, result)
+	}
+
+	response.Content = text.String()
+	return response, nil
+}
+
+// applyMetadata copies the model version, finish reason and token usage
+// reported in result onto response. Thinking tokens are billed as output, so
+// they count as completion tokens.
+func (c *GoogleClient) applyMetadata(response *Response, result *genai.GenerateContentResponse) {
+	if usage := result.UsageMetadata; usage != nil {
+		response.Usage = Usage{
+			PromptTokens:     int(usage.PromptTokenCount),
+			CompletionTokens: int(usage.CandidatesTokenCount + usage.ThoughtsTokenCount),
+		}
+	}
+	if result.ModelVersion != "" {
+		response.Options.Model = result.ModelVersion
+	}
+	if len(result.Candidates) > 0 && result.Candidates[0].FinishReason != "" {
+		response.FinishReason = string(result.Candidates[0].FinishReason)
+	}
+}
+
+func (c *GoogleClient) params(
+	messages []Message,
+	opts Options,
+) ([]*genai.Content, *genai.GenerateContentConfig, error) {
+	system, conversation := splitSystem(messages)
+
+	config := &genai.GenerateContentConfig{StopSequences: opts.Stop}
+	if len(system) > 0 {
+		config.SystemInstruction = genai.NewContentFromText(strings.Join(system, "\n\n"), genai.RoleUser)
+	}
+	if opts.Temperature != nil {
+		config.Temperature = genai.Ptr(float32(*opts.Temperature))
+	}
+	if opts.MaxTokens != nil {
+		config.MaxOutputTokens = int32(*opts.MaxTokens)
+	}
+	if opts.TopP != nil {
+		config.TopP = genai.Ptr(float32(*opts.TopP))
+	}
+	if opts.Seed != nil {
+		config.Seed = genai.Ptr(int32(*opts.Seed))
+	}
+
+	contents := make([]*genai.Content, 0, len(conversation))
+	for _, msg := range conversation {
+		switch msg.Role {
+		case RoleUser:
+			contents = append(contents, genai.NewContentFromText(msg.Content, genai.RoleUser))
+		case RoleAssistant:
+			contents = append(contents, genai.NewContentFromText(msg.Content, genai.RoleModel))
+		default:
+			return nil, nil, unsupportedRole(c.Name(), msg.Role)
+		}
+	}
+	return contents, config, nil
+}
@@ -0,0 +1,125 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type Role string
+
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+type Message struct {
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
+}
+
+// LLM is a chat model backend. Implementations translate the role-tagged
+// messages and generation options into the provider's native request format,
+// using their default model when the options name none.
+type LLM interface {
+	Name() string
+	Chat(ctx context.Context, messages []Message, opts Options) (*Response, error)
+	// Stream behaves like Chat but calls onDelta with each piece of text as
+	// it arrives. When the stream fails or ctx is cancelled part-way, the
+	// returned response holds the text received so far alongside the error.
+	Stream(ctx context.Context, messages []Message, opts Options, onDelta func(string)) (*Response, error)
+}
+
+type Router struct {
+	providers map[string]LLM
+}
+
+func NewRouter() *Router {
+	return &Router{providers: make(map[string]LLM)}
+}
+
+func (r *Router) Register(llm LLM) {
+	r.providers[llm.Name()] = llm
+}
+
+func (r *Router) Get(name string) (LLM, bool) {
+	llm, ok := r.providers[name]
+	return llm, ok
+}
+
+func (r *Router) ListProviders() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitSystem separates system messages from the conversation for providers
+// that take the system prompt as a dedicated request field.
+func splitSystem(messages []Message) ([]string, []Message) {
+	var system []string
+	var rest []Message
+	for _, msg := range messages {
+		if msg.Role == RoleSystem {
+			system = append(system, msg.Content)
+			continue
+		}
+		rest = append(rest, msg)
+	}
+	return system, rest
+}
+
+func unsupportedRole(provider string, role Role) error {
+	return fmt.Errorf("%s: unsupported message role %q", provider, role)
+}
+
+// lazyLLM defers building a client, and so resolving its API key, until
+// the provider is first used.
+type lazyLLM struct {
+	name  string
+	build func() (LLM, error)
+
+	once sync.Once
+	llm  LLM
+	err  error
+}
+
+func newLazyLLM(name string, build func() (LLM, error)) *lazyLLM {
+	return &lazyLLM{name: name, build: build}
+}
+
+func (l *lazyLLM) Name() string {
+	return l.name
+}
+
+func (l *lazyLLM) get() (LLM, error) {
+	l.once.Do(func() {
+		l.llm, l.err = l.build()
+	})
+	return l.llm, l.err
+}
+
+func (l *lazyLLM) Chat(ctx context.Context, messages []Message, opts Options) (*Response, error) {
+	llm, err := l.get()
+	if err != nil {
+		return nil, err
+	}
+	return llm.Chat(ctx, messages, opts)
+}
+
+func (l *lazyLLM) Stream(
+	ctx context.Context,
+	messages []Message,
+	opts Options,
+	onDelta func(string),
+) (*Response, error) {
+	llm, err := l.get()
+	if err != nil {
+		return nil, err
+	}
+	return llm.Stream(ctx, messages, opts, onDelta)
+}
@@ -0,0 +1,212 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MockProvider is the name of the offline mock provider.
+const MockProvider = "mock"
+
+const mockModel = "mock"
+
+// MockConfig configures the offline mock provider. With no settings it
+// echoes the last user message back.
+type MockConfig struct {
+	// Fixtures is a JSON file mapping prompt hashes (see PromptHash and
+	// 'prompt render --hash') to canned responses.
+	Fixtures string `json:"fixtures,omitempty"`
+	// Rules are tried in order after fixtures; the first whose pattern
+	// matches the last user message supplies the response.
+	Rules []MockRule `json:"rules,omitempty"`
+	// Strict makes a prompt without a fixture or matching rule an error
+	// instead of an echo.
+	Strict bool `json:"strict,omitempty"`
+	// Latency is a duration such as "250ms" to wait before responding.
+	Latency string `json:"latency,omitempty"`
+	// Error, when set, is returned as an API error with ErrorStatus
+	// (default 500) on a fraction ErrorRate of requests (default all).
+	Error       string  `json:"error,omitempty"`
+	ErrorStatus int     `json:"error_status,omitempty"`
+	ErrorRate   float64 `json:"error_rate,omitempty"`
+	// Limits apply to the mock like to any other provider, so retries and
+	// rate limiting can be tried out offline.
+	Limits
+}
+
+type MockRule struct {
+	Match    string `json:"match"`
+	Response string `json:"response"`
+}
+
+type mockRule struct {
+	pattern  *regexp.Regexp
+	response string
+}
+
+// MockClient is a provider that needs no API key or network access, for
+// tests, CI and demos.
+type MockClient struct {
+	config   MockConfig
+	fixtures map[string]string
+	rules    []mockRule
+	latency  time.Duration
+}
+
+func NewMockClient(config MockConfig) (*MockClient, error) {
+	c := &MockClient{config: config}
+
+	if config.Fixtures != "" {
+		data, err := os.ReadFile(config.Fixtures)
+		if err != nil {
+			return nil, fmt.Errorf("mock: failed to read fixtures: %w", err)
+		}
+		if err := json.Unmarshal(data, &c.fixtures); err != nil {
+			return nil, fmt.Errorf("mock: invalid fixtures file %s: %w", config.Fixtures, err)
+		}
+	}
+
+	for i, rule := range config.Rules {
+		pattern, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("mock: rule %d: %w", i+1, err)
+		}
+		c.rules = append(c.rules, mockRule{pattern: pattern, response: rule.Response})
+	}
+
+	if config.Latency != "" {
+		latency, err := time.ParseDuration(config.Latency)
+		if err != nil {
+			return nil, fmt.Errorf("mock: invalid latency: %w", err)
+		}
+		c.latency = latency
+	}
+
+	return c, nil
+}
+
+func (c *MockClient) Name() string {
+	return MockProvider
+}
+
+func (c *MockClient) Chat(ctx context.Context, messages []Message, opts Options) (*Response, error) {
+	if err := c.wait(ctx, c.latency); err != nil {
+		return nil, err
+	}
+
+	content, err := c.respond(messages)
+	if err != nil {
+		return nil, err
+	}
+	return c.response(messages, content, opts), nil
+}
+
+// Stream emits the response word by word, spreading the configured latency
+// across the chunks.
+func (c *MockClient) Stream(
+	ctx context.Context,
+	messages []Message,
+	opts Options,
+	onDelta func(string),
+) (*Response, error) {
+	content, err := c.respond(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := strings.SplitAfter(content, " ")
+	delay := c.latency / time.Duration(len(chunks))
+
+	var text strings.Builder
+	for _, chunk := range chunks {
+		if err := c.wait(ctx, delay); err != nil {
+			return c.response(messages, text.String(), opts), err
+		}
+		text.WriteString(chunk)
+		onDelta(chunk)
+	}
+	return c.response(messages, text.String(), opts), nil
+}
+
+// respond picks the response for messages: an injected error, a fixture, a
+// matching rule or an echo of the last user message, in that order.
+func (c *MockClient) respond(messages []Message) (string, error) {
+	if c.config.Error != "" && (c.config.ErrorRate <= 0 || rand.Float64() < c.config.ErrorRate) {
+		status := c.config.ErrorStatus
+		if status == 0 {
+			status = 500
+		}
+		return "", &APIError{Provider: c.Name(), StatusCode: status, Message: c.config.Error}
+	}
+
+	hash := PromptHash(messages)
+	if response, ok := c.fixtures[hash]; ok {
+		return response, nil
+	}
+
+	last := lastUserMessage(messages)
+	for _, rule := range c.rules {
+		if rule.pattern.MatchString(last) {
+			return rule.response, nil
+		}
+	}
+
+	if c.config.Strict {
+		return "", fmt.Errorf("mock: no fixture or rule matches prompt %s", hash)
+	}
+	return last, nil
+}
+
+// response builds the response for content. Its usage counts words as
+// tokens.
+func (c *MockClient) response(messages []Message, content string, opts Options) *Response {
+	reported := opts
+	if reported.Model == "" {
+		reported.Model = mockModel
+	}
+	var usage Usage
+	for _, msg := range messages {
+		usage.PromptTokens += len(strings.Fields(msg.Content))
+	}
+	usage.CompletionTokens = len(strings.Fields(content))
+	return &Response{Content: content, Options: reported, FinishReason: "stop", Usage: usage}
+}
+
+func (c *MockClient) wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// PromptHash identifies a rendered prompt for mock fixtures: the hex SHA-256
+// of the messages encoded as a JSON array of {"role", "content"} objects.
+func PromptHash(messages []Message) string {
+	data, _ := json.Marshal(messages)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func lastUserMessage(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == RoleUser {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
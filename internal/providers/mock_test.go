@@ -0,0 +1,340 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockMessages is a prompt with a system message and two user turns.
+func mockMessages(last string) []Message {
+	return []Message{
+		{Role: RoleSystem, Content: "Be brief."},
+		{Role: RoleUser, Content: "first"},
+		{Role: RoleAssistant, Content: "reply"},
+		{Role: RoleUser, Content: last},
+	}
+}
+
+// mockRespond sends messages to client with Chat or, if stream, Stream and
+// returns the response and the streamed text.
+func mockRespond(t *testing.T, client *MockClient, messages []Message, stream bool) (*Response, string, error) {
+	t.Helper()
+	if !stream {
+		response, err := client.Chat(context.Background(), messages, Options{})
+		return response, "", err
+	}
+	var streamed strings.Builder
+	response, err := client.Stream(context.Background(), messages, Options{}, func(delta string) {
+		streamed.WriteString(delta)
+	})
+	return response, streamed.String(), err
+}
+
+func TestMockEcho(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		messages []Message
+		want     string
+	}{
+		{"last user message", mockMessages("hello there"), "hello there"},
+		{"no user message", []Message{{Role: RoleSystem, Content: "Be brief."}}, ""},
+	} {
+		for _, stream := range []bool{false, true} {
+			t.Run(tt.name, func(t *testing.T) {
+				client, err := NewMockClient(MockConfig{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				response, streamed, err := mockRespond(t, client, tt.messages, stream)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if response.Content != tt.want {
+					t.Errorf("content = %q, want %q", response.Content, tt.want)
+				}
+				if stream && streamed != tt.want {
+					t.Errorf("streamed %q, want %q", streamed, tt.want)
+				}
+				if response.Options.Model != mockModel || response.FinishReason != "stop" {
+					t.Errorf("model %q, finish reason %q, want %q and stop", response.Options.Model, response.FinishReason, mockModel)
+				}
+			})
+		}
+	}
+}
+
+func TestMockUsage(t *testing.T) {
+	client, err := NewMockClient(MockConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Chat(context.Background(), mockMessages("two words"), Options{Model: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Words are counted as tokens: 2 + 1 + 1 + 2 in the prompt.
+	if want := (Usage{PromptTokens: 6, CompletionTokens: 2}); response.Usage != want {
+		t.Errorf("usage = %+v, want %+v", response.Usage, want)
+	}
+	if response.Options.Model != "m" {
+		t.Errorf("model = %q, want the requested m", response.Options.Model)
+	}
+}
+
+func TestMockFixtures(t *testing.T) {
+	fixed := mockMessages("what is the capital of France?")
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	data, _ := json.Marshal(map[string]string{PromptHash(fixed): "Paris"})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		messages []Message
+		want     string
+	}{
+		{"fixture by hash", fixed, "Paris"},
+		{"other prompt echoed", mockMessages("what is the capital of Spain?"), "what is the capital of Spain?"},
+		{
+			"system message is part of the hash",
+			append([]Message{{Role: RoleSystem, Content: "Be verbose."}}, fixed[1:]...),
+			"what is the capital of France?",
+		},
+	} {
+		for _, stream := range []bool{false, true} {
+			t.Run(tt.name, func(t *testing.T) {
+				client, err := NewMockClient(MockConfig{Fixtures: path, Rules: []MockRule{{Match: "Paris", Response: "rule"}}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				response, _, err := mockRespond(t, client, tt.messages, stream)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if response.Content != tt.want {
+					t.Errorf("content = %q, want %q", response.Content, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestPromptHash(t *testing.T) {
+	a := PromptHash(mockMessages("hi"))
+	if a != PromptHash(mockMessages("hi")) {
+		t.Error("the same prompt hashes differently")
+	}
+	if a == PromptHash(mockMessages("hi!")) {
+		t.Error("different prompts hash the same")
+	}
+	if len(a) != 64 {
+		t.Errorf("hash %q is not hex SHA-256", a)
+	}
+}
+
+func TestMockRules(t *testing.T) {
+	rules := []MockRule{
+		{Match: `(?i)\bweather\b`, Response: "sunny"},
+		{Match: `^translate:`, Response: "bonjour"},
+		{Match: `.`, Response: "anything"},
+	}
+	for _, tt := range []struct {
+		name string
+		last string
+		want string
+	}{
+		{"first matching rule", "What's the WEATHER like?", "sunny"},
+		{"rules tried in order", "translate: hello", "bonjour"},
+		{"catch-all rule", "hello", "anything"},
+		{"only the last user message is matched", "", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewMockClient(MockConfig{Rules: rules})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// "first" in an earlier turn matches no rule on its own.
+			response, err := client.Chat(context.Background(), mockMessages(tt.last), Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Content != tt.want {
+				t.Errorf("content = %q, want %q", response.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestMockStrict(t *testing.T) {
+	rules := []MockRule{{Match: "known", Response: "ok"}}
+	for _, tt := range []struct {
+		name    string
+		last    string
+		want    string
+		wantErr bool
+	}{
+		{name: "matching rule", last: "a known prompt", want: "ok"},
+		{name: "unmatched prompt fails", last: "something else", wantErr: true},
+	} {
+		for _, stream := range []bool{false, true} {
+			t.Run(tt.name, func(t *testing.T) {
+				client, err := NewMockClient(MockConfig{Rules: rules, Strict: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				messages := mockMessages(tt.last)
+				response, _, err := mockRespond(t, client, messages, stream)
+				if tt.wantErr {
+					if err == nil || !strings.Contains(err.Error(), PromptHash(messages)) {
+						t.Errorf("err = %v, want one naming the prompt hash", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if response.Content != tt.want {
+					t.Errorf("content = %q, want %q", response.Content, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestMockLatency(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		stream bool
+	}{
+		{"chat", false},
+		{"stream", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewMockClient(MockConfig{Latency: "100ms"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			if _, _, err := mockRespond(t, client, mockMessages("one two three four"), tt.stream); err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+				t.Errorf("responded after %s, want about 100ms", elapsed)
+			}
+
+			// A cancelled request stops waiting; a stream keeps what it
+			// emitted.
+			ctx, cancel := context.WithTimeout(context.Background(), 40*time.Millisecond)
+			defer cancel()
+			var response *Response
+			if tt.stream {
+				response, err = client.Stream(ctx, mockMessages("one two three four"), Options{}, func(string) {})
+			} else {
+				response, err = client.Chat(ctx, mockMessages("one two three four"), Options{})
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+			}
+			if tt.stream && (response == nil || response.Content != "one ") {
+				t.Errorf("cancelled stream = %+v, want the first word", response)
+			}
+		})
+	}
+
+	if _, err := NewMockClient(MockConfig{Latency: "soon"}); err == nil {
+		t.Error("NewMockClient accepted an invalid latency")
+	}
+}
+
+func TestMockErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		config     MockConfig
+		wantStatus int
+		wantErr    bool
+	}{
+		{name: "no error", config: MockConfig{}},
+		{name: "default status", config: MockConfig{Error: "boom"}, wantStatus: http.StatusInternalServerError, wantErr: true},
+		{
+			name:       "rate limited",
+			config:     MockConfig{Error: "slow down", ErrorStatus: http.StatusTooManyRequests},
+			wantStatus: http.StatusTooManyRequests,
+			wantErr:    true,
+		},
+		{name: "every request at rate 1", config: MockConfig{Error: "boom", ErrorRate: 1}, wantStatus: 500, wantErr: true},
+		{
+			name:       "error before fixtures and rules",
+			config:     MockConfig{Error: "boom", Rules: []MockRule{{Match: ".", Response: "ok"}}},
+			wantStatus: 500,
+			wantErr:    true,
+		},
+	} {
+		for _, stream := range []bool{false, true} {
+			t.Run(tt.name, func(t *testing.T) {
+				client, err := NewMockClient(tt.config)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, streamed, err := mockRespond(t, client, mockMessages("hi"), stream)
+				if !tt.wantErr {
+					if err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus || apiErr.Message != tt.config.Error {
+					t.Fatalf("err = %v, want an API error %d %q", err, tt.wantStatus, tt.config.Error)
+				}
+				if streamed != "" {
+					t.Errorf("streamed %q before failing", streamed)
+				}
+			})
+		}
+	}
+
+	// A fractional rate fails some requests and not others.
+	client, err := NewMockClient(MockConfig{Error: "boom", ErrorRate: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := 0
+	for range 400 {
+		if _, err := client.Chat(context.Background(), mockMessages("hi"), Options{}); err != nil {
+			failed++
+		}
+	}
+	if failed < 100 || failed > 300 {
+		t.Errorf("%d of 400 requests failed at rate 0.5", failed)
+	}
+}
+
+func TestNewMockClientErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("[1, 2]"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name   string
+		config MockConfig
+	}{
+		{"missing fixtures", MockConfig{Fixtures: filepath.Join(dir, "missing.json")}},
+		{"invalid fixtures", MockConfig{Fixtures: invalid}},
+		{"invalid rule", MockConfig{Rules: []MockRule{{Match: "(", Response: "x"}}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewMockClient(tt.config); err == nil {
+				t.Error("NewMockClient succeeded")
+			}
+		})
+	}
+}
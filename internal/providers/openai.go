@@ -0,0 +1,194 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+const defaultOpenAIModel = openai.ChatModelGPT4o
+
+type OpenAIClient struct {
+	name         string
+	defaultModel string
+	streamUsage  bool
+	client       openai.Client
+}
+
+func NewOpenAIClient(apiKey string, settings Settings) (*OpenAIClient, error) {
+	opts, err := openAIOptions(apiKey, settings)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenAIClient{
+		name:         "openai",
+		defaultModel: defaultOpenAIModel,
+		streamUsage:  settings.streamUsage(),
+		client:       openai.NewClient(opts...),
+	}, nil
+}
+
+// NewOpenAICompatibleClient returns a client for a server that implements
+// the OpenAI chat completions API, such as Ollama, vLLM or LM Studio, at
+// settings.BaseURL. The API key may be empty for servers that do not
+// require one. There is no default model, so requests must name one.
+func NewOpenAICompatibleClient(name, apiKey string, settings Settings) (*OpenAIClient, error) {
+	if settings.BaseURL == "" {
+		return nil, fmt.Errorf("%s: a base URL is required", name)
+	}
+	opts, err := openAIOptions(apiKey, settings)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenAIClient{
+		name:        name,
+		streamUsage: settings.streamUsage(),
+		client:      openai.NewClient(opts...),
+	}, nil
+}
+
+func openAIOptions(apiKey string, settings Settings) ([]option.RequestOption, error) {
+	// Retries are left to the provider middleware.
+	opts := []option.RequestOption{option.WithAPIKey(apiKey), option.WithMaxRetries(0)}
+	if settings.BaseURL != "" {
+		opts = append(opts, option.WithBaseURL(settings.BaseURL))
+	}
+	if settings.Organization != "" {
+		opts = append(opts, option.WithOrganization(settings.Organization))
+	}
+	if settings.Project != "" {
+		opts = append(opts, option.WithProject(settings.Project))
+	}
+	for name, value := range settings.Headers {
+		opts = append(opts, option.WithHeader(name, value))
+	}
+
+	httpClient, err := settings.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		opts = append(opts, option.WithHTTPClient(httpClient))
+	}
+	return opts, nil
+}
+
+func (c *OpenAIClient) Name() string {
+	return c.name
+}
+
+func (c *OpenAIClient) Chat(ctx context.Context, messages []Message, opts Options) (*Response, error) {
+	params, err := c.params(messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	completion, err := c.client.Chat.Completions.New(ctx, params)
+	if err != nil {
+		return nil, apiError(c.Name(), err)
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("%s: response contained no choices", c.Name())
+	}
+
+	reported := opts
+	reported.Model = completion.Model
+	return &Response{
+		Content:      completion.Choices[0].Message.Content,
+		Options:      reported,
+		FinishReason: completion.Choices[0].FinishReason,
+		Usage:        openAIUsage(completion.Usage),
+	}, nil
+}
+
+func (c *OpenAIClient) Stream(
+	ctx context.Context,
+	messages []Message,
+	opts Options,
+	onDelta func(string),
+) (*Response, error) {
+	params, err := c.params(messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The usage arrives in a final chunk without choices.
+	if c.streamUsage {
+		params.StreamOptions.IncludeUsage = openai.Bool(true)
+	}
+
+	var content strings.Builder
+	response := &Response{Options: opts}
+
+	stream := c.client.Chat.Completions.NewStreaming(ctx, params)
+	defer stream.Close()
+	for stream.Next() {
+		chunk := stream.Current()
+		if chunk.Model != "" {
+			response.Options.Model = chunk.Model
+		}
+		if chunk.Usage.PromptTokens > 0 || chunk.Usage.CompletionTokens > 0 {
+			response.Usage = openAIUsage(chunk.Usage)
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if delta := chunk.Choices[0].Delta.Content; delta != "" {
+			content.WriteString(delta)
+			onDelta(delta)
+		}
+		if chunk.Choices[0].FinishReason != "" {
+			response.FinishReason = chunk.Choices[0].FinishReason
+		}
+	}
+
+	response.Content = content.String()
+	return response, apiError(c.Name(), stream.Err())
+}
+
+func openAIUsage(usage openai.CompletionUsage) Usage {
+	return Usage{PromptTokens: int(usage.PromptTokens), CompletionTokens: int(usage.CompletionTokens)}
+}
+
+func (c *OpenAIClient) params(
+	messages []Message,
+	opts Options,
+) (openai.ChatCompletionNewParams, error) {
+	params := openai.ChatCompletionNewParams{
+		Model: opts.modelOr(c.defaultModel),
+	}
+	if params.Model == "" {
+		return params, fmt.Errorf("%s: a model is required", c.Name())
+	}
+	for _, msg := range messages {
+		switch msg.Role {
+		case RoleSystem:
+			params.Messages = append(params.Messages, openai.SystemMessage(msg.Content))
+		case RoleUser:
+			params.Messages = append(params.Messages, openai.UserMessage(msg.Content))
+		case RoleAssistant:
+			params.Messages = append(params.Messages, openai.AssistantMessage(msg.Content))
+		default:
+			return params, unsupportedRole(c.Name(), msg.Role)
+		}
+	}
+	if opts.Temperature != nil {
+		params.Temperature = openai.Float(*opts.Temperature)
+	}
+	if opts.MaxTokens != nil {
+		params.MaxTokens = openai.Int(int64(*opts.MaxTokens))
+	}
+	if opts.TopP != nil {
+		params.TopP = openai.Float(*opts.TopP)
+	}
+	if len(opts.Stop) > 0 {
+		params.Stop.OfStringArray = opts.Stop
+	}
+	if opts.Seed != nil {
+		params.Seed = openai.Int(*opts.Seed)
+	}
+	return params, nil
+}
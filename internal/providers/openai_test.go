@@ -0,0 +1,78 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIStreamUsage(t *testing.T) {
+	// The server rejects stream_options like some OpenAI-compatible
+	// servers do, and otherwise streams one chunk followed by the usage.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		_, includeUsage := req["stream_options"]
+		if includeUsage && r.Header.Get("X-Strict") != "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"message":"unknown field stream_options","type":"invalid_request_error"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"m\","+
+			"\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"},\"finish_reason\":\"stop\"}]}\n\n")
+		if includeUsage {
+			fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"m\",\"choices\":[],"+
+				"\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":1,\"total_tokens\":4}}\n\n")
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	off := false
+	for _, tt := range []struct {
+		name     string
+		settings Settings
+		want     Usage
+		wantErr  bool
+	}{
+		{name: "usage by default", settings: Settings{BaseURL: server.URL}, want: Usage{PromptTokens: 3, CompletionTokens: 1}},
+		{
+			name:     "strict server rejects usage",
+			settings: Settings{BaseURL: server.URL, Headers: map[string]string{"X-Strict": "1"}},
+			wantErr:  true,
+		},
+		{
+			name:     "usage turned off",
+			settings: Settings{BaseURL: server.URL, Headers: map[string]string{"X-Strict": "1"}, StreamUsage: &off},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewOpenAICompatibleClient("local", "", tt.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages := []Message{{Role: RoleUser, Content: "hello"}}
+			response, err := client.Stream(context.Background(), messages, Options{Model: "m"}, func(string) {})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if response.Content != "hi" {
+				t.Errorf("content = %q, want \"hi\"", response.Content)
+			}
+			if response.Usage != tt.want {
+				t.Errorf("usage = %+v, want %+v", response.Usage, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package providers
+
+// Options are generation settings for a single request. Nil and empty fields
+// are left to the provider's defaults.
+type Options struct {
+	Model       string   `json:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+}
+
+// Response is a completed generation together with what the provider
+// reported about it.
+type Response struct {
+	Content string
+	// Options holds the settings the request was made with: the options
+	// sent, with client defaults filled in and options the provider does
+	// not support cleared. Only the model is taken from the provider's
+	// response; providers do not echo the other settings back.
+	Options      Options
+	FinishReason string
+	// Usage is the token count the provider reported, if any.
+	Usage Usage
+	// Account is the provider account that served the request, either
+	// DefaultAccount or the name of one of its accounts.
+	Account string
+	// Attempts is the number of times the request was sent, counting
+	// retries.
+	Attempts int
+	// Provider and Hops are set when the request went through a fallback
+	// chain: the provider that answered and every hop tried, in order.
+	Provider string
+	Hops     []Hop
+}
+
+// Usage is the number of tokens a request consumed. CacheReadTokens and
+// CacheWriteTokens are the part of PromptTokens read from and written to
+// the provider's prompt cache, which is priced differently.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	CacheReadTokens  int
+	CacheWriteTokens int
+}
+
+func (o Options) modelOr(defaultModel string) string {
+	if o.Model != "" {
+		return o.Model
+	}
+	return defaultModel
+}
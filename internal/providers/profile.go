@@ -0,0 +1,277 @@
+package providers
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/farbodsalimi/promptctl/internal/credstore"
+)
+
+// DefaultProfile is the profile made of the top-level settings of
+// config.json. It always exists.
+const DefaultProfile = "default"
+
+// ProfileEnv selects the active profile when --profile is not given.
+const ProfileEnv = "PROMPTCTL_PROFILE"
+
+// defaultDatabase is the database of the default profile. Other profiles
+// default to promptctl-<profile>.db.
+const defaultDatabase = "promptctl.db"
+
+// ConfigVersion is the version of the config.json layout written by this
+// release. Files without a version predate versioning and are version 1.
+const ConfigVersion = 2
+
+// configUpgrades[i] upgrades a decoded config.json from version i+1 to
+// version i+2.
+var configUpgrades = []func(file map[string]any){
+	upgradeConfigV1,
+}
+
+// upgradeConfigV1 drops the empty "api_key" entries that releases before
+// the credential store wrote for every built-in provider.
+func upgradeConfigV1(file map[string]any) {
+	for _, name := range []string{"openai", "anthropic", "google"} {
+		if provider, ok := file[name].(map[string]any); ok && provider["api_key"] == "" {
+			delete(provider, "api_key")
+		}
+	}
+}
+
+// configFile is the layout of config.json: the default profile at the top
+// level and any other profiles under "profiles".
+type configFile struct {
+	Version int `json:"version"`
+	Config
+	ActiveProfile string             `json:"active_profile,omitempty"`
+	Profiles      map[string]*Config `json:"profiles,omitempty"`
+
+	// warnings are problems found while reading the file that did not stop
+	// it from loading.
+	warnings []string
+}
+
+// upgradeConfig brings a decoded config.json up to ConfigVersion, reporting
+// whether anything changed.
+func upgradeConfig(file map[string]any) (bool, error) {
+	version := 1
+	if v, ok := file["version"].(float64); ok {
+		version = int(v)
+	}
+	if version > ConfigVersion {
+		return false, fmt.Errorf(
+			"config.json is version %d, but this promptctl only understands version %d; upgrade promptctl",
+			version,
+			ConfigVersion,
+		)
+	}
+	for ; version < ConfigVersion; version++ {
+		configUpgrades[version-1](file)
+	}
+	upgraded := file["version"] != float64(ConfigVersion)
+	file["version"] = ConfigVersion
+	return upgraded, nil
+}
+
+// checkKeys records a warning for every key of the decoded file that is
+// not in the schema.
+func (f *configFile) checkKeys(file map[string]any) {
+	profile := make(map[string]any)
+	for key, value := range file {
+		switch key {
+		case "version", "active_profile":
+		case "profiles":
+			profiles, _ := value.(map[string]any)
+			for name, p := range profiles {
+				if p, ok := p.(map[string]any); ok {
+					for _, key := range unknownKeys(p, "profiles."+name+".") {
+						f.warnings = append(f.warnings, "unknown key: "+key+" (dropped on next save)")
+					}
+				}
+			}
+		default:
+			profile[key] = value
+		}
+	}
+	for _, key := range unknownKeys(profile, "") {
+		f.warnings = append(f.warnings, "unknown key: "+key+" (dropped on next save)")
+	}
+	sort.Strings(f.warnings)
+}
+
+// Warnings returns the problems found while reading config.json, such as
+// unknown keys.
+func (c *Config) Warnings() []string {
+	if c.file == nil {
+		return nil
+	}
+	return c.file.warnings
+}
+
+// ValidateAll checks every profile, returning each problem prefixed with
+// the profile it was found in.
+func (c *Config) ValidateAll() []error {
+	var errs []error
+	for _, profile := range c.file.profiles() {
+		for _, err := range profile.Validate() {
+			if profile.profile != DefaultProfile {
+				err = fmt.Errorf("profiles.%s.%w", profile.profile, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// init links every profile to the file and the credential store.
+func (f *configFile) init(store *credstore.Store) {
+	f.Config.store = store
+	f.Config.profile = DefaultProfile
+	f.Config.file = f
+	for name, profile := range f.Profiles {
+		profile.store = store
+		profile.profile = name
+		profile.file = f
+	}
+}
+
+// profile returns the named profile.
+func (f *configFile) profile(name string) (*Config, error) {
+	if name == DefaultProfile {
+		return &f.Config, nil
+	}
+	profile, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile not found: %s (see 'promptctl config profile list')", name)
+	}
+	return profile, nil
+}
+
+// profiles returns every profile, the default one first.
+func (f *configFile) profiles() []*Config {
+	all := []*Config{&f.Config}
+	for _, name := range f.profileNames()[1:] {
+		all = append(all, f.Profiles[name])
+	}
+	return all
+}
+
+func (f *configFile) profileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{DefaultProfile}, names...)
+}
+
+var selectedProfile string
+
+// SelectProfile makes name the active profile for this process, taking
+// precedence over PROMPTCTL_PROFILE and the profile chosen with UseProfile.
+func SelectProfile(name string) {
+	selectedProfile = name
+}
+
+// activeProfile returns the name of the profile in use: the one given to
+// SelectProfile, else PROMPTCTL_PROFILE, else the one saved in the file.
+func activeProfile(f *configFile) string {
+	if selectedProfile != "" {
+		return selectedProfile
+	}
+	if name := os.Getenv(ProfileEnv); name != "" {
+		return name
+	}
+	if f.ActiveProfile != "" {
+		return f.ActiveProfile
+	}
+	return DefaultProfile
+}
+
+// Profile returns the name of the profile the config belongs to.
+func (c *Config) Profile() string {
+	return c.profile
+}
+
+// DatabasePath returns the path of the profile's SQLite database.
+func (c *Config) DatabasePath() string {
+	if c.Database != "" {
+		return expandHome(c.Database)
+	}
+	if c.profile == DefaultProfile || c.profile == "" {
+		return defaultDatabase
+	}
+	return "promptctl-" + c.profile + ".db"
+}
+
+// storeName returns the name a key is kept under in the credential store.
+// Keys of profiles other than the default one are prefixed with the profile
+// name, so each profile has its own.
+func (c *Config) storeName(name string) string {
+	if c.profile == DefaultProfile || c.profile == "" {
+		return name
+	}
+	return c.profile + "/" + name
+}
+
+// ListProfiles returns the names of all profiles, the default one first,
+// and the name of the active one.
+func ListProfiles() ([]string, string, error) {
+	file, err := loadConfigFile()
+	if err != nil {
+		return nil, "", err
+	}
+	return file.profileNames(), activeProfile(file), nil
+}
+
+// CreateProfile adds an empty profile. An empty database uses
+// promptctl-<name>.db.
+func CreateProfile(name, database string, defaults Defaults) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+
+	file, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	if _, err := file.profile(name); err == nil {
+		return fmt.Errorf("profile already exists: %s", name)
+	}
+
+	if file.Profiles == nil {
+		file.Profiles = make(map[string]*Config)
+	}
+	file.Profiles[name] = &Config{Database: database, Defaults: defaults}
+	file.init(file.Config.store)
+	return SaveConfig(&file.Config)
+}
+
+// UseProfile saves name as the active profile.
+func UseProfile(name string) error {
+	file, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	if _, err := file.profile(name); err != nil {
+		return err
+	}
+
+	file.ActiveProfile = name
+	if name == DefaultProfile {
+		file.ActiveProfile = ""
+	}
+	return SaveConfig(&file.Config)
+}
+
+func validateProfileName(name string) error {
+	if name == "" || name == DefaultProfile {
+		return fmt.Errorf("invalid profile name: %q", name)
+	}
+	if strings.ContainsAny(name, "/:\\ ") {
+		return fmt.Errorf("invalid profile name: %s (must not contain '/', ':', '\\' or spaces)", name)
+	}
+	return nil
+}
@@ -3,83 +3,290 @@ package providers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/farbodsalimi/genevieve/pkg/genevieve"
-	"github.com/farbodsalimi/genevieve/pkg/providers/anthropic"
-	"github.com/farbodsalimi/genevieve/pkg/providers/google"
-	"github.com/farbodsalimi/genevieve/pkg/providers/openai"
+	"github.com/farbodsalimi/promptctl/internal/credstore"
 )
 
+// Config is the configuration of one profile: its providers, database and
+// run defaults.
 type Config struct {
 	OpenAI    OpenAIConfig    `json:"openai"`
 	Anthropic AnthropicConfig `json:"anthropic"`
 	Google    GoogleConfig    `json:"google"`
+	// Custom holds user-defined providers keyed by the name they are
+	// registered under.
+	Custom map[string]*CustomProviderConfig `json:"custom,omitempty"`
+	Mock   MockConfig                       `json:"mock"`
+	// Database is the path of the SQLite database. Relative paths are
+	// resolved against the working directory.
+	Database string   `json:"database,omitempty"`
+	Defaults Defaults `json:"defaults,omitzero"`
+	// Chains are fallback chains keyed by name, used with the provider
+	// "chain:<name>".
+	Chains map[string]*Chain `json:"chains,omitempty"`
+
+	store       *credstore.Store
+	forgetNames []string
+	profile     string
+	file        *configFile
+}
+
+// Defaults are used by commands when the corresponding flag is not given.
+type Defaults struct {
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
 }
 
 type OpenAIConfig struct {
-	APIKey string `json:"api_key"`
+	Credentials
+	AccountPool
+	Settings
 }
 
 type AnthropicConfig struct {
-	APIKey string `json:"api_key"`
+	Credentials
+	AccountPool
+	Settings
 }
 
 type GoogleConfig struct {
-	APIKey string `json:"api_key"`
+	Credentials
+	AccountPool
+	Settings
 }
 
-func LoadConfig() (*Config, error) {
+// TypeOpenAICompatible is the custom provider type for servers implementing
+// the OpenAI chat completions API.
+const TypeOpenAICompatible = "openai-compatible"
+
+// BuiltinProviders are the provider names with dedicated configuration.
+var BuiltinProviders = []string{"openai", "anthropic", "google", MockProvider}
+
+type CustomProviderConfig struct {
+	Type string `json:"type"`
+	// Settings.BaseURL is required for custom providers.
+	Settings
+	Credentials
+	AccountPool
+}
+
+func IsBuiltinProvider(name string) bool {
+	for _, builtin := range BuiltinProviders {
+		if name == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateCustomName checks that name can be given to a custom provider:
+// it must not be a built-in provider or read as a chain ("chain:<name>"),
+// an account ("provider:account") or a target with a model
+// ("provider/model"), and must not contain the '#' of the names its
+// secret headers are stored under.
+func ValidateCustomName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("a provider name is required")
+	case IsBuiltinProvider(name):
+		return fmt.Errorf("%s is a built-in provider name", name)
+	case name == strings.TrimSuffix(ChainPrefix, ":"):
+		return fmt.Errorf("%s is reserved for fallback chains", name)
+	case strings.ContainsAny(name, ":/#"):
+		return fmt.Errorf("invalid provider name %q (it may not contain ':', '/' or '#')", name)
+	}
+	return nil
+}
+
+// ConfigPath returns the path of config.json.
+func ConfigPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return filepath.Join(homeDir, ".promptctl", "config.json"), nil
+}
 
-	configPath := filepath.Join(homeDir, ".promptctl", "config.json")
+// LoadConfig reads ~/.promptctl/config.json, returns the configuration of
+// the active profile and opens, without unlocking, the encrypted credential
+// store.
+func LoadConfig() (*Config, error) {
+	file, err := loadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	return file.profile(activeProfile(file))
+}
 
-	// Create config directory if it doesn't exist
-	configDir := filepath.Dir(configPath)
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+func loadConfigFile() (*configFile, error) {
+	configPath, err := ConfigPath()
+	if err != nil {
 		return nil, err
 	}
 
-	// If config doesn't exist, create default
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		defaultConfig := &Config{}
-		data, _ := json.MarshalIndent(defaultConfig, "", "  ")
-		os.WriteFile(configPath, data, 0600)
-		return defaultConfig, nil
+	storePath, err := credstore.DefaultPath()
+	if err != nil {
+		return nil, err
 	}
+	store, err := credstore.Open(storePath)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &configFile{Version: ConfigVersion}
 
+	// A missing config is the default one; it is written on the first save.
 	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		file.init(store)
+		return file, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	var config Config
-	err = json.Unmarshal(data, &config)
+	if err := decodeConfigFile(data, file); err != nil {
+		return nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+	file.init(store)
+	return file, nil
+}
+
+// decodeConfigFile parses config.json into file, upgrading older versions
+// and noting unknown keys.
+func decodeConfigFile(data []byte, file *configFile) error {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	upgraded, err := upgradeConfig(raw)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if upgraded {
+		data, err = json.Marshal(raw)
+		if err != nil {
+			return err
+		}
 	}
 
-	return &config, nil
+	if err := json.Unmarshal(data, file); err != nil {
+		return err
+	}
+	file.checkKeys(raw)
+	return nil
+}
+
+// CheckConfig parses a config.json document as LoadConfig would and
+// validates every profile, returning the warnings and errors found.
+func CheckConfig(data []byte) ([]string, []error, error) {
+	file := &configFile{}
+	if err := decodeConfigFile(data, file); err != nil {
+		return nil, nil, err
+	}
+	file.init(nil)
+	return file.warnings, file.Config.ValidateAll(), nil
 }
 
-func GetProvider(ctx context.Context) (*genevieve.Router, error) {
+// SaveConfig writes the config file, including every other profile. API
+// keys set on a profile are moved into the encrypted credential store, which
+// is created on first use, so they are never written to config.json.
+func SaveConfig(config *Config) error {
+	file := config.file
+	if file == nil {
+		return fmt.Errorf("config was not loaded with LoadConfig")
+	}
+	for _, profile := range file.profiles() {
+		if err := profile.storeKeys(); err != nil {
+			return err
+		}
+	}
+
+	configPath, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return err
+	}
+
+	file.Version = ConfigVersion
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(configPath, data)
+}
+
+// GetProvider builds a router containing a client for every built-in and
+// custom provider and the offline mock provider, plus one for each named
+// account registered as "provider:account". Keys and stored headers are
+// resolved, and the mock provider's settings checked, when a provider is
+// first used, so only the providers a command needs have to be unlocked or
+// valid; a built-in provider without a key fails then.
+func GetProvider(ctx context.Context) (*Router, error) {
 	config, err := LoadConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	openaiClient := openai.NewClient(ctx, config.OpenAI.APIKey)
-	anthropicClient := anthropic.NewClient(ctx, config.Anthropic.APIKey)
-	geminiClient := google.NewClient(ctx, config.Google.APIKey)
+	router := NewRouter()
+	router.Register(newLazyLLM(MockProvider, func() (LLM, error) {
+		mockClient, err := NewMockClient(config.Mock)
+		if err != nil {
+			return nil, err
+		}
+		policy, err := config.Mock.Limits.policy()
+		if err != nil {
+			return nil, fmt.Errorf("provider mock: %w", err)
+		}
+		return withLimits(mockClient, policy, newRateLimiter(config.Mock.Limits)), nil
+	}))
+
+	builtins := map[string]func(apiKey string, settings Settings) (LLM, error){
+		"openai": func(apiKey string, settings Settings) (LLM, error) {
+			return NewOpenAIClient(apiKey, settings)
+		},
+		"anthropic": func(apiKey string, settings Settings) (LLM, error) {
+			return NewAnthropicClient(apiKey, settings)
+		},
+		"google": func(apiKey string, settings Settings) (LLM, error) {
+			return NewGoogleClient(ctx, apiKey, settings)
+		},
+	}
+	for name, build := range builtins {
+		err := config.registerPool(router, name, false, func(apiKey string) (LLM, error) {
+			settings, err := config.resolveSettings(name)
+			if err != nil {
+				return nil, err
+			}
+			return build(apiKey, settings)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	router := genevieve.NewRouter()
-	router.Register(openaiClient)
-	router.Register(anthropicClient)
-	router.Register(geminiClient)
+	for name, custom := range config.Custom {
+		if custom.Type != TypeOpenAICompatible {
+			return nil, fmt.Errorf("provider %s: unsupported type %q", name, custom.Type)
+		}
+		err := config.registerPool(router, name, true, func(apiKey string) (LLM, error) {
+			settings, err := config.resolveSettings(name)
+			if err != nil {
+				return nil, err
+			}
+			return NewOpenAICompatibleClient(name, apiKey, settings)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return router, nil
 }
@@ -0,0 +1,85 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSaveConfig(t *testing.T) {
+	useFreshAccountState(t)
+	t.Setenv("PROMPTCTL_PROFILE", "")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Defaults.Provider = "mock"
+	config.Defaults.Model = "m"
+	if err := SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	// A second save replaces the file written by the first.
+	config.Defaults.Model = "n"
+	if err := SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Defaults.Provider != "mock" || saved.Defaults.Model != "n" {
+		t.Errorf("defaults = %+v, want mock and n", saved.Defaults)
+	}
+
+	path, err := ConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("config mode = %v, want 0600", info.Mode().Perm())
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			t.Errorf("left the temporary file %s behind", entry.Name())
+		}
+	}
+}
+
+func TestGetProviderWithoutKey(t *testing.T) {
+	useFreshAccountState(t)
+	t.Setenv("PROMPTCTL_PROFILE", "")
+	for _, name := range []string{"openai", "anthropic", "google"} {
+		for _, envVar := range KeyEnvVars(name) {
+			t.Setenv(envVar, "")
+		}
+	}
+
+	router, err := GetProvider(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"openai", "anthropic", "google"} {
+		llm, ok := router.Get(name)
+		if !ok {
+			t.Errorf("provider %s not registered without a key", name)
+			continue
+		}
+		_, err := llm.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, Options{Model: "m"})
+		if err == nil || !strings.Contains(err.Error(), "has no API key") || !strings.Contains(err.Error(), KeyEnvVars(name)[0]) {
+			t.Errorf("%s without a key: %v, want the missing key error", name, err)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Retry and rate limit defaults.
+const (
+	DefaultMaxRetries      = 2
+	DefaultRetryBackoff    = 500 * time.Millisecond
+	DefaultMaxRetryBackoff = 30 * time.Second
+)
+
+// Limits control how failed requests to a provider are retried and how
+// fast requests are sent.
+type Limits struct {
+	// MaxRetries is the number of retries after a rate limited, server or
+	// network error (default 2). Zero disables retries.
+	MaxRetries *int `json:"max_retries,omitempty"`
+	// RetryBackoff is the delay before the first retry, doubled for each
+	// further one up to MaxRetryBackoff, with jitter. A Retry-After from
+	// the provider takes precedence when it is longer, up to
+	// MaxRetryBackoff.
+	RetryBackoff    string `json:"retry_backoff,omitempty"`
+	MaxRetryBackoff string `json:"max_retry_backoff,omitempty"`
+	// RequestsPerMinute, when set, limits the rate requests are sent at,
+	// allowing bursts of up to Burst requests (default 1).
+	RequestsPerMinute float64 `json:"requests_per_minute,omitempty"`
+	Burst             int     `json:"burst,omitempty"`
+}
+
+// retryPolicy is a parsed Limits.
+type retryPolicy struct {
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func (l Limits) policy() (retryPolicy, error) {
+	policy := retryPolicy{
+		maxRetries: DefaultMaxRetries,
+		backoff:    DefaultRetryBackoff,
+		maxBackoff: DefaultMaxRetryBackoff,
+	}
+	if l.MaxRetries != nil {
+		if *l.MaxRetries < 0 {
+			return policy, fmt.Errorf("max_retries must not be negative")
+		}
+		policy.maxRetries = *l.MaxRetries
+	}
+	for _, d := range []struct {
+		key   string
+		value string
+		dst   *time.Duration
+	}{
+		{"retry_backoff", l.RetryBackoff, &policy.backoff},
+		{"max_retry_backoff", l.MaxRetryBackoff, &policy.maxBackoff},
+	} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed < 0 {
+			return policy, fmt.Errorf("invalid %s: %s", d.key, d.value)
+		}
+		*d.dst = parsed
+	}
+	if l.RequestsPerMinute < 0 || l.Burst < 0 {
+		return policy, fmt.Errorf("requests_per_minute and burst must not be negative")
+	}
+	return policy, nil
+}
+
+// delay returns how long to wait before retry number retry (starting at
+// 1): exponential backoff with jitter, or the provider's Retry-After when
+// that is longer. Neither exceeds maxBackoff.
+func (p retryPolicy) delay(retry int, err error) time.Duration {
+	backoff := p.backoff
+	for i := 1; i < retry && backoff < p.maxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, p.maxBackoff)
+	// Equal jitter: half fixed, half random, so clients that failed
+	// together do not retry together.
+	backoff = backoff/2 + rand.N(backoff/2+1)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > backoff {
+		return min(apiErr.RetryAfter, p.maxBackoff)
+	}
+	return backoff
+}
+
+// IsRetryable reports whether a failed request may succeed if sent again:
+// rate limits, timeouts, server errors and network failures.
+func IsRetryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusRequestTimeout,
+			apiErr.StatusCode == http.StatusConflict,
+			apiErr.StatusCode == http.StatusTooManyRequests,
+			apiErr.StatusCode >= 500:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RetryError is returned when a request still fails after being retried.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%v (after %d attempts)", e.Err, e.Attempts)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// limitedLLM is the middleware every provider is registered behind: it
+// waits for the provider's rate limiter and retries failed requests.
+type limitedLLM struct {
+	llm     LLM
+	policy  retryPolicy
+	limiter *rateLimiter
+}
+
+// withLimits wraps llm in the retry and rate limit middleware. limiter may
+// be nil for no rate limit.
+func withLimits(llm LLM, policy retryPolicy, limiter *rateLimiter) LLM {
+	return &limitedLLM{llm: llm, policy: policy, limiter: limiter}
+}
+
+func (l *limitedLLM) Name() string {
+	return l.llm.Name()
+}
+
+func (l *limitedLLM) Chat(ctx context.Context, messages []Message, opts Options) (*Response, error) {
+	return l.do(ctx, func() (*Response, bool, error) {
+		response, err := l.llm.Chat(ctx, messages, opts)
+		return response, true, err
+	})
+}
+
+func (l *limitedLLM) Stream(
+	ctx context.Context,
+	messages []Message,
+	opts Options,
+	onDelta func(string),
+) (*Response, error) {
+	return l.do(ctx, func() (*Response, bool, error) {
+		emitted := false
+		response, err := l.llm.Stream(ctx, messages, opts, func(delta string) {
+			emitted = true
+			onDelta(delta)
+		})
+		// Once text has been printed, a retry would repeat it.
+		return response, !emitted, err
+	})
+}
+
+func (l *limitedLLM) do(ctx context.Context, attempt func() (*Response, bool, error)) (*Response, error) {
+	for attempts := 1; ; attempts++ {
+		if err := l.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		response, retryable, err := attempt()
+		if response != nil {
+			response.Attempts = attempts
+		}
+		if err == nil {
+			return response, nil
+		}
+		if !retryable || !IsRetryable(err) || attempts > l.policy.maxRetries {
+			if attempts > 1 {
+				err = &RetryError{Attempts: attempts, Err: err}
+			}
+			return response, err
+		}
+
+		delay := l.policy.delay(attempts, err)
+		log.Warnf("%v; retrying in %s (attempt %d of %d)",
+			err, delay.Round(time.Millisecond), attempts+1, l.policy.maxRetries+1)
+		if err := sleep(ctx, delay); err != nil {
+			return response, err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimiter is a token bucket shared by the requests of one provider
+// within a process.
+type rateLimiter struct {
+	mu       sync.Mutex
+	rate     float64 // tokens per second
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// newRateLimiter returns a limiter for limits, or nil when there is no rate
+// limit.
+func newRateLimiter(limits Limits) *rateLimiter {
+	if limits.RequestsPerMinute <= 0 {
+		return nil
+	}
+	capacity := float64(max(limits.Burst, 1))
+	return &rateLimiter{
+		rate:     limits.RequestsPerMinute / 60,
+		capacity: capacity,
+		tokens:   capacity,
+		last:     time.Now(),
+	}
+}
+
+// wait blocks until a request may be sent.
+func (r *rateLimiter) wait(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	for {
+		r.mu.Lock()
+		now := time.Now()
+		r.tokens = min(r.capacity, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+		r.last = now
+		if r.tokens >= 1 {
+			r.tokens--
+			r.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - r.tokens) / r.rate * float64(time.Second))
+		r.mu.Unlock()
+
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// parseRetryAfter reads the delay a provider asked for from the
+// retry-after-ms or Retry-After response headers.
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
@@ -0,0 +1,262 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := retryPolicy{maxRetries: 5, backoff: 100 * time.Millisecond, maxBackoff: time.Second}
+
+	// Equal jitter keeps each delay between half and all of the backoff,
+	// which doubles per retry up to maxBackoff.
+	for _, tt := range []struct {
+		retry   int
+		backoff time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{10, time.Second},
+	} {
+		t.Run(fmt.Sprintf("retry %d", tt.retry), func(t *testing.T) {
+			for range 200 {
+				delay := policy.delay(tt.retry, errors.New("boom"))
+				if delay < tt.backoff/2 || delay > tt.backoff {
+					t.Fatalf("delay = %s, want between %s and %s", delay, tt.backoff/2, tt.backoff)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelayRetryAfter(t *testing.T) {
+	policy := retryPolicy{maxRetries: 2, backoff: 100 * time.Millisecond, maxBackoff: 5 * time.Second}
+
+	for _, tt := range []struct {
+		name       string
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{"longer than backoff", 2 * time.Second, 2 * time.Second, 2 * time.Second},
+		{"shorter than backoff", time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"capped at max backoff", time.Hour, 5 * time.Second, 5 * time.Second},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: tt.retryAfter})
+			delay := policy.delay(1, err)
+			if delay < tt.min || delay > tt.max {
+				t.Errorf("delay = %s, want between %s and %s", delay, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+		approx bool
+	}{
+		{name: "none", header: http.Header{}, want: 0},
+		{name: "seconds", header: http.Header{"Retry-After": {"3"}}, want: 3 * time.Second},
+		{name: "fractional seconds", header: http.Header{"Retry-After": {"0.5"}}, want: 500 * time.Millisecond},
+		{name: "milliseconds", header: http.Header{"Retry-After-Ms": {"250"}}, want: 250 * time.Millisecond},
+		{
+			name:   "milliseconds before seconds",
+			header: http.Header{"Retry-After-Ms": {"250"}, "Retry-After": {"3"}},
+			want:   250 * time.Millisecond,
+		},
+		{
+			name:   "http date",
+			header: http.Header{"Retry-After": {time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)}},
+			want:   10 * time.Second,
+			approx: true,
+		},
+		{name: "date in the past", header: http.Header{"Retry-After": {"Mon, 02 Jan 2006 15:04:05 GMT"}}, want: 0},
+		{name: "negative", header: http.Header{"Retry-After": {"-1"}}, want: 0},
+		{name: "invalid", header: http.Header{"Retry-After": {"soon"}}, want: 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRetryAfter(tt.header)
+			if tt.approx {
+				// HTTP dates have a resolution of one second.
+				if got < tt.want-2*time.Second || got > tt.want {
+					t.Errorf("parseRetryAfter = %s, want about %s", got, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseRetryAfter = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	if limiter := newRateLimiter(Limits{}); limiter != nil {
+		t.Fatal("limiter without requests_per_minute is not nil")
+	}
+	if err := (*rateLimiter)(nil).wait(context.Background()); err != nil {
+		t.Fatalf("nil limiter: %v", err)
+	}
+
+	// 600 requests a minute is one every 100ms, after a burst of 2.
+	limiter := newRateLimiter(Limits{RequestsPerMinute: 600, Burst: 2})
+	ctx := context.Background()
+	start := time.Now()
+	for range 2 {
+		if err := limiter.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("burst of 2 took %s, want no wait", elapsed)
+	}
+	if err := limiter.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("third request after %s, want about 100ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := limiter.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait with cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+// flakyLLM fails its first failures requests with err, emitting emit before
+// failing a stream, and then succeeds.
+type flakyLLM struct {
+	failures int
+	err      error
+	emit     string
+	calls    int
+}
+
+func (f *flakyLLM) Name() string {
+	return "flaky"
+}
+
+func (f *flakyLLM) Chat(ctx context.Context, messages []Message, opts Options) (*Response, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, f.err
+	}
+	return &Response{Content: "ok"}, nil
+}
+
+func (f *flakyLLM) Stream(ctx context.Context, messages []Message, opts Options, onDelta func(string)) (*Response, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		if f.emit != "" {
+			onDelta(f.emit)
+		}
+		return &Response{Content: f.emit}, f.err
+	}
+	onDelta("ok")
+	return &Response{Content: "ok"}, nil
+}
+
+func TestLimitedLLMRetries(t *testing.T) {
+	policy := retryPolicy{maxRetries: 2, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+	rateLimited := &APIError{Provider: "flaky", StatusCode: http.StatusTooManyRequests}
+	badRequest := &APIError{Provider: "flaky", StatusCode: http.StatusBadRequest}
+	ctx := context.Background()
+	noop := func(string) {}
+
+	for _, tt := range []struct {
+		name     string
+		llm      *flakyLLM
+		stream   bool
+		calls    int
+		attempts int
+		wantErr  bool
+	}{
+		{name: "retried until success", llm: &flakyLLM{failures: 2, err: rateLimited}, calls: 3, attempts: 3},
+		{name: "gives up after max retries", llm: &flakyLLM{failures: 5, err: rateLimited}, calls: 3, wantErr: true},
+		{name: "client errors are not retried", llm: &flakyLLM{failures: 1, err: badRequest}, calls: 1, wantErr: true},
+		{name: "stream retried before any text", llm: &flakyLLM{failures: 1, err: rateLimited}, stream: true, calls: 2, attempts: 2},
+		{
+			name:    "stream not retried after text",
+			llm:     &flakyLLM{failures: 1, err: rateLimited, emit: "partial"},
+			stream:  true,
+			calls:   1,
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := withLimits(tt.llm, policy, nil)
+			var response *Response
+			var err error
+			if tt.stream {
+				response, err = llm.Stream(ctx, nil, Options{}, noop)
+			} else {
+				response, err = llm.Chat(ctx, nil, Options{})
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %t", err, tt.wantErr)
+			}
+			if tt.llm.calls != tt.calls {
+				t.Errorf("sent %d times, want %d", tt.llm.calls, tt.calls)
+			}
+			if !tt.wantErr && response.Attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", response.Attempts, tt.attempts)
+			}
+			var retryErr *RetryError
+			if tt.wantErr && tt.calls > 1 && !errors.As(err, &retryErr) {
+				t.Errorf("err = %v, want a RetryError", err)
+			}
+		})
+	}
+}
+
+func TestRetryAfterFromServer(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"slow down","type":"rate_limit"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"1","object":"chat.completion","model":"m",`+
+			`"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"hi"}}]}`)
+	}))
+	defer server.Close()
+
+	client, err := NewOpenAICompatibleClient("local", "", Settings{BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := retryPolicy{maxRetries: 2, backoff: time.Millisecond, maxBackoff: 5 * time.Second}
+	llm := withLimits(client, policy, nil)
+
+	start := time.Now()
+	response, err := llm.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hello"}}, Options{Model: "m"})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("retried after %s, want the 1s Retry-After", elapsed)
+	}
+	if response.Content != "hi" || response.Attempts != 2 {
+		t.Errorf("got %q after %d attempts, want \"hi\" after 2", response.Content, response.Attempts)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("server got %d requests, want 2", n)
+	}
+}
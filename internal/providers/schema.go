@@ -0,0 +1,419 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value types of configuration keys.
+const (
+	ValueString   = "string"
+	ValueBool     = "bool"
+	ValueInt      = "int"
+	ValueNumber   = "number"
+	ValueDuration = "duration"
+	ValueURL      = "url"
+	ValuePath     = "path"
+	// ValueSecret keys hold API keys; they are only set with 'provider add'.
+	ValueSecret = "secret"
+	// ValueList keys hold lists and are only changed with 'config edit'.
+	ValueList = "list"
+	// ValueStrings keys hold lists of strings, set as comma-separated
+	// values.
+	ValueStrings = "strings"
+)
+
+// SchemaKey documents a configuration key of a profile. A "*" in Key
+// matches any single name, such as a custom provider, account or header.
+type SchemaKey struct {
+	Key         string
+	Type        string
+	Description string
+	// Values lists the accepted values of an enumerated key.
+	Values []string
+}
+
+// Schema lists every key of a profile. In config.json the keys of the
+// default profile are at the top level and those of other profiles under
+// "profiles.<name>", next to the top-level "version" and "active_profile".
+var Schema = buildSchema()
+
+func buildSchema() []SchemaKey {
+	schema := []SchemaKey{
+		{Key: "database", Type: ValuePath, Description: "SQLite database (default: promptctl.db, or promptctl-<profile>.db)"},
+		{Key: "defaults.provider", Type: ValueString, Description: "Provider used by 'run prompt' without --provider"},
+		{Key: "defaults.model", Type: ValueString, Description: "Model used by 'run prompt' without --model"},
+		{Key: "chains.*.hops", Type: ValueStrings, Description: "Fallback chain hops in order, as provider/model"},
+		{Key: "chains.*.timeout", Type: ValueDuration, Description: "Time each hop of the chain gets before the next is tried"},
+	}
+
+	providerKeys := func(prefix string) []SchemaKey {
+		return append([]SchemaKey{
+			{Key: prefix + ".api_key", Type: ValueSecret, Description: "API key awaiting 'provider lock'"},
+			{Key: prefix + ".key_file", Type: ValuePath, Description: "File containing the API key"},
+			{Key: prefix + ".key_command", Type: ValueString, Description: "Shell command that prints the API key"},
+			{Key: prefix + ".accounts.*.api_key", Type: ValueSecret, Description: "Account API key awaiting 'provider lock'"},
+			{Key: prefix + ".accounts.*.key_file", Type: ValuePath, Description: "File containing the account's API key"},
+			{Key: prefix + ".accounts.*.key_command", Type: ValueString, Description: "Shell command that prints the account's API key"},
+			{Key: prefix + ".rotation", Type: ValueString, Description: "Account rotation when rate limited", Values: Rotations},
+			{Key: prefix + ".base_url", Type: ValueURL, Description: "API endpoint"},
+			{Key: prefix + ".organization", Type: ValueString, Description: "OpenAI organisation ID"},
+			{Key: prefix + ".project", Type: ValueString, Description: "OpenAI project ID"},
+			{Key: prefix + ".stream_usage", Type: ValueBool, Description: "Ask for the token usage of streamed responses (default true)"},
+			{Key: prefix + ".timeout", Type: ValueDuration, Description: "Request timeout including streaming"},
+			{Key: prefix + ".proxy", Type: ValueURL, Description: "HTTP proxy"},
+			{Key: prefix + ".ca_bundle", Type: ValuePath, Description: "PEM file of extra certificate authorities"},
+			{Key: prefix + ".headers.*", Type: ValueString, Description: "Header added to every request"},
+			{Key: prefix + ".stored_headers", Type: ValueList, Description: "Secret headers whose values are in the encrypted store"},
+		}, limitKeys(prefix)...)
+	}
+	for _, name := range []string{"openai", "anthropic", "google"} {
+		schema = append(schema, providerKeys(name)...)
+	}
+	schema = append(schema, SchemaKey{
+		Key:         "custom.*.type",
+		Type:        ValueString,
+		Description: "Custom provider type",
+		Values:      []string{TypeOpenAICompatible},
+	})
+	schema = append(schema, providerKeys("custom.*")...)
+
+	schema = append(schema, []SchemaKey{
+		{Key: "mock.fixtures", Type: ValuePath, Description: "JSON file mapping prompt hashes to responses"},
+		{Key: "mock.rules", Type: ValueList, Description: "Regular expression rules: [{\"match\": ..., \"response\": ...}]"},
+		{Key: "mock.strict", Type: ValueBool, Description: "Fail prompts without a fixture or matching rule"},
+		{Key: "mock.latency", Type: ValueDuration, Description: "Delay before responding"},
+		{Key: "mock.error", Type: ValueString, Description: "Error message to inject"},
+		{Key: "mock.error_status", Type: ValueInt, Description: "HTTP status of injected errors (default 500)"},
+		{Key: "mock.error_rate", Type: ValueNumber, Description: "Fraction of requests that fail (default all)"},
+	}...)
+	return append(schema, limitKeys("mock")...)
+}
+
+func limitKeys(prefix string) []SchemaKey {
+	return []SchemaKey{
+		{Key: prefix + ".max_retries", Type: ValueInt, Description: "Retries after rate limit, server or network errors (default 2)"},
+		{Key: prefix + ".retry_backoff", Type: ValueDuration, Description: "Delay before the first retry, doubled after each (default 500ms)"},
+		{Key: prefix + ".max_retry_backoff", Type: ValueDuration, Description: "Longest delay between retries (default 30s)"},
+		{Key: prefix + ".requests_per_minute", Type: ValueNumber, Description: "Client-side rate limit (default none)"},
+		{Key: prefix + ".burst", Type: ValueInt, Description: "Requests allowed at once under the rate limit (default 1)"},
+	}
+}
+
+// lookupSchema returns the schema entry matching key.
+func lookupSchema(key string) (SchemaKey, bool) {
+	parts := strings.Split(key, ".")
+	for _, entry := range Schema {
+		pattern := strings.Split(entry.Key, ".")
+		if len(pattern) != len(parts) {
+			continue
+		}
+		match := true
+		for i := range pattern {
+			if pattern[i] != "*" && pattern[i] != parts[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return entry, true
+		}
+	}
+	return SchemaKey{}, false
+}
+
+// parseValue converts a command-line value into the JSON value stored for
+// entry.
+func (entry SchemaKey) parseValue(value string) (any, error) {
+	if len(entry.Values) > 0 && !contains(entry.Values, value) {
+		return nil, fmt.Errorf("invalid value %q (supported: %s)", value, strings.Join(entry.Values, ", "))
+	}
+
+	switch entry.Type {
+	case ValueSecret:
+		return nil, fmt.Errorf("API keys are set with 'promptctl provider add'")
+	case ValueList:
+		return nil, fmt.Errorf("lists are changed with 'promptctl config edit'")
+	case ValueStrings:
+		var list []any
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	case ValueBool:
+		return strconv.ParseBool(value)
+	case ValueInt:
+		return strconv.Atoi(value)
+	case ValueNumber:
+		return strconv.ParseFloat(value, 64)
+	case ValueDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid duration %q (use e.g. 90s or 5m)", value)
+		}
+	case ValueURL:
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL %q", value)
+		}
+	}
+	return value, nil
+}
+
+// unknownKeys returns the keys of a decoded profile that are not in the
+// schema, prefixed with prefix.
+func unknownKeys(profile map[string]any, prefix string) []string {
+	var unknown []string
+	var walk func(value any, key string)
+	walk = func(value any, key string) {
+		if value == nil {
+			return
+		}
+		if entry, ok := lookupSchema(key); ok {
+			if entry.Type == ValueList || !isObject(value) {
+				return
+			}
+		}
+		object, ok := value.(map[string]any)
+		if !ok || key != "" && !hasSchemaPrefix(key) {
+			unknown = append(unknown, prefix+key)
+			return
+		}
+		for name, child := range object {
+			childKey := name
+			if key != "" {
+				childKey = key + "." + name
+			}
+			walk(child, childKey)
+		}
+	}
+	walk(profile, "")
+	sort.Strings(unknown)
+	return unknown
+}
+
+// hasSchemaPrefix reports whether some schema key lies below key.
+func hasSchemaPrefix(key string) bool {
+	parts := strings.Split(key, ".")
+	for _, entry := range Schema {
+		pattern := strings.Split(entry.Key, ".")
+		if len(pattern) <= len(parts) {
+			continue
+		}
+		match := true
+		for i := range parts {
+			if pattern[i] != "*" && pattern[i] != parts[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func isObject(value any) bool {
+	_, ok := value.(map[string]any)
+	return ok
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetValue returns the value of key in the profile, formatted as JSON for
+// anything but strings, and whether it is set.
+func (c *Config) GetValue(key string) (string, bool, error) {
+	if _, ok := lookupSchema(key); !ok && !hasSchemaPrefix(key) {
+		return "", false, fmt.Errorf("unknown key: %s (see 'promptctl config list --schema')", key)
+	}
+
+	tree, err := c.tree()
+	if err != nil {
+		return "", false, err
+	}
+	value, ok := getPath(tree, strings.Split(key, "."))
+	if !ok {
+		return "", false, nil
+	}
+	if s, ok := value.(string); ok {
+		return s, true, nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), true, err
+}
+
+// SetValue sets key in the profile, checking the value against the schema.
+func (c *Config) SetValue(key, value string) error {
+	entry, ok := lookupSchema(key)
+	if !ok {
+		return fmt.Errorf("unknown key: %s (see 'promptctl config list --schema')", key)
+	}
+	parsed, err := entry.parseValue(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	tree, err := c.tree()
+	if err != nil {
+		return err
+	}
+	setPath(tree, strings.Split(key, "."), parsed)
+	return c.replace(tree)
+}
+
+// UnsetValue removes key from the profile, restoring its default.
+func (c *Config) UnsetValue(key string) error {
+	if _, ok := lookupSchema(key); !ok && !hasSchemaPrefix(key) {
+		return fmt.Errorf("unknown key: %s (see 'promptctl config list --schema')", key)
+	}
+	if entry, ok := lookupSchema(key); ok && entry.Type == ValueSecret {
+		return fmt.Errorf("%s: API keys are removed with 'promptctl provider delete'", key)
+	}
+
+	tree, err := c.tree()
+	if err != nil {
+		return err
+	}
+	path := strings.Split(key, ".")
+	deletePath(tree, path)
+	// A secret header may be in the credential store instead.
+	if n := len(path); n > 2 && path[n-2] == "headers" {
+		if settings, ok := getPath(tree, path[:n-2]); ok {
+			if object, ok := settings.(map[string]any); ok {
+				stored, _ := object["stored_headers"].([]any)
+				object["stored_headers"] = slices.DeleteFunc(stored, func(h any) bool { return h == path[n-1] })
+			}
+		}
+	}
+	return c.replace(tree)
+}
+
+// Values returns every key set in the profile with its value, sorted by
+// key. Secrets and header values are masked.
+func (c *Config) Values() ([][2]string, error) {
+	tree, err := c.tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var values [][2]string
+	var walk func(value any, key string)
+	walk = func(value any, key string) {
+		entry, known := lookupSchema(key)
+		if object, ok := value.(map[string]any); ok && (!known || entry.Type != ValueList) {
+			for name, child := range object {
+				childKey := name
+				if key != "" {
+					childKey = key + "." + name
+				}
+				walk(child, childKey)
+			}
+			return
+		}
+		if s, ok := value.(string); ok && s == "" {
+			return
+		}
+
+		var text string
+		switch {
+		case entry.Type == ValueSecret:
+			text = "(set)"
+		case strings.Contains(key, ".headers."):
+			text = "(set)"
+		default:
+			if s, ok := value.(string); ok {
+				text = s
+			} else {
+				data, _ := json.Marshal(value)
+				text = string(data)
+			}
+		}
+		values = append(values, [2]string{key, text})
+	}
+	walk(tree, "")
+	sort.Slice(values, func(i, j int) bool { return values[i][0] < values[j][0] })
+	return values, nil
+}
+
+// tree returns the profile decoded into generic JSON values.
+func (c *Config) tree() (map[string]any, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]any
+	err = json.Unmarshal(data, &tree)
+	return tree, err
+}
+
+// replace loads the profile's settings from tree, keeping its link to the
+// config file and credential store.
+func (c *Config) replace(tree map[string]any) error {
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	var updated Config
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return err
+	}
+	updated.store = c.store
+	updated.forgetNames = c.forgetNames
+	updated.profile = c.profile
+	updated.file = c.file
+	*c = updated
+	return nil
+}
+
+func getPath(tree map[string]any, path []string) (any, bool) {
+	var value any = tree
+	for _, name := range path {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[name]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func setPath(tree map[string]any, path []string, value any) {
+	object := tree
+	for _, name := range path[:len(path)-1] {
+		child, ok := object[name].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			object[name] = child
+		}
+		object = child
+	}
+	object[path[len(path)-1]] = value
+}
+
+func deletePath(tree map[string]any, path []string) {
+	object := tree
+	for _, name := range path[:len(path)-1] {
+		child, ok := object[name].(map[string]any)
+		if !ok {
+			return
+		}
+		object = child
+	}
+	delete(object, path[len(path)-1])
+}
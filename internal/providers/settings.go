@@ -0,0 +1,337 @@
+package providers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings configure how a provider's API is reached. Empty fields keep the
+// SDK's defaults.
+type Settings struct {
+	// BaseURL replaces the provider's API endpoint, for example to go
+	// through a gateway.
+	BaseURL string `json:"base_url,omitempty"`
+	// Organization and Project select the OpenAI organisation and project
+	// requests are billed to. They only apply to OpenAI-style providers.
+	Organization string `json:"organization,omitempty"`
+	Project      string `json:"project,omitempty"`
+	// StreamUsage asks an OpenAI-style provider for the token usage of
+	// streamed responses, which it is unless set to false for servers that
+	// reject the request.
+	StreamUsage *bool `json:"stream_usage,omitempty"`
+	// Timeout limits each request, including the time spent streaming the
+	// response, as a Go duration such as "90s" or "5m".
+	Timeout string `json:"timeout,omitempty"`
+	// Proxy is the URL of an HTTP proxy. Without it the HTTPS_PROXY and
+	// NO_PROXY environment variables apply.
+	Proxy string `json:"proxy,omitempty"`
+	// Headers are added to every request. Secret ones (see IsSecretHeader)
+	// are moved into the credential store on SaveConfig once it exists.
+	Headers map[string]string `json:"headers,omitempty"`
+	// StoredHeaders names the secret headers whose values are in the
+	// credential store. They are added to every request like Headers.
+	StoredHeaders []string `json:"stored_headers,omitempty"`
+	// CABundle is a PEM file of certificate authorities trusted in addition
+	// to the system ones.
+	CABundle string `json:"ca_bundle,omitempty"`
+	Limits
+}
+
+// SettingKeys lists the keys accepted by Settings.Set. Headers are set with
+// "header.<Name>".
+var SettingKeys = []string{
+	"base_url", "organization", "project", "stream_usage", "timeout", "proxy", "ca_bundle", "header.<Name>",
+	"max_retries", "retry_backoff", "max_retry_backoff", "requests_per_minute", "burst",
+}
+
+// Set changes the setting named key. An empty value restores the default.
+func (s *Settings) Set(key, value string) error {
+	if name, ok := strings.CutPrefix(key, "header."); ok {
+		if name == "" {
+			return fmt.Errorf("header name is required (header.<Name>)")
+		}
+		name = http.CanonicalHeaderKey(name)
+		s.StoredHeaders = slices.DeleteFunc(s.StoredHeaders, func(h string) bool { return h == name })
+		if value == "" {
+			delete(s.Headers, name)
+			return nil
+		}
+		if s.Headers == nil {
+			s.Headers = make(map[string]string)
+		}
+		s.Headers[name] = value
+		return nil
+	}
+
+	switch key {
+	case "base_url", "proxy":
+		if value != "" {
+			if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("invalid %s: %s", key, value)
+			}
+		}
+		if key == "base_url" {
+			s.BaseURL = value
+		} else {
+			s.Proxy = value
+		}
+	case "organization":
+		s.Organization = value
+	case "project":
+		s.Project = value
+	case "stream_usage":
+		if value == "" {
+			s.StreamUsage = nil
+			return nil
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid stream_usage: %s (use true or false)", value)
+		}
+		s.StreamUsage = &enabled
+	case "timeout":
+		if value != "" {
+			if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+				return fmt.Errorf("invalid timeout: %s (use a duration such as 90s or 5m)", value)
+			}
+		}
+		s.Timeout = value
+	case "ca_bundle":
+		if value != "" {
+			if _, err := os.Stat(expandHome(value)); err != nil {
+				return fmt.Errorf("invalid ca_bundle: %w", err)
+			}
+		}
+		s.CABundle = value
+	default:
+		return s.Limits.set(key, value)
+	}
+	return nil
+}
+
+// IsSecretHeader reports whether a header likely carries a credential, such
+// as Authorization or a gateway key, judging by its name.
+func IsSecretHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range []string{"auth", "key", "token", "secret", "password", "cookie", "signature"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// set changes the limit named key. An empty value restores the default.
+func (l *Limits) set(key, value string) error {
+	updated := *l
+	switch key {
+	case "max_retries":
+		updated.MaxRetries = nil
+		if value != "" {
+			retries, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid max_retries: %s", value)
+			}
+			updated.MaxRetries = &retries
+		}
+	case "retry_backoff":
+		updated.RetryBackoff = value
+	case "max_retry_backoff":
+		updated.MaxRetryBackoff = value
+	case "requests_per_minute":
+		updated.RequestsPerMinute = 0
+		if value != "" {
+			rpm, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid requests_per_minute: %s", value)
+			}
+			updated.RequestsPerMinute = rpm
+		}
+	case "burst":
+		updated.Burst = 0
+		if value != "" {
+			burst, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid burst: %s", value)
+			}
+			updated.Burst = burst
+		}
+	default:
+		return fmt.Errorf("unknown setting: %s (supported: %s)", key, strings.Join(SettingKeys, ", "))
+	}
+
+	if _, err := updated.policy(); err != nil {
+		return err
+	}
+	*l = updated
+	return nil
+}
+
+// List returns the settings that are set, as key/value pairs in the form
+// accepted by Set.
+func (s *Settings) List() [][2]string {
+	var list [][2]string
+	for _, setting := range [][2]string{
+		{"base_url", s.BaseURL},
+		{"organization", s.Organization},
+		{"project", s.Project},
+		{"timeout", s.Timeout},
+		{"proxy", s.Proxy},
+		{"ca_bundle", s.CABundle},
+		{"retry_backoff", s.RetryBackoff},
+		{"max_retry_backoff", s.MaxRetryBackoff},
+	} {
+		if setting[1] != "" {
+			list = append(list, setting)
+		}
+	}
+
+	if s.StreamUsage != nil {
+		list = append(list, [2]string{"stream_usage", strconv.FormatBool(*s.StreamUsage)})
+	}
+	if s.MaxRetries != nil {
+		list = append(list, [2]string{"max_retries", strconv.Itoa(*s.MaxRetries)})
+	}
+	if s.RequestsPerMinute != 0 {
+		list = append(list, [2]string{"requests_per_minute", strconv.FormatFloat(s.RequestsPerMinute, 'g', -1, 64)})
+	}
+	if s.Burst != 0 {
+		list = append(list, [2]string{"burst", strconv.Itoa(s.Burst)})
+	}
+
+	names := make([]string, 0, len(s.Headers))
+	for name := range s.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		list = append(list, [2]string{"header." + name, s.Headers[name]})
+	}
+	return list
+}
+
+// Settings returns the settings of a built-in or custom provider, or nil if
+// there is no such provider.
+func (c *Config) Settings(provider string) *Settings {
+	switch provider {
+	case "openai":
+		return &c.OpenAI.Settings
+	case "anthropic":
+		return &c.Anthropic.Settings
+	case "google":
+		return &c.Google.Settings
+	}
+	if custom, ok := c.Custom[provider]; ok {
+		return &custom.Settings
+	}
+	return nil
+}
+
+// allSettings returns the settings of every built-in and custom provider,
+// keyed by provider name.
+func (c *Config) allSettings() map[string]*Settings {
+	all := map[string]*Settings{
+		"openai":    &c.OpenAI.Settings,
+		"anthropic": &c.Anthropic.Settings,
+		"google":    &c.Google.Settings,
+	}
+	for name, custom := range c.Custom {
+		all[name] = &custom.Settings
+	}
+	return all
+}
+
+// headerStoreName returns the name a provider's secret header is kept
+// under in the credential store.
+func (c *Config) headerStoreName(provider, header string) string {
+	return c.storeName(provider + headerStoreMark + header)
+}
+
+// headerStoreMark separates the provider from the header in the store
+// names of headers. Provider names cannot contain it.
+const headerStoreMark = "#header."
+
+// resolveSettings returns a provider's settings with the values of its
+// stored headers read from the credential store, unlocking it if needed.
+func (c *Config) resolveSettings(provider string) (Settings, error) {
+	settings := *c.Settings(provider)
+	if len(settings.StoredHeaders) == 0 {
+		return settings, nil
+	}
+	if err := c.store.UnlockAuto(); err != nil {
+		return settings, fmt.Errorf("provider %s: %w", provider, err)
+	}
+	headers := make(map[string]string, len(settings.Headers)+len(settings.StoredHeaders))
+	for name, value := range settings.Headers {
+		headers[name] = value
+	}
+	for _, name := range settings.StoredHeaders {
+		value, err := c.store.Get(c.headerStoreName(provider, name))
+		if err != nil {
+			return settings, fmt.Errorf("provider %s: %w", provider, err)
+		}
+		headers[name] = value
+	}
+	settings.Headers = headers
+	return settings, nil
+}
+
+// streamUsage reports whether streamed responses should include their
+// token usage.
+func (s Settings) streamUsage() bool {
+	return s.StreamUsage == nil || *s.StreamUsage
+}
+
+// timeout returns the parsed Timeout, or zero for none.
+func (s Settings) timeout() (time.Duration, error) {
+	if s.Timeout == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s.Timeout)
+}
+
+// httpClient builds the HTTP client for the proxy, CA bundle and timeout
+// settings, or returns nil when none is set so the SDK's default is used.
+func (s Settings) httpClient() (*http.Client, error) {
+	if s.Proxy == "" && s.CABundle == "" && s.Timeout == "" {
+		return nil, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if s.Proxy != "" {
+		proxyURL, err := url.Parse(s.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if s.CABundle != "" {
+		pem, err := os.ReadFile(expandHome(s.CABundle))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", s.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	timeout, err := s.timeout()
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout: %w", err)
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
@@ -0,0 +1,119 @@
+package providers
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Validate checks the profile for settings that would only fail once a
+// provider is used, returning one error per problem.
+func (c *Config) Validate() []error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	names := []string{"openai", "anthropic", "google"}
+	custom := make([]string, 0, len(c.Custom))
+	for name := range c.Custom {
+		custom = append(custom, name)
+	}
+	sort.Strings(custom)
+	names = append(names, custom...)
+
+	for _, name := range names {
+		if custom, ok := c.Custom[name]; ok {
+			if err := ValidateCustomName(name); err != nil {
+				fail("custom.%s: %v", name, err)
+			}
+			if custom.Type != TypeOpenAICompatible {
+				fail("custom.%s.type: unsupported type %q (supported: %s)", name, custom.Type, TypeOpenAICompatible)
+			}
+			if custom.BaseURL == "" {
+				fail("custom.%s.base_url: required for %s providers", name, custom.Type)
+			}
+		}
+
+		prefix := name
+		if _, ok := c.Custom[name]; ok {
+			prefix = "custom." + name
+		}
+		if rotation := c.Pool(name).Rotation; !IsValidRotation(rotation) {
+			fail("%s.rotation: unsupported rotation %q", prefix, rotation)
+		}
+
+		settings := c.Settings(name)
+		for key, value := range map[string]string{"base_url": settings.BaseURL, "proxy": settings.Proxy} {
+			if value == "" {
+				continue
+			}
+			if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+				fail("%s.%s: invalid URL %q", prefix, key, value)
+			}
+		}
+		if settings.Timeout != "" {
+			if d, err := time.ParseDuration(settings.Timeout); err != nil || d <= 0 {
+				fail("%s.timeout: invalid duration %q", prefix, settings.Timeout)
+			}
+		}
+		if _, err := settings.httpClient(); err != nil {
+			fail("%s: %v", prefix, err)
+		}
+		if _, err := settings.Limits.policy(); err != nil {
+			fail("%s: %v", prefix, err)
+		}
+		if name == "anthropic" || name == "google" {
+			if settings.Organization != "" || settings.Project != "" {
+				fail("%s: organization and project are only supported by OpenAI-style providers", prefix)
+			}
+			if settings.StreamUsage != nil {
+				fail("%s: stream_usage is only supported by OpenAI-style providers", prefix)
+			}
+		}
+	}
+
+	if _, err := NewMockClient(c.Mock); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := c.Mock.Limits.policy(); err != nil {
+		fail("mock: %v", err)
+	}
+
+	chains := make([]string, 0, len(c.Chains))
+	for name := range c.Chains {
+		chains = append(chains, name)
+	}
+	sort.Strings(chains)
+	for _, name := range chains {
+		hops, _, err := c.Chains[name].Parse()
+		if err != nil {
+			fail("chains.%s: %v", name, err)
+			continue
+		}
+		for _, hop := range hops {
+			if !c.hasProvider(hop.Provider) {
+				fail("chains.%s: unknown provider %q", name, hop.Provider)
+			}
+		}
+	}
+
+	if provider := c.Defaults.Provider; provider != "" && !c.hasProvider(provider) {
+		fail("defaults.provider: unknown provider %q", provider)
+	}
+
+	return errs
+}
+
+// hasProvider reports whether provider names a built-in or custom provider,
+// one of their accounts, or a chain of the profile.
+func (c *Config) hasProvider(provider string) bool {
+	if chain, ok := IsChain(provider); ok {
+		_, ok = c.Chains[chain]
+		return ok
+	}
+	base, _ := SplitAccountName(provider)
+	_, ok := c.Custom[base]
+	return ok || IsBuiltinProvider(base)
+}
@@ -0,0 +1,127 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	ID         int             `xml:"id,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML: a test suite for the group
+// with a test case for each case.
+func WriteJUnit(w io.Writer, r *Report) error {
+	suite := junitSuite{
+		Name:     fmt.Sprintf("%s %s", r.Kind, r.Name),
+		ID:       r.ID,
+		Tests:    r.Summary.Total,
+		Failures: r.Summary.Failed,
+		Skipped:  r.Summary.Skipped,
+		Time:     seconds(r.Duration),
+		Properties: []junitProperty{
+			{"provider", r.Provider},
+			{"model", r.Model},
+			{"pass_rate", strconv.FormatFloat(r.Summary.PassRate, 'f', 2, 64)},
+			{"fail_under", strconv.FormatFloat(r.Summary.FailUnder, 'f', -1, 64)},
+		},
+	}
+	if r.Summary.MinScore != nil {
+		suite.Properties = append(suite.Properties, junitProperty{
+			Name:  "min_score",
+			Value: strconv.FormatFloat(*r.Summary.MinScore, 'f', -1, 64),
+		})
+	}
+	for _, s := range r.Scores {
+		suite.Properties = append(suite.Properties, junitProperty{
+			Name:  "score " + s.Assertion,
+			Value: strconv.FormatFloat(s.Mean, 'f', -1, 64),
+		})
+	}
+	for _, c := range r.Cases {
+		tc := junitCase{Name: c.Name, ClassName: r.Name, Time: seconds(c.Duration)}
+		if c.RunID != 0 {
+			tc.SystemOut = fmt.Sprintf("run %d: %s", c.RunID, c.RunStatus)
+		}
+		switch c.Status {
+		case StatusFailed:
+			tc.Failure = &junitMessage{Message: c.Message, Text: failureDetails(c)}
+		case StatusSkipped:
+			tc.Skipped = &junitMessage{Message: c.Message}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	doc := junitSuites{
+		Name:     "promptctl",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitSuite{suite},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// failureDetails lists the failed assertions of a case, one per line.
+func failureDetails(c Case) string {
+	var lines []string
+	for _, a := range c.Assertions {
+		if !a.Passed {
+			lines = append(lines, fmt.Sprintf("%s: %s", a.Assertion, a.Message))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func seconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 3, 64)
+}
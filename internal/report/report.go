@@ -0,0 +1,250 @@
+// Package report writes the outcome of evaluations and batches as
+// machine-readable reports, JSON, JUnit XML or TAP, and decides the exit
+// code of the commands that produce them.
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/farbodsalimi/promptctl/internal/eval"
+)
+
+// Exit codes of commands that report results. They depend only on the
+// outcome of the cases, so CI can tell failing prompts from broken runs.
+const (
+	// ExitPassed: every case ran, the pass rate met --fail-under and every
+	// mean judge score met --min-score.
+	ExitPassed = 0
+	// ExitFailed: the pass rate was under --fail-under or a mean judge
+	// score under --min-score.
+	ExitFailed = 1
+	// ExitError: the command could not run, e.g. because of a bad flag,
+	// a missing prompt or an unknown provider.
+	ExitError = 2
+	// ExitIncomplete: the command was interrupted before every case ran.
+	ExitIncomplete = 3
+)
+
+// Case statuses.
+const (
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// FormatVersion is the version of the JSON report format. Fields may be
+// added to it, but none are renamed or removed without a new version.
+const FormatVersion = 1
+
+// Report is the outcome of an evaluation or a batch.
+type Report struct {
+	Format int `json:"format"`
+	// Kind is the kind of run group the report is about and ID its ID.
+	Kind     string `json:"kind"`
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"`
+	// Duration is the time spent waiting for providers, in seconds.
+	Duration float64      `json:"duration_seconds"`
+	Summary  Summary      `json:"summary"`
+	Scores   []eval.Score `json:"scores,omitempty"`
+	Cases    []Case       `json:"cases"`
+}
+
+// Summary counts the cases of a report by status.
+type Summary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	// PassRate is the percentage of cases that passed, and FailUnder the
+	// pass rate under which the report fails.
+	PassRate  float64 `json:"pass_rate"`
+	FailUnder float64 `json:"fail_under"`
+	// MinScore, when set, is the mean score every judge assertion must
+	// reach for the report to pass.
+	MinScore *float64 `json:"min_score,omitempty"`
+	ExitCode int      `json:"exit_code"`
+}
+
+// Case is a test case of an evaluation or a row of a batch.
+type Case struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	RunID  int    `json:"run_id,omitempty"`
+	// RunStatus is the status of the case's run, if it has one.
+	RunStatus  string        `json:"run_status,omitempty"`
+	Duration   float64       `json:"duration_seconds"`
+	Message    string        `json:"message,omitempty"`
+	Assertions []eval.Result `json:"assertions,omitempty"`
+}
+
+// New returns an empty report of a run group.
+func New(kind string, id int, name, provider, model string) *Report {
+	return &Report{Format: FormatVersion, Kind: kind, ID: id, Name: name, Provider: provider, Model: model, Cases: []Case{}}
+}
+
+// Add adds a case to the report. Durations are kept to the millisecond.
+func (r *Report) Add(c Case) {
+	c.Duration = math.Round(c.Duration*1000) / 1000
+	r.Cases = append(r.Cases, c)
+	r.Duration = math.Round((r.Duration+c.Duration)*1000) / 1000
+	r.Summary.Total++
+	switch c.Status {
+	case StatusPassed:
+		r.Summary.Passed++
+	case StatusFailed:
+		r.Summary.Failed++
+	default:
+		r.Summary.Skipped++
+	}
+}
+
+// Finish computes the pass rate of the report and returns its exit code:
+// ExitIncomplete if any case was skipped, else ExitFailed if the pass rate
+// is under failUnder percent or a score under Summary.MinScore, else
+// ExitPassed.
+func (r *Report) Finish(failUnder float64) int {
+	s := &r.Summary
+	s.PassRate = 100
+	if s.Total > 0 {
+		s.PassRate = float64(s.Passed) * 100 / float64(s.Total)
+	}
+	s.FailUnder = failUnder
+	switch {
+	case s.Skipped > 0:
+		s.ExitCode = ExitIncomplete
+	case s.PassRate < failUnder || len(r.ScoresUnder()) > 0:
+		s.ExitCode = ExitFailed
+	default:
+		s.ExitCode = ExitPassed
+	}
+	return s.ExitCode
+}
+
+// ScoresUnder returns the scores whose mean is under Summary.MinScore.
+func (r *Report) ScoresUnder() []eval.Score {
+	var under []eval.Score
+	if r.Summary.MinScore == nil {
+		return nil
+	}
+	for _, s := range r.Scores {
+		if s.Mean < *r.Summary.MinScore {
+			under = append(under, s)
+		}
+	}
+	return under
+}
+
+// ValidateFailUnder checks a --fail-under percentage.
+func ValidateFailUnder(failUnder float64) error {
+	if failUnder < 0 || failUnder > 100 {
+		return fmt.Errorf("--fail-under must be a percentage between 0 and 100")
+	}
+	return nil
+}
+
+// ValidatePath checks that a report can be written to path in a format
+// known from its extension.
+func ValidatePath(path string) error {
+	_, err := formatOf(path)
+	return err
+}
+
+// Write writes the report to path in the format its extension names:
+// .json for JSON, .xml for JUnit XML and .tap for TAP.
+func (r *Report) Write(path string) error {
+	write, err := formatOf(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := write(f, r); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func formatOf(path string) (func(io.Writer, *Report) error, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return WriteJSON, nil
+	case ".xml":
+		return WriteJUnit, nil
+	case ".tap":
+		return WriteTAP, nil
+	}
+	return nil, fmt.Errorf("unsupported report %s (expected a .json, .xml or .tap file)", path)
+}
+
+// WriteJSON writes the report as indented JSON.
+func WriteJSON(w io.Writer, r *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// Error ends a command that reports results with an exit code. Err is
+// nil when the command has already told why, as with the outcome of its
+// cases.
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Fail returns the error of a command that could not run, exiting with
+// ExitError.
+func Fail(err error) error {
+	return &Error{Code: ExitError, Err: err}
+}
+
+// Errorf is Fail with a formatted error.
+func Errorf(format string, args ...any) error {
+	return Fail(fmt.Errorf(format, args...))
+}
+
+// Exit returns the error of a command that reported an outcome with code,
+// or nil for ExitPassed.
+func Exit(code int) error {
+	if code == ExitPassed {
+		return nil
+	}
+	return &Error{Code: code}
+}
+
+// ExitCode returns the exit code of a command that returned err: 0 for
+// nil, the code of an Error and 1 for any other error.
+func ExitCode(err error) int {
+	var e *Error
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &e):
+		return e.Code
+	}
+	return 1
+}
@@ -0,0 +1,190 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/farbodsalimi/promptctl/internal/eval"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestFinish(t *testing.T) {
+	score := func(mean float64) eval.Score { return eval.Score{Assertion: "judge", Cases: 2, Mean: mean} }
+	minScore := 0.7
+
+	for _, tt := range []struct {
+		name         string
+		statuses     []string
+		failUnder    float64
+		minScore     *float64
+		scores       []eval.Score
+		wantCode     int
+		wantPassRate float64
+	}{
+		{name: "no cases", failUnder: 100, wantCode: ExitPassed, wantPassRate: 100},
+		{name: "all passed", statuses: []string{StatusPassed, StatusPassed}, failUnder: 100, wantCode: ExitPassed, wantPassRate: 100},
+		{name: "one failed", statuses: []string{StatusPassed, StatusFailed}, failUnder: 100, wantCode: ExitFailed, wantPassRate: 50},
+		{name: "pass rate at fail-under", statuses: []string{StatusPassed, StatusFailed}, failUnder: 50, wantCode: ExitPassed, wantPassRate: 50},
+		{name: "pass rate under fail-under", statuses: []string{StatusPassed, StatusFailed}, failUnder: 50.1, wantCode: ExitFailed, wantPassRate: 50},
+		{
+			name:      "skipped before failed",
+			statuses:  []string{StatusFailed, StatusSkipped},
+			failUnder: 100,
+			wantCode:  ExitIncomplete,
+		},
+		{
+			name:         "score under min-score",
+			statuses:     []string{StatusPassed},
+			failUnder:    100,
+			minScore:     &minScore,
+			scores:       []eval.Score{score(0.9), score(0.6)},
+			wantCode:     ExitFailed,
+			wantPassRate: 100,
+		},
+		{
+			name:         "scores at min-score",
+			statuses:     []string{StatusPassed},
+			failUnder:    100,
+			minScore:     &minScore,
+			scores:       []eval.Score{score(0.7)},
+			wantCode:     ExitPassed,
+			wantPassRate: 100,
+		},
+		{
+			name:         "scores without min-score",
+			statuses:     []string{StatusPassed},
+			failUnder:    100,
+			scores:       []eval.Score{score(0.1)},
+			wantCode:     ExitPassed,
+			wantPassRate: 100,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New("eval", 1, "v/p@v1", "mock", "m")
+			for i, status := range tt.statuses {
+				r.Add(Case{Name: fmt.Sprintf("case%d", i), Status: status})
+			}
+			r.Summary.MinScore = tt.minScore
+			r.Scores = tt.scores
+			if code := r.Finish(tt.failUnder); code != tt.wantCode || r.Summary.ExitCode != tt.wantCode {
+				t.Errorf("Finish = %d, summary %d, want %d", code, r.Summary.ExitCode, tt.wantCode)
+			}
+			if r.Summary.PassRate != tt.wantPassRate {
+				t.Errorf("pass rate = %g, want %g", r.Summary.PassRate, tt.wantPassRate)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, 0},
+		{"passed", Exit(ExitPassed), ExitPassed},
+		{"failed", Exit(ExitFailed), ExitFailed},
+		{"incomplete", Exit(ExitIncomplete), ExitIncomplete},
+		{"could not run", Errorf("prompt not found: %s", "v/p"), ExitError},
+		{"wrapped", fmt.Errorf("eval: %w", Fail(errors.New("boom"))), ExitError},
+		{"other error", errors.New("boom"), 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	cause := errors.New("boom")
+	if err := Fail(cause); !errors.Is(err, cause) || err.Error() != "boom" {
+		t.Errorf("Fail(boom) = %v, want an error wrapping boom", err)
+	}
+}
+
+// sampleReport is an evaluation with a passed, a failed and a skipped case
+// and a judge score.
+func sampleReport() *Report {
+	score := 0.4
+	minScore := 0.5
+	r := New("eval", 7, "v/p@v2", "mock", "m")
+	r.Add(Case{Name: "greet", Status: StatusPassed, RunID: 11, RunStatus: "completed", Duration: 0.1234})
+	r.Add(Case{
+		Name:      "bad <input>",
+		Status:    StatusFailed,
+		RunID:     12,
+		RunStatus: "completed",
+		Duration:  0.25,
+		Message:   "1 of 2 assertions failed",
+		Assertions: []eval.Result{
+			{Assertion: "contains=hello", Passed: true},
+			{Assertion: "judge=v/tone", Passed: false, Message: `score 0.4 is under 0.5: "curt"`, Score: &score},
+		},
+	})
+	r.Add(Case{Name: "slow", Status: StatusSkipped, Message: "cancelled"})
+	r.Scores = []eval.Score{{Assertion: "judge=v/tone", Cases: 1, Mean: 0.4, Lowest: 0.4, Highest: 0.4}}
+	r.Summary.MinScore = &minScore
+	r.Finish(50)
+	return r
+}
+
+func TestWriteGolden(t *testing.T) {
+	for _, tt := range []struct {
+		golden string
+		write  func(io.Writer, *Report) error
+	}{
+		{"report.xml", WriteJUnit},
+		{"report.tap", WriteTAP},
+		{"report.json", WriteJSON},
+	} {
+		t.Run(tt.golden, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := tt.write(&b, sampleReport()); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != string(want) {
+				t.Errorf("output differs from %s:\n%s", path, b.String())
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	r := sampleReport()
+	for _, name := range []string{"report.xml", "report.tap", "report.json"} {
+		path := filepath.Join(dir, name)
+		if err := r.Write(path); err != nil {
+			t.Fatalf("Write(%s): %v", name, err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := os.ReadFile(filepath.Join("testdata", name))
+		if string(got) != string(want) {
+			t.Errorf("%s differs from the golden", name)
+		}
+	}
+	if err := r.Write(filepath.Join(dir, "report.txt")); err == nil {
+		t.Error("Write accepted an unknown format")
+	}
+}
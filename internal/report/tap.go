@@ -0,0 +1,66 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteTAP writes the report in the Test Anything Protocol, version 13.
+// Failed cases carry a YAML block with their message and failed
+// assertions; skipped cases are marked with a SKIP directive.
+func WriteTAP(w io.Writer, r *Report) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "TAP version 13")
+	fmt.Fprintf(b, "1..%d\n", len(r.Cases))
+	for i, c := range r.Cases {
+		switch c.Status {
+		case StatusPassed:
+			fmt.Fprintf(b, "ok %d - %s\n", i+1, c.Name)
+		case StatusSkipped:
+			fmt.Fprintf(b, "ok %d - %s # SKIP %s\n", i+1, c.Name, c.Message)
+		default:
+			fmt.Fprintf(b, "not ok %d - %s\n", i+1, c.Name)
+			fmt.Fprintln(b, "  ---")
+			if c.RunID != 0 {
+				fmt.Fprintf(b, "  run: %d\n", c.RunID)
+				fmt.Fprintf(b, "  run_status: %s\n", yamlString(c.RunStatus))
+			}
+			if c.Message != "" {
+				fmt.Fprintf(b, "  message: %s\n", yamlString(c.Message))
+			}
+			var failed []string
+			for _, a := range c.Assertions {
+				if !a.Passed {
+					failed = append(failed, fmt.Sprintf("%s: %s", a.Assertion, a.Message))
+				}
+			}
+			if len(failed) > 0 {
+				fmt.Fprintln(b, "  failed:")
+				for _, f := range failed {
+					fmt.Fprintf(b, "    - %s\n", yamlString(f))
+				}
+			}
+			fmt.Fprintln(b, "  ...")
+		}
+	}
+	for _, s := range r.Scores {
+		fmt.Fprintf(b, "# score %s: mean %g over %d case(s)\n", s.Assertion, s.Mean, s.Cases)
+	}
+	fmt.Fprintf(b, "# pass rate %.2f%% (fail under %g%%)\n", r.Summary.PassRate, r.Summary.FailUnder)
+	if r.Summary.MinScore != nil {
+		fmt.Fprintf(b, "# min score %g\n", *r.Summary.MinScore)
+	}
+	return b.Flush()
+}
+
+// yamlString quotes s for YAML; a JSON string is a valid YAML scalar.
+func yamlString(s string) string {
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
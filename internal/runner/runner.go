@@ -0,0 +1,381 @@
+// Package runner sends rendered prompts to providers and records each
+// attempt as a run, the way every command that executes prompts stores
+// them.
+package runner
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/farbodsalimi/promptctl/internal/db"
+	"github.com/farbodsalimi/promptctl/internal/pricing"
+	"github.com/farbodsalimi/promptctl/internal/providers"
+	"github.com/farbodsalimi/promptctl/internal/templates"
+)
+
+// Request is a rendered prompt ready to be sent.
+type Request struct {
+	PromptVersion *db.PromptVersion
+	Messages      []providers.Message
+	Vars          map[string]any
+	// Provider is the provider, account or chain name LLM was resolved
+	// from; see Resolve.
+	Provider string
+	LLM      providers.LLM
+	Options  providers.Options
+	Tags     []string
+	// GroupID and GroupRow place the run in a run group, such as a row of
+	// a batch.
+	GroupID  int
+	GroupRow int
+	// GradedRunID is the run a grader prompt is sent to grade, if any.
+	GradedRunID int
+	// OnDelta, when set, streams the response to it as it is generated.
+	OnDelta func(delta string)
+}
+
+// Render renders a prompt version into the messages sent to the provider.
+// Text prompts become a single user message.
+func Render(pv *db.PromptVersion, vars map[string]any) ([]providers.Message, error) {
+	if pv.Format != db.FormatChat {
+		rendered, err := templates.RenderTemplate(pv.Content, vars)
+		if err != nil {
+			return nil, err
+		}
+		return []providers.Message{{Role: providers.RoleUser, Content: rendered}}, nil
+	}
+
+	rendered, err := templates.RenderChat(pv.Content, vars)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]providers.Message, 0, len(rendered))
+	for _, msg := range rendered {
+		messages = append(messages, providers.Message{Role: providers.Role(msg.Role), Content: msg.Content})
+	}
+	return messages, nil
+}
+
+// Settings are how every run of a group, such as a batch, is made. They
+// are stored with the group so it can be resumed or repeated.
+type Settings struct {
+	Provider string `json:"provider"`
+	Account  string `json:"account,omitempty"`
+	// Chain is the prompt's fallback chain when the runs use it.
+	Chain   string            `json:"chain,omitempty"`
+	Options providers.Options `json:"options"`
+	Timeout string            `json:"timeout,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+}
+
+// TimeLimit returns the time limit of each run, or 0 for none.
+func (s Settings) TimeLimit() (time.Duration, error) {
+	if s.Timeout == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s.Timeout)
+}
+
+// Client returns the client the runs are sent to.
+func (s Settings) Client(router *providers.Router) (providers.LLM, error) {
+	config, err := providers.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return Resolve(router, config, s.Provider, s.Account, s.Chain)
+}
+
+// ResolveSettings fills in the provider and model of runs of a prompt left
+// unset, from the prompt's fallback chain and the profile defaults.
+func ResolveSettings(settings *Settings, vaultName, promptName string) error {
+	config, err := providers.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	promptChain, err := db.GetPromptChain(vaultName, promptName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("prompt not found: %s/%s", vaultName, promptName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get prompt: %w", err)
+	}
+	settings.Provider, settings.Options.Model, err = ResolveProvider(config, settings.Provider, settings.Options.Model, promptChain)
+	if err != nil {
+		return err
+	}
+	if settings.Provider == providers.PromptChain {
+		settings.Chain = promptChain
+	}
+	return nil
+}
+
+// ResolveProvider fills in the provider and model a prompt runs with when
+// not given by flags: the prompt's fallback chain, then the profile
+// defaults.
+func ResolveProvider(config *providers.Config, provider, model, promptChain string) (string, string, error) {
+	if provider == "" && promptChain != "" {
+		provider = providers.PromptChain
+	}
+	if provider == "" {
+		provider = config.Defaults.Provider
+	}
+	if model == "" {
+		model = config.Defaults.Model
+	}
+	if provider == "" {
+		return "", "", fmt.Errorf("provider is required (use --provider or set a profile default)")
+	}
+	// Chain hops may name their own models.
+	if model == "" && !IsChain(provider) {
+		return "", "", fmt.Errorf("model is required (use --model or set a profile default)")
+	}
+	return provider, model, nil
+}
+
+// Request returns the request of a run made with the settings.
+func (s Settings) Request(llm providers.LLM, pv *db.PromptVersion, messages []providers.Message, vars map[string]any) Request {
+	return Request{
+		PromptVersion: pv,
+		Messages:      messages,
+		Vars:          vars,
+		Provider:      s.Provider,
+		LLM:           llm,
+		Options:       s.Options,
+		Tags:          s.Tags,
+	}
+}
+
+// Params is the JSON document stored in runs.params.
+type Params struct {
+	Provider string `json:"provider"`
+	providers.Options
+	FinishReason string         `json:"finish_reason,omitempty"`
+	Vars         map[string]any `json:"vars"`
+}
+
+// Execute sends req and stores the outcome as a run, whether it completed,
+// failed, timed out or was cancelled, with the settings it was made with
+// and, for a chain, the hop that answered. It returns the run
+// together with the error of the request, if any. A run that could not be
+// stored is logged and has no ID.
+func Execute(ctx context.Context, req Request) (*db.Run, error) {
+	start := time.Now()
+	var firstToken time.Duration
+	var response *providers.Response
+	var err error
+	if req.OnDelta != nil {
+		response, err = req.LLM.Stream(ctx, req.Messages, req.Options, func(delta string) {
+			if firstToken == 0 {
+				firstToken = time.Since(start)
+			}
+			req.OnDelta(delta)
+		})
+	} else {
+		response, err = req.LLM.Chat(ctx, req.Messages, req.Options)
+	}
+	elapsed := time.Since(start)
+
+	status := db.RunStatusCompleted
+	if err != nil {
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			status = db.RunStatusTimedOut
+		case ctx.Err() != nil:
+			status = db.RunStatusCancelled
+		default:
+			status = db.RunStatusFailed
+		}
+		if response == nil {
+			response = failedResponse(req.Options, err)
+		}
+	}
+
+	run := &db.Run{
+		PromptVersionID:  req.PromptVersion.ID,
+		Version:          req.PromptVersion.Version,
+		Provider:         req.Provider,
+		Account:          response.Account,
+		Model:            response.Options.Model,
+		Response:         response.Content,
+		Status:           status,
+		Attempts:         response.Attempts,
+		Duration:         elapsed,
+		TimeToFirstToken: firstToken,
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+		Tags:             req.Tags,
+		GroupID:          req.GroupID,
+		GroupRow:         req.GroupRow,
+		GradedRunID:      req.GradedRunID,
+	}
+	if err != nil {
+		run.ErrorClass = providers.ErrorClass(err)
+		run.ErrorMessage = err.Error()
+	}
+	if response.Provider != "" {
+		run.Chain = req.Provider
+		run.Provider = response.Provider
+		hopsJSON, _ := json.Marshal(response.Hops)
+		run.Hops = string(hopsJSON)
+	}
+	if run.PromptTokens > 0 || run.CompletionTokens > 0 {
+		run.Cost = runCost(run, response.Usage)
+	}
+	paramsJSON, _ := json.Marshal(Params{
+		Provider:     run.Provider,
+		Options:      response.Options,
+		FinishReason: response.FinishReason,
+		Vars:         req.Vars,
+	})
+	run.Params = string(paramsJSON)
+
+	if err := db.CreateRun(run); err != nil {
+		log.Warnf("failed to store run in database: %v", err)
+	}
+	return run, err
+}
+
+// ExecuteAll executes requests, at most concurrency at a time and each with
+// timeout if positive, and returns their runs in order. Once ctx is done no
+// more requests are started and their runs are left nil. onDone, when set,
+// is called with each run as it finishes, one call at a time.
+func ExecuteAll(ctx context.Context, requests []Request, concurrency int, timeout time.Duration, onDone func(i int, run *db.Run)) []*db.Run {
+	runs := make([]*db.Run, len(requests))
+	var mu sync.Mutex
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(concurrency, len(requests)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				runCtx, cancel := ctx, context.CancelFunc(func() {})
+				if timeout > 0 {
+					runCtx, cancel = context.WithTimeout(ctx, timeout)
+				}
+				run, _ := Execute(runCtx, requests[i])
+				cancel()
+
+				mu.Lock()
+				runs[i] = run
+				if onDone != nil {
+					onDone(i, run)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := range requests {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return runs
+}
+
+// runCost prices a run that used usage with the pricing table, or returns
+// nil when its model has no price.
+func runCost(run *db.Run, usage providers.Usage) *float64 {
+	table, err := pricing.Load()
+	if err != nil {
+		log.Warnf("failed to load prices: %v", err)
+		return nil
+	}
+	cost, ok := table.Cost(run.Provider, run.Model, pricing.Tokens{
+		Prompt:     usage.PromptTokens,
+		CacheRead:  usage.CacheReadTokens,
+		CacheWrite: usage.CacheWriteTokens,
+		Completion: usage.CompletionTokens,
+	})
+	if !ok {
+		return nil
+	}
+	return &cost
+}
+
+// failedResponse describes a request that failed without a response: the
+// options it was sent with, the attempts made and, for a chain, the hops
+// tried.
+func failedResponse(opts providers.Options, err error) *providers.Response {
+	response := &providers.Response{Options: opts}
+	var retryErr *providers.RetryError
+	if errors.As(err, &retryErr) {
+		response.Attempts = retryErr.Attempts
+	}
+	var chainErr *providers.ChainError
+	if errors.As(err, &chainErr) && len(chainErr.Hops) > 0 {
+		last := chainErr.Hops[len(chainErr.Hops)-1]
+		response.Provider = last.Provider
+		response.Options.Model = last.Model
+		response.Hops = chainErr.Hops
+	}
+	return response
+}
+
+// IsChain reports whether provider names a fallback chain: one of the
+// profile's or, as "chain", the prompt's own.
+func IsChain(provider string) bool {
+	_, ok := providers.IsChain(provider)
+	return ok || provider == providers.PromptChain
+}
+
+// Resolve returns the client of provider, of one of its accounts or of a
+// fallback chain. promptChain is the prompt's own chain as stored with it.
+func Resolve(router *providers.Router, config *providers.Config, provider, account, promptChain string) (providers.LLM, error) {
+	if IsChain(provider) {
+		if account != "" {
+			return nil, fmt.Errorf("--account cannot be used with a fallback chain; name accounts in its hops")
+		}
+		chain, err := lookupChain(config, provider, promptChain)
+		if err != nil {
+			return nil, err
+		}
+		return router.Chain(provider, chain)
+	}
+
+	llm, ok := router.Get(provider)
+	if !ok {
+		return nil, fmt.Errorf("provider not found: %s", provider)
+	}
+	if account != "" && account != providers.DefaultAccount {
+		llm, ok = router.Get(providers.AccountName(provider, account))
+		if !ok {
+			return nil, fmt.Errorf("account %s not configured for provider %s", account, provider)
+		}
+	}
+	return llm, nil
+}
+
+// lookupChain returns the chain provider refers to: the prompt's own chain,
+// given as stored with the prompt, or a chain of the profile.
+func lookupChain(config *providers.Config, provider, promptChain string) (*providers.Chain, error) {
+	if provider == providers.PromptChain {
+		if promptChain == "" {
+			return nil, fmt.Errorf("prompt has no fallback chain (set one with 'promptctl prompt chain')")
+		}
+		var chain providers.Chain
+		if err := json.Unmarshal([]byte(promptChain), &chain); err != nil {
+			return nil, fmt.Errorf("invalid fallback chain: %w", err)
+		}
+		return &chain, nil
+	}
+
+	name, _ := providers.IsChain(provider)
+	chain, ok := config.Chains[name]
+	if !ok {
+		return nil, fmt.Errorf("fallback chain not found: %s (add one with 'promptctl config set chains.%s.hops provider/model,...')", name, name)
+	}
+	return chain, nil
+}
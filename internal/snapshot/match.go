@@ -0,0 +1,79 @@
+// Package snapshot compares responses with the golden responses approved
+// for test cases.
+package snapshot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/farbodsalimi/promptctl/internal/textdiff"
+)
+
+// Comparison modes.
+const (
+	ModeExact      = "exact"
+	ModeWhitespace = "whitespace"
+	ModeSimilarity = "similarity"
+)
+
+// Modes lists the comparison modes.
+var Modes = []string{ModeExact, ModeWhitespace, ModeSimilarity}
+
+// Matcher decides whether a response matches its golden: exactly, once
+// runs of whitespace are collapsed, or when at least Threshold similar
+// word by word.
+type Matcher struct {
+	Mode      string  `json:"mode"`
+	Threshold float64 `json:"threshold,omitempty"`
+}
+
+// Validate checks the mode and, for similarity, the threshold.
+func (m Matcher) Validate() error {
+	switch m.Mode {
+	case ModeExact, ModeWhitespace:
+	case ModeSimilarity:
+		if m.Threshold <= 0 || m.Threshold > 1 {
+			return fmt.Errorf("similarity threshold must be above 0 and at most 1")
+		}
+	default:
+		return fmt.Errorf("unknown comparison mode %q (supported: %s)", m.Mode, strings.Join(Modes, ", "))
+	}
+	return nil
+}
+
+// String describes how responses are compared.
+func (m Matcher) String() string {
+	switch m.Mode {
+	case ModeWhitespace:
+		return "normalised whitespace"
+	case ModeSimilarity:
+		return fmt.Sprintf("similarity >= %g", m.Threshold)
+	}
+	return m.Mode
+}
+
+// Match reports whether response matches golden. In similarity mode, and
+// for a response that does not match, it also returns how similar they are
+// word by word; otherwise the similarity is 0 and left uncomputed.
+func (m Matcher) Match(golden, response string) (bool, float64) {
+	var matched bool
+	switch m.Mode {
+	case ModeWhitespace:
+		matched = NormalizeWhitespace(golden) == NormalizeWhitespace(response)
+	case ModeSimilarity:
+		similarity := textdiff.Similarity(golden, response)
+		return similarity >= m.Threshold, similarity
+	default:
+		matched = golden == response
+	}
+	if matched {
+		return true, 0
+	}
+	return false, textdiff.Similarity(golden, response)
+}
+
+// NormalizeWhitespace trims s and collapses each run of whitespace in it
+// to a single space.
+func NormalizeWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,68 @@
+package snapshot
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		matcher          Matcher
+		golden, response string
+		matched          bool
+		similarity       float64
+	}{
+		{"exact", Matcher{Mode: ModeExact}, "a b", "a b", true, 0},
+		{"exact whitespace differs", Matcher{Mode: ModeExact}, "a b", "a  b", false, 1},
+		{"exact mismatch", Matcher{Mode: ModeExact}, "a b", "a c", false, 0.5},
+		{"whitespace", Matcher{Mode: ModeWhitespace}, " a\n\tb ", "a b", true, 0},
+		{"whitespace mismatch", Matcher{Mode: ModeWhitespace}, "a b", "a b c d", false, 2 * 2.0 / 6},
+		{"similar enough", Matcher{Mode: ModeSimilarity, Threshold: 0.5}, "a b", "a c", true, 0.5},
+		{"not similar enough", Matcher{Mode: ModeSimilarity, Threshold: 0.6}, "a b", "a c", false, 0.5},
+		{"similarity of equal texts", Matcher{Mode: ModeSimilarity, Threshold: 1}, "a b", "a b", true, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, similarity := tt.matcher.Match(tt.golden, tt.response)
+			if matched != tt.matched || math.Abs(similarity-tt.similarity) > 1e-9 {
+				t.Errorf("Match = %t, %g, want %t, %g", matched, similarity, tt.matched, tt.similarity)
+			}
+		})
+	}
+}
+
+func TestMatcherValidate(t *testing.T) {
+	for _, tt := range []struct {
+		matcher Matcher
+		valid   bool
+	}{
+		{Matcher{Mode: ModeExact}, true},
+		{Matcher{Mode: ModeWhitespace}, true},
+		{Matcher{Mode: ModeSimilarity, Threshold: 0.9}, true},
+		{Matcher{Mode: ModeSimilarity, Threshold: 1}, true},
+		{Matcher{Mode: ModeSimilarity}, false},
+		{Matcher{Mode: ModeSimilarity, Threshold: 1.1}, false},
+		{Matcher{Mode: "fuzzy"}, false},
+	} {
+		if err := tt.matcher.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %t", tt.matcher, err, tt.valid)
+		}
+	}
+}
+
+func TestNormalizeWhitespace(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{" \n\t ", ""},
+		{"a\u00a0b", "a b"},
+		{"  a\tb \n", "a b"},
+		{"a\r\n\r\nb", "a b"},
+		{"a b", "a b"},
+	} {
+		if got := NormalizeWhitespace(tt.in); got != tt.want {
+			t.Errorf("NormalizeWhitespace(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
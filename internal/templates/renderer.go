@@ -3,6 +3,7 @@ package templates
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"text/template"
 )
@@ -46,3 +47,98 @@ func ParseVars(varsStr string) (map[string]any, error) {
 
 	return vars, nil
 }
+
+// Message is one role-tagged template in a chat-structured prompt.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+var validRoles = map[string]bool{"system": true, "user": true, "assistant": true}
+
+// ParseMessages decodes the stored JSON form of a chat-structured prompt.
+func ParseMessages(content string) ([]Message, error) {
+	var messages []Message
+	if err := json.Unmarshal([]byte(content), &messages); err != nil {
+		return nil, err
+	}
+	if err := ValidateMessages(messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// ParseMessageFlags parses "role:content" pairs as given on the command line.
+func ParseMessageFlags(values []string) ([]Message, error) {
+	messages := make([]Message, 0, len(values))
+	for _, value := range values {
+		role, content, ok := strings.Cut(value, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid message %q (expected role:content)", value)
+		}
+		messages = append(messages, Message{Role: strings.TrimSpace(role), Content: content})
+	}
+	if err := ValidateMessages(messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func ValidateMessages(messages []Message) error {
+	if len(messages) == 0 {
+		return fmt.Errorf("chat prompt must contain at least one message")
+	}
+	for i, msg := range messages {
+		if !validRoles[msg.Role] {
+			return fmt.Errorf(
+				"message %d: invalid role %q (supported: system, user, assistant)",
+				i+1,
+				msg.Role,
+			)
+		}
+	}
+	return nil
+}
+
+func EncodeMessages(messages []Message) (string, error) {
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// RenderMessages renders every message template with the same variables.
+func RenderMessages(messages []Message, vars map[string]any) ([]Message, error) {
+	rendered := make([]Message, 0, len(messages))
+	for i, msg := range messages {
+		content, err := RenderTemplate(msg.Content, vars)
+		if err != nil {
+			return nil, fmt.Errorf("message %d (%s): %w", i+1, msg.Role, err)
+		}
+		rendered = append(rendered, Message{Role: msg.Role, Content: content})
+	}
+	return rendered, nil
+}
+
+// RenderChat parses the stored form of a chat-structured prompt and renders
+// each message with vars.
+func RenderChat(content string, vars map[string]any) ([]Message, error) {
+	messages, err := ParseMessages(content)
+	if err != nil {
+		return nil, err
+	}
+	return RenderMessages(messages, vars)
+}
+
+// FormatMessages returns a human-readable view of a chat-structured prompt.
+func FormatMessages(messages []Message) string {
+	var b strings.Builder
+	for i, msg := range messages {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n%s\n", msg.Role, msg.Content)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,160 @@
+// Package textdiff compares texts line by line or word by word.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is how a line of a diff changed.
+type Op byte
+
+const (
+	Equal  Op = ' '
+	Delete Op = '-'
+	Insert Op = '+'
+)
+
+// Line is a line of a diff.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Lines returns the shortest edit turning a into b, as lines kept, deleted
+// from a and inserted from b.
+func Lines(a, b string) []Line {
+	x, y := splitLines(a), splitLines(b)
+	lcs := commonLengths(x, y)
+
+	lines := make([]Line, 0, max(len(x), len(y)))
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, Line{Equal, x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Delete, x[i]})
+			i++
+		default:
+			lines = append(lines, Line{Insert, y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		lines = append(lines, Line{Delete, x[i]})
+	}
+	for ; j < len(y); j++ {
+		lines = append(lines, Line{Insert, y[j]})
+	}
+	return lines
+}
+
+// Unified formats the diff of a and b with the given number of unchanged
+// lines around each change, or returns "" if they are equal. Unchanged
+// lines left out are marked with "...".
+func Unified(a, b, nameA, nameB string, context int) string {
+	lines := Lines(a, b)
+	changed := false
+	for _, line := range lines {
+		if line.Op != Equal {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	// Keep the lines within context of a change.
+	keep := make([]bool, len(lines))
+	for i, line := range lines {
+		if line.Op == Equal {
+			continue
+		}
+		for k := max(i-context, 0); k <= min(i+context, len(lines)-1); k++ {
+			keep[k] = true
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", nameA, nameB)
+	skipped := false
+	for i, line := range lines {
+		if !keep[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			sb.WriteString("...\n")
+			skipped = false
+		}
+		fmt.Fprintf(&sb, "%c%s\n", line.Op, line.Text)
+	}
+	if skipped {
+		sb.WriteString("...\n")
+	}
+	return sb.String()
+}
+
+// Similarity returns how alike a and b are word by word, from 0 for
+// nothing in common to 1 for the same words in the same order: twice the
+// number of words of their longest common subsequence over the number of
+// words of both.
+func Similarity(a, b string) float64 {
+	x, y := strings.Fields(a), strings.Fields(b)
+	if len(x)+len(y) == 0 {
+		return 1
+	}
+	return float64(2*commonLength(x, y)) / float64(len(x)+len(y))
+}
+
+// commonLength returns the length of the longest common subsequence of x
+// and y, keeping only two rows of the table so that long responses compare
+// in memory linear in their length.
+func commonLength(x, y []string) int {
+	if len(y) > len(x) {
+		x, y = y, x
+	}
+	next, row := make([]int, len(y)+1), make([]int, len(y)+1)
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				row[j] = next[j+1] + 1
+			} else {
+				row[j] = max(next[j], row[j+1])
+			}
+		}
+		next, row = row, next
+	}
+	return next[0]
+}
+
+// commonLengths returns lcs, where lcs[i][j] is the length of the longest
+// common subsequence of x[i:] and y[j:]. Lines walks the whole table to
+// recover the edit, so unlike commonLength it keeps every row.
+func commonLengths(x, y []string) [][]int {
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	return lcs
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
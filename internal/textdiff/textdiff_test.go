@@ -0,0 +1,134 @@
+package textdiff
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{"both empty", "", "", []Line{}},
+		{"equal", "a\nb\n", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}}},
+		{"insert into empty", "", "a\nb", []Line{{Insert, "a"}, {Insert, "b"}}},
+		{"delete all", "a\nb", "", []Line{{Delete, "a"}, {Delete, "b"}}},
+		{"change a line", "a\nb\nc", "a\nx\nc", []Line{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}}},
+		{"insert in the middle", "a\nc", "a\nb\nc", []Line{{Equal, "a"}, {Insert, "b"}, {Equal, "c"}}},
+		{"delete at the end", "a\nb\nc", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}, {Delete, "c"}}},
+		{
+			"shortest edit",
+			"a\nb\nc\nd",
+			"b\nc\nd\ne",
+			[]Line{{Delete, "a"}, {Equal, "b"}, {Equal, "c"}, {Equal, "d"}, {Insert, "e"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Lines(tt.a, tt.b); !slices.Equal(got, tt.want) {
+				t.Errorf("Lines = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	// Ten lines, of which the third and the ninth change.
+	var a, b []string
+	for i := range 10 {
+		line := string(rune('a' + i))
+		a = append(a, line)
+		if i == 2 || i == 8 {
+			line = strings.ToUpper(line)
+		}
+		b = append(b, line)
+	}
+	before, after := strings.Join(a, "\n"), strings.Join(b, "\n")
+
+	for _, tt := range []struct {
+		name    string
+		context int
+		want    string
+	}{
+		{
+			"no context",
+			0,
+			"--- old\n+++ new\n...\n-c\n+C\n...\n-i\n+I\n...\n",
+		},
+		{
+			"one line of context",
+			1,
+			"--- old\n+++ new\n...\n b\n-c\n+C\n d\n...\n h\n-i\n+I\n j\n",
+		},
+		{
+			"context reaching the start",
+			2,
+			"--- old\n+++ new\n a\n b\n-c\n+C\n d\n e\n...\n g\n h\n-i\n+I\n j\n",
+		},
+		{
+			"overlapping context",
+			3,
+			"--- old\n+++ new\n a\n b\n-c\n+C\n d\n e\n f\n g\n h\n-i\n+I\n j\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified(before, after, "old", "new", tt.context); got != tt.want {
+				t.Errorf("Unified =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	if got := Unified(before, before+"\n", "old", "new", 3); got != "" {
+		t.Errorf("Unified of texts differing in a trailing newline = %q, want none", got)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{"both empty", "", "", 1},
+		{"only whitespace", " \n\t", "", 1},
+		{"one empty", "a b", "", 0},
+		{"disjoint", "a b c", "d e f", 0},
+		{"equal", "the cat sat", "the cat sat", 1},
+		{"whitespace ignored", "the  cat\nsat", " the cat sat ", 1},
+		{"one word changed", "the cat sat", "the dog sat", 2 * 2.0 / 6},
+		{"reordered", "a b c d", "d c b a", 2 * 1.0 / 8},
+		{"extra words", "a b", "a x b y", 2 * 2.0 / 6},
+		{"case sensitive", "Hello", "hello", 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Similarity(tt.a, tt.b)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Similarity = %g, want %g", got, tt.want)
+			}
+			if reverse := Similarity(tt.b, tt.a); math.Abs(reverse-got) > 1e-9 {
+				t.Errorf("Similarity is not symmetric: %g and %g", got, reverse)
+			}
+		})
+	}
+}
+
+func TestCommonLength(t *testing.T) {
+	for _, tt := range []struct {
+		x, y string
+	}{
+		{"", ""},
+		{"a", ""},
+		{"a b c", "a b c"},
+		{"a b c d e", "b d"},
+		{"x a y b z c", "a b c q r s t"},
+		{"a a a b", "a b a b a"},
+	} {
+		x, y := strings.Fields(tt.x), strings.Fields(tt.y)
+		if got, want := commonLength(x, y), commonLengths(x, y)[0][0]; got != want {
+			t.Errorf("commonLength(%q, %q) = %d, want %d", tt.x, tt.y, got, want)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	log "github.com/sirupsen/logrus"
 
 	"github.com/farbodsalimi/promptctl/cmd"
@@ -15,7 +17,5 @@ func init() {
 }
 
 func main() {
-	if err := cmd.Execute(Version); err != nil {
-		log.Fatal(err)
-	}
+	os.Exit(cmd.Execute(Version))
 }